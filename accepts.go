@@ -1,7 +1,7 @@
 package httpcompression
 
 import (
-	"math"
+	"net/http"
 	"strconv"
 	"strings"
 )
@@ -11,67 +11,125 @@ const (
 	// This is actually kind of ambiguous in RFC 2616, so hopefully it's correct.
 	// The examples seem to indicate that it is.
 	defaultQValue = 1.0
+
+	// anyCoding is the wildcard that matches any content-coding not listed explicitly.
+	anyCoding = "*"
 )
 
-// acceptedCompression returns the list of common compression scheme supported by client and server.
-func acceptedCompression(accept codings, comps comps) []string {
-	var s []string
-	// pick smallest N to do O(N) iterations
-	if len(accept) < len(comps) {
-		for k, v := range accept {
-			if v > 0 && comps[k].comp != nil {
-				s = append(s, k)
-			}
-		}
-	} else {
-		for k, v := range comps {
-			if v.comp != nil && accept[k] > 0 {
-				s = append(s, k)
-			}
+// NotAcceptable controls whether the middleware responds with 406 Not Acceptable
+// when the client rejects the identity coding (e.g. "identity;q=0" or "*;q=0") and
+// does not accept any of the enabled compressors. If disabled, the response is sent
+// uncompressed, ignoring the Accept-Encoding header.
+// The default is true.
+func NotAcceptable(enabled bool) Option {
+	return func(c *config) error {
+		c.notAcceptable = enabled
+		return nil
+	}
+}
+
+func notAcceptable(w http.ResponseWriter, _ *http.Request) {
+	http.Error(w, http.StatusText(http.StatusNotAcceptable), http.StatusNotAcceptable)
+}
+
+// codingAliases lists the content-codings that must be considered equivalent to
+// other content-codings.
+// See: https://www.rfc-editor.org/rfc/rfc9110#section-8.4.1.
+var codingAliases = [...]struct{ alias, coding string }{
+	{"x-gzip", "gzip"},
+	{"x-compress", "compress"},
+}
+
+// resolveAlias returns the content-coding of which coding is an alias (ignoring
+// case), or coding itself if it is not an alias.
+func resolveAlias(coding string) string {
+	for _, a := range codingAliases {
+		if strings.EqualFold(coding, a.alias) {
+			return a.coding
 		}
 	}
-	return s
+	return coding
 }
 
-// parseEncodings attempts to parse a list of codings, per RFC 2616, as might
+// parseEncodings attempts to parse a list of codings, per RFC 9110, as might
 // appear in an Accept-Encoding header. It returns a map of content-codings to
-// quality values.
-// Errors encountered during parsing the codings are ignored.
+// quality values. Aliases (e.g. "x-gzip") are mapped to the corresponding
+// content-coding, and the "*" wildcard is returned as is.
+// Codings that can not be parsed are ignored.
+// It is used only to pass the accepted codings to the Negotiator: the negotiation
+// itself is performed by encodingTable, that does not allocate.
 //
-// See: http://tools.ietf.org/html/rfc2616#section-14.3.
+// See: https://www.rfc-editor.org/rfc/rfc9110#section-12.5.3.
 func parseEncodings(vv []string) codings {
 	c := make(codings)
 	for _, v := range vv {
 		for _, sv := range strings.Split(v, ",") {
-			coding, qvalue := parseCoding(sv)
-			if coding == "" {
+			coding, qvalue, ok := parseCoding(sv)
+			if !ok {
 				continue
 			}
+			coding = resolveAlias(strings.ToLower(coding))
 			c[coding] = qvalue
 		}
 	}
 	return c
 }
 
-// parseCoding parses a single conding (content-coding with an optional qvalue),
-// as might appear in an Accept-Encoding header. It attempts to forgive minor
-// formatting errors.
-func parseCoding(s string) (coding string, qvalue float64) {
+// parseCoding parses a single coding (content-coding with an optional weight),
+// as might appear in an Accept-Encoding header. It tolerates whitespace around
+// the weight, and ignores other parameters. If the weight is malformed (e.g. "q=2"
+// or "q=0.1234"), or the coding is empty, ok is false.
+// The returned coding is not normalized (i.e. it is not lowercased, and aliases
+// are not resolved). parseCoding does not allocate.
+func parseCoding(s string) (coding string, qvalue float64, ok bool) {
 	qvalue = defaultQValue
 
-	p := strings.IndexRune(s, ';')
-	if p != -1 {
-		if part := strings.Replace(s[p+1:], " ", "", -1); strings.HasPrefix(part, "q=") {
-			qvalue, _ = strconv.ParseFloat(part[2:], 64)
-			if qvalue < 0.0 || math.IsNaN(qvalue) {
-				qvalue = 0.0
-			} else if qvalue > 1.0 {
-				qvalue = 1.0
+	coding, params := s, ""
+	if p := strings.IndexByte(s, ';'); p >= 0 {
+		coding, params = s[:p], s[p+1:]
+	}
+	for params != "" {
+		p := params
+		if i := strings.IndexByte(params, ';'); i >= 0 {
+			p, params = params[:i], params[i+1:]
+		} else {
+			params = ""
+		}
+		p = strings.TrimSpace(p)
+		if p == "" || (p[0] != 'q' && p[0] != 'Q') {
+			continue
+		}
+		v := strings.TrimSpace(p[1:])
+		if !strings.HasPrefix(v, "=") {
+			continue
+		}
+		q, ok := parseQValue(strings.TrimSpace(v[1:]))
+		if !ok {
+			return "", 0, false
+		}
+		qvalue = q
+	}
+	coding = strings.TrimSpace(coding)
+	return coding, qvalue, coding != ""
+}
+
+// parseQValue parses a qvalue, that must be a number between 0 and 1 with at
+// most 3 decimal digits.
+// See: https://www.rfc-editor.org/rfc/rfc9110#section-12.4.2.
+func parseQValue(s string) (float64, bool) {
+	if s == "" || len(s) > 5 || (s[0] != '0' && s[0] != '1') {
+		return 0, false
+	}
+	if len(s) > 1 {
+		if s[1] != '.' {
+			return 0, false
+		}
+		for i := 2; i < len(s); i++ {
+			if s[i] < '0' || s[i] > '9' || (s[0] == '1' && s[i] != '0') {
+				return 0, false
 			}
 		}
-	} else {
-		p = len(s)
 	}
-	coding = strings.ToLower(strings.TrimSpace(s[:p]))
-	return
+	q, err := strconv.ParseFloat(s, 64)
+	return q, err == nil
 }
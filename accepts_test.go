@@ -1,9 +1,9 @@
 package httpcompression
 
 import (
-	"fmt"
 	"io"
-	"sort"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -12,46 +12,46 @@ import (
 func TestAcceptedCompression(t *testing.T) {
 	t.Parallel()
 	cases := []struct {
-		accept        codings
+		accept        string
 		onlyGzip      []string
 		onlyBrotli    []string
 		gzipAndBrotli []string
 	}{
-		{codings{}, nil, nil, nil},
-		{codings{"identity": 1}, nil, nil, nil},
-		{codings{"yadda": 1}, nil, nil, nil},
-		{codings{"gzip": 1}, []string{"gzip"}, nil, []string{"gzip"}},
-		{codings{"gzip": 0.5}, []string{"gzip"}, nil, []string{"gzip"}},
-		{codings{"gzip_0": 1}, nil, nil, nil},
-		{codings{"gzip": 1, "identity": 1}, []string{"gzip"}, nil, []string{"gzip"}},
-		{codings{"gzip": 0}, nil, nil, nil},
-		{codings{"br": 1}, nil, []string{"br"}, []string{"br"}},
-		{codings{"gzip": 1, "br": 1}, []string{"gzip"}, []string{"br"}, []string{"gzip", "br"}},
-		{codings{"gzip": 1, "br": 0.5}, []string{"gzip"}, []string{"br"}, []string{"gzip", "br"}},
-		{codings{"gzip": 1, "br": 0}, []string{"gzip"}, nil, []string{"gzip"}},
+		{"", nil, nil, nil},
+		{"identity", nil, nil, nil},
+		{"yadda", nil, nil, nil},
+		{"gzip", []string{"gzip"}, nil, []string{"gzip"}},
+		{"gzip;q=0.5", []string{"gzip"}, nil, []string{"gzip"}},
+		{"gzip_0", nil, nil, nil},
+		{"gzip, identity", []string{"gzip"}, nil, []string{"gzip"}},
+		{"gzip;q=0", nil, nil, nil},
+		{"br", nil, []string{"br"}, []string{"br"}},
+		{"gzip, br", []string{"gzip"}, []string{"br"}, []string{"gzip", "br"}},
+		{"gzip, br;q=0.5", []string{"gzip"}, []string{"br"}, []string{"gzip", "br"}},
+		{"gzip, br;q=0", []string{"gzip"}, nil, []string{"gzip"}},
+		{"*", []string{"gzip"}, []string{"br"}, []string{"gzip", "br"}},
+		{"*;q=0.5, br;q=0", []string{"gzip"}, nil, []string{"gzip"}},
+		{"*;q=0, br", nil, []string{"br"}, []string{"br"}},
+		{"*;q=0", nil, nil, nil},
 	}
 	onlyGzip := comps{"gzip": comp{comp: fakeCompressor{}}}
 	onlyBrotli := comps{"br": comp{comp: fakeCompressor{}}}
 	gzipAndBrotli := comps{"gzip": comp{comp: fakeCompressor{}}, "br": comp{comp: fakeCompressor{}}}
+	accepted := func(t *testing.T, accept string, comps comps) []string {
+		table, err := newEncodingTable(comps, PreferServer)
+		assert.Nil(t, err)
+		return table.acceptedEncodings(table.negotiate([]string{accept}))
+	}
 	for _, c := range cases {
-		t.Run(fmt.Sprintf("%v", c.accept), func(t *testing.T) {
+		t.Run(c.accept, func(t *testing.T) {
 			t.Run("onlyGzip", func(t *testing.T) {
-				a := acceptedCompression(c.accept, onlyGzip)
-				sort.Strings(a)
-				sort.Strings(c.onlyGzip)
-				assert.Equal(t, a, c.onlyGzip)
+				assert.ElementsMatch(t, c.onlyGzip, accepted(t, c.accept, onlyGzip))
 			})
 			t.Run("onlyBrotli", func(t *testing.T) {
-				a := acceptedCompression(c.accept, onlyBrotli)
-				sort.Strings(a)
-				sort.Strings(c.onlyBrotli)
-				assert.Equal(t, a, c.onlyBrotli)
+				assert.ElementsMatch(t, c.onlyBrotli, accepted(t, c.accept, onlyBrotli))
 			})
 			t.Run("gzipAndBrotli", func(t *testing.T) {
-				a := acceptedCompression(c.accept, gzipAndBrotli)
-				sort.Strings(a)
-				sort.Strings(c.gzipAndBrotli)
-				assert.Equal(t, a, c.gzipAndBrotli)
+				assert.ElementsMatch(t, c.gzipAndBrotli, accepted(t, c.accept, gzipAndBrotli))
 			})
 		})
 	}
@@ -60,3 +60,44 @@ func TestAcceptedCompression(t *testing.T) {
 type fakeCompressor struct{}
 
 func (fakeCompressor) Get(_ io.Writer) io.WriteCloser { return nil }
+
+func TestNegotiation(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		accept   string
+		opts     []Option
+		status   int
+		encoding string
+	}{
+		{"", nil, http.StatusOK, ""},
+		{"*", nil, http.StatusOK, "zstd"},
+		{"*;q=0.5, br;q=0", nil, http.StatusOK, "zstd"},
+		{"*;q=0.5, zstd;q=0", nil, http.StatusOK, "br"},
+		{"*;q=0.5, gzip", []Option{Prefer(PreferClient)}, http.StatusOK, "gzip"},
+		{"x-gzip", nil, http.StatusOK, "gzip"},
+		{"gzip;q=2", nil, http.StatusOK, ""},
+		{"identity", nil, http.StatusOK, ""},
+		{"unknown, identity;q=0", nil, http.StatusNotAcceptable, ""},
+		{"unknown, *;q=0", nil, http.StatusNotAcceptable, ""},
+		{"unknown, *;q=0, identity", nil, http.StatusOK, ""},
+		{"unknown, identity;q=0", []Option{NotAcceptable(false)}, http.StatusOK, ""},
+		{"gzip, identity;q=0", nil, http.StatusOK, "gzip"},
+	}
+	for _, c := range cases {
+		t.Run(c.accept, func(t *testing.T) {
+			h := newTestHandler(testBody, c.opts...)
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set(acceptEncoding, c.accept)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			assert.Equal(t, c.status, w.Code)
+			assert.Equal(t, c.encoding, w.Header().Get(contentEncoding))
+			assert.Equal(t, acceptEncoding, w.Header().Get(vary))
+			if c.status == http.StatusOK && c.encoding == "" {
+				assert.Equal(t, testBody, w.Body.String())
+			}
+		})
+	}
+}
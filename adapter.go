@@ -6,11 +6,14 @@ import (
 	"net/http"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/CAFxX/httpcompression/contrib/andybalholm/brotli"
 	cgzip "github.com/CAFxX/httpcompression/contrib/compress/gzip"
 	"github.com/CAFxX/httpcompression/contrib/compress/zlib"
 	"github.com/CAFxX/httpcompression/contrib/klauspost/zstd"
+	"github.com/CAFxX/httpcompression/dictionary"
+	"github.com/CAFxX/httpcompression/limit"
 )
 
 const (
@@ -46,8 +49,10 @@ const (
 // An error will be returned if invalid options are given.
 func Adapter(opts ...Option) (func(http.Handler) http.Handler, error) {
 	c := config{
-		prefer:     PreferServer,
-		compressor: comps{},
+		prefer:        PreferServer,
+		compressor:    comps{},
+		notAcceptable: true,
+		now:           time.Now,
 	}
 	for _, o := range opts {
 		err := o(&c)
@@ -56,6 +61,16 @@ func Adapter(opts ...Option) (func(http.Handler) http.Handler, error) {
 		}
 	}
 
+	for _, ctc := range c.contentTypeCompressors {
+		cc, ok := c.compressor[ctc.encoding]
+		if !ok {
+			return nil, fmt.Errorf("content type compressor for disabled encoding %q", ctc.encoding)
+		}
+		if (cc.dict == nil) != (ctc.comp.dict == nil) {
+			return nil, fmt.Errorf("content type compressor for %q: dictionary and regular compressors can not be mixed", ctc.encoding)
+		}
+	}
+
 	if len(c.compressor) == 0 {
 		// No compressors have been configured, so there is no useful work
 		// that this adapter can do.
@@ -64,6 +79,40 @@ func Adapter(opts ...Option) (func(http.Handler) http.Handler, error) {
 		}, nil
 	}
 
+	table, err := newEncodingTable(c.compressor, c.prefer)
+	if err != nil {
+		return nil, err
+	}
+	c.table = table
+	if c.prefer == PreferSmallest || c.prefer == PreferFastest {
+		c.stats = newEncodingStats(table)
+	}
+
+	if c.cache != nil {
+		for enc, comp := range c.compressor {
+			if comp.comp == nil {
+				// Dictionary encodings are not cached.
+				continue
+			}
+			fp, err := compressorFingerprint(comp.comp)
+			if err != nil {
+				return nil, fmt.Errorf("compressor %q: %w", enc, err)
+			}
+			comp.fingerprint = fp
+			c.compressor[enc] = comp
+		}
+		for i, ctc := range c.contentTypeCompressors {
+			if ctc.comp.comp == nil {
+				continue
+			}
+			fp, err := compressorFingerprint(ctc.comp.comp)
+			if err != nil {
+				return nil, fmt.Errorf("content type compressor %q: %w", ctc.encoding, err)
+			}
+			c.contentTypeCompressors[i].comp.fingerprint = fp
+		}
+	}
+
 	bufPool := &sync.Pool{}
 	writerPool := &sync.Pool{}
 
@@ -71,23 +120,67 @@ func Adapter(opts ...Option) (func(http.Handler) http.Handler, error) {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			addVaryHeader(w.Header(), acceptEncoding)
 
-			accept := parseEncodings(r.Header.Values(acceptEncoding))
-			common := acceptedCompression(accept, c.compressor)
-			if len(common) == 0 {
-				h.ServeHTTP(w, r)
+			neg := c.table.negotiate(r.Header.Values(acceptEncoding))
+			var dict, announce *dictionary.Dictionary
+			if neg.accepted&c.table.dictionaries != 0 {
+				// The response depends on the dictionary available to the client.
+				addVaryHeader(w.Header(), dictionary.AvailableDictionary)
+				if dict = c.availableDictionary(r); dict == nil {
+					neg = c.table.withoutDictionaries(neg)
+				}
+				announce = c.announcedDictionary(r)
+			}
+			skip := NotSkipped
+			switch {
+			case neg.best < 0:
+				skip = SkipNoCommonEncoding
+			case c.requestNoTransform && noTransform(r.Header):
+				skip = SkipNoTransform
+			}
+			if skip != NotSkipped {
+				next := h
+				if skip == SkipNoCommonEncoding && c.notAcceptable && !neg.identity {
+					next = http.HandlerFunc(notAcceptable)
+				}
+				if c.observer == nil {
+					next.ServeHTTP(w, r)
+					return
+				}
+				ow := &observeWriter{ResponseWriter: w}
+				next.ServeHTTP(ow, r)
+				c.observer(r, Stats{
+					SkipReason:        skip,
+					UncompressedBytes: ow.n,
+					CompressedBytes:   ow.n,
+				})
 				return
 			}
 
-			// We do not handle range requests when compression is used, as the
+			// By default we do not handle range requests when compression is used, as the
 			// range specified applies to the compressed data, not to the uncompressed one.
 			// So we would need to (1) ensure that compressors are deterministic and (2)
 			// generate the whole uncompressed response anyway, compress it, and then discard
 			// the bits outside of the range.
-			// Let's keep it simple, and simply ignore completely the range header.
+			// Unless RangeRequests is enabled, let's keep it simple, and simply ignore
+			// completely the range header.
 			// We also need to remove the Accept: Range header from any response that is
 			// compressed; this is done in the ResponseWriter.
 			// See https://github.com/nytimes/gziphandler/issues/83.
-			r.Header.Del(_range)
+			orig := r
+			if c.ranges && isRangeRequest(r) {
+				// The range is served by rw from the whole response; see RangeRequests.
+				rw, rr := newRangeWriter(w, r)
+				defer func() {
+					// Deferred before gw.Close, so it runs after it.
+					if err := rw.serve(); err != nil && c.errorHandler != nil {
+						c.errorHandler(orig, &CompressionError{Op: "write", Err: err})
+					}
+				}()
+				w, r = rw, rr
+			} else {
+				r.Header.Del(_range)
+			}
+			r = c.conditionalRequest(r, neg)
 
 			gw, _ := writerPool.Get().(*compressWriter)
 			if gw == nil {
@@ -95,9 +188,11 @@ func Adapter(opts ...Option) (func(http.Handler) http.Handler, error) {
 			}
 			*gw = compressWriter{
 				ResponseWriter: w,
+				request:        orig,
 				config:         c,
-				accept:         accept,
-				common:         common,
+				neg:            neg,
+				dict:           dict,
+				announce:       announce,
 				pool:           bufPool,
 			}
 			defer func() {
@@ -106,8 +201,8 @@ func Adapter(opts ...Option) (func(http.Handler) http.Handler, error) {
 				// it is guaranteed by the CompressorProvider interface, and
 				// because some compressors may be implemented via cgo, and they
 				// may rely on Close() being called to release memory resources.
-				// TODO: expose the error
-				_ = gw.Close() // expose the error
+				// Errors are reported to the ErrorHandler, if any.
+				_ = gw.Close()
 				*gw = compressWriter{}
 				writerPool.Put(gw)
 			}()
@@ -152,18 +247,52 @@ func DefaultAdapter(opts ...Option) (func(http.Handler) http.Handler, error) {
 
 // Used for functional configuration.
 type config struct {
-	minSize      int                 // Specifies the minimum response size to gzip. If the response length is bigger than this value, it is compressed.
-	contentTypes []parsedContentType // Only compress if the response is one of these content-types. All are accepted if empty.
-	blacklist    bool
-	prefer       PreferType
-	compressor   comps
+	minSize                int                 // Specifies the minimum response size to gzip. If the response length is bigger than this value, it is compressed.
+	contentTypes           []parsedContentType // Only compress if the response is one of these content-types. All are accepted if empty.
+	blacklist              bool
+	prefer                 PreferType
+	compressor             comps
+	contentTypeCompressors []contentTypeCompressor // Override compressor for some content types.
+	table                  *encodingTable          // Built by Adapter from compressor and prefer.
+	negotiator             Negotiator              // Overrides prefer, if set.
+	stats                  *encodingStats          // Built by Adapter for PreferSmallest and PreferFastest.
+
+	notAcceptable bool // Whether to respond 406 if identity is rejected and no compressor is acceptable.
+
+	decompressor     map[string]DecompressorProvider // Decompressors used by RequestDecompressor; nil values disable the encoding.
+	decompressLimits limit.Limits                    // Limits enforced when decompressing request bodies.
+	windowLimits     map[string]windowLimit          // Per-encoding window limits enforced when decompressing request bodies.
+
+	requestEncoding   string             // Content-Encoding used by Transport to compress request bodies.
+	requestCompressor CompressorProvider // Compressor used by Transport to compress request bodies.
+	requestFallback   bool               // Whether Transport retries uncompressed after a 415 response.
+
+	errorHandler func(r *http.Request, err error)   // Called when writing, flushing or closing a response fails.
+	observer     func(r *http.Request, stats Stats) // Called at the end of each response.
+
+	precompressed map[string]string // File extensions of the precompressed siblings served by FileServer.
+
+	cache *Cache // Cache of compressed responses.
+
+	ranges bool // Whether range requests are served from the whole (compressed) response.
+
+	etags ETagMode // How the ETags of compressed responses are rewritten.
+
+	requestNoTransform bool // Whether Cache-Control: no-transform in requests disables compression.
+
+	dictionaries DictionaryStore    // Dictionaries used by the dictionary encodings.
+	sampler      dictionary.Sampler // Receives the uncompressed bodies of the compressed responses.
+
+	now func() time.Time // Clock used to measure the time spent in the compressors.
 }
 
 type comps map[string]comp
 
 type comp struct {
-	comp     CompressorProvider
-	priority int
+	comp        CompressorProvider
+	priority    int
+	dict        dictionary.Compressor // Set, instead of comp, for the dictionary encodings.
+	fingerprint string                // Used in the cache keys; computed by Adapter if the Cache is set.
 }
 
 // Option can be passed to Handler to control its configuration.
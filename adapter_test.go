@@ -46,16 +46,35 @@ func TestParseEncodings(t *testing.T) {
 		"gzip;q=1.0, identity; q=0.5, *;q=0": {"gzip": 1.0, "identity": 0.5, "*": 0.0},
 
 		// More random stuff
-		"AAA;q=1":     {"aaa": 1.0},
-		"BBB ; q = 2": {"bbb": 1.0},
-		"CCC; q = -1": {"ccc": 0.0},
-		"DDD;":        {"ddd": 1.0},
-		"EEE;;":       {"eee": 1.0},
-		"FFF;q=;":     {"fff": 0.0},
-		";":           {},
-		";q=1":        {},
-		";;":          {},
-		";;q=1":       {},
+		"AAA;q=1":       {"aaa": 1.0},
+		"BBB ; q = 0.5": {"bbb": 0.5},
+		"DDD;":          {"ddd": 1.0},
+		"EEE;;":         {"eee": 1.0},
+		";":             {},
+		";q=1":          {},
+		";;":            {},
+		";;q=1":         {},
+
+		// Malformed qvalues (RFC 9110, section 12.4.2) cause the coding to be ignored
+		"BBB ; q = 2":            {},
+		"CCC; q = -1":            {},
+		"FFF;q=;":                {},
+		"GGG;q=0.1234":           {},
+		"HHH;q=1.001":            {},
+		"III;q=.5":               {},
+		"JJJ;q=0.5x":             {},
+		"KKK;q=0.5, LLL;q=1.000": {"kkk": 0.5, "lll": 1.0},
+
+		// Parameters
+		"gzip;Q=0.5":       {"gzip": 0.5},
+		"gzip;level=1":     {"gzip": 1.0},
+		"gzip;quality=0.5": {"gzip": 1.0},
+		"gzip;q=0.5;x=y":   {"gzip": 0.5},
+
+		// Aliases (RFC 9110, section 8.4.1)
+		"x-gzip":                  {"gzip": 1.0},
+		"X-Gzip;q=0.5, br":        {"gzip": 0.5, "br": 1.0},
+		"x-compress;q=0.1, *;q=0": {"compress": 0.1, "*": 0.0},
 	}
 
 	for eg, exp := range examples {
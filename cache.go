@@ -0,0 +1,362 @@
+package httpcompression
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+const etag = "ETag"
+
+// Cache is a cache of compressed responses. When a Cache is used by the middleware
+// (see ResponseCache), responses that would be compressed are buffered in full, and
+// if the same body has already been compressed with the same compressor, the
+// cached compressed body is sent without invoking the compressor.
+//
+// The cache key is derived from the encoding, from the configuration of the
+// compressor, and from either the (strong) ETag of the response and the request
+// URL, or (if the response has no strong ETag) from the hash of the uncompressed
+// body. When the ETag is used and the cache contains the response, the body written
+// by the handler is discarded.
+//
+// Responses whose body is larger than the maximum entry size, and responses that
+// are flushed before completion, are not cached: they are compressed as usual.
+//
+// Concurrent responses with the same cache key that are not in the cache are
+// coalesced: only one of them is compressed, and the others wait for its result
+// (see CoalesceTimeout).
+//
+// A Cache can be shared by multiple middlewares, and it is safe for concurrent use.
+type Cache struct {
+	store           CacheStore
+	maxEntrySize    int
+	coalesceTimeout time.Duration
+
+	mu        sync.Mutex
+	inflight  map[string]*flight // compressions in progress, by key
+	hits      uint64
+	misses    uint64
+	coalesced uint64
+	timeouts  uint64
+}
+
+// flight is a compression in progress, whose result is shared by all the
+// concurrent responses with the same cache key.
+type flight struct {
+	done chan struct{} // closed when data and err are set
+	data []byte
+	err  error
+}
+
+// CacheStats are the statistics of a Cache.
+type CacheStats struct {
+	Hits      uint64 // Number of responses served from the cache.
+	Misses    uint64 // Number of responses that were compressed and added to the cache.
+	Coalesced uint64 // Number of responses that shared the result of a concurrent compression.
+	Timeouts  uint64 // Number of responses that timed out waiting for a concurrent compression.
+
+	StoreStats // Statistics of the CacheStore.
+}
+
+// DefaultCoalesceTimeout is the default maximum time that a response waits for
+// a concurrent compression of the same payload. See CoalesceTimeout.
+const DefaultCoalesceTimeout = 500 * time.Millisecond
+
+// CacheOption can be passed to NewCache to control the configuration of the Cache.
+type CacheOption func(c *Cache) error
+
+// CoalesceTimeout is a CacheOption that controls the maximum time that a response
+// waits for a concurrent compression of the same payload. After the timeout, the
+// response is compressed independently. Zero disables coalescing.
+// The default is DefaultCoalesceTimeout.
+func CoalesceTimeout(timeout time.Duration) CacheOption {
+	return func(c *Cache) error {
+		if timeout < 0 {
+			return fmt.Errorf("coalesce timeout can not be negative: %v", timeout)
+		}
+		c.coalesceTimeout = timeout
+		return nil
+	}
+}
+
+// NewCache returns a new Cache that holds up to maxBytes bytes of compressed
+// responses in memory, evicting the least recently used ones when full (see
+// NewMemoryStore). Responses whose uncompressed body is larger than maxEntrySize
+// bytes are not cached.
+func NewCache(maxBytes int64, maxEntrySize int, opts ...CacheOption) (*Cache, error) {
+	store, err := NewMemoryStore(maxBytes)
+	if err != nil {
+		return nil, err
+	}
+	return NewCacheWithStore(store, maxEntrySize, opts...)
+}
+
+// NewCacheWithStore is like NewCache, but the compressed responses are held by
+// the specified CacheStore.
+func NewCacheWithStore(store CacheStore, maxEntrySize int, opts ...CacheOption) (*Cache, error) {
+	if store == nil {
+		return nil, errors.New("cache store can not be nil")
+	}
+	if maxEntrySize <= 0 {
+		return nil, fmt.Errorf("cache maximum entry size must be positive: %d", maxEntrySize)
+	}
+	c := &Cache{
+		store:           store,
+		maxEntrySize:    maxEntrySize,
+		coalesceTimeout: DefaultCoalesceTimeout,
+		inflight:        map[string]*flight{},
+	}
+	for _, o := range opts {
+		if err := o(c); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// Stats returns the statistics of the cache.
+func (c *Cache) Stats() CacheStats {
+	ss := c.store.Stats()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return CacheStats{
+		Hits:       c.hits,
+		Misses:     c.misses,
+		Coalesced:  c.coalesced,
+		Timeouts:   c.timeouts,
+		StoreStats: ss,
+	}
+}
+
+func (c *Cache) get(key string) ([]byte, bool) {
+	data, ok := c.store.Get(key)
+	if ok {
+		c.mu.Lock()
+		c.hits++
+		c.mu.Unlock()
+	}
+	return data, ok
+}
+
+func (c *Cache) put(key string, data []byte) {
+	c.mu.Lock()
+	c.misses++
+	c.mu.Unlock()
+	c.store.Put(key, data)
+}
+
+// compress returns the compressed data for key, either from the cache, or by
+// calling compress. Concurrent calls with the same key that are not in the cache
+// wait (up to the coalesce timeout) for the first one to call compress.
+func (c *Cache) compress(key string, compress func() ([]byte, error)) ([]byte, error) {
+	if data, ok := c.get(key); ok {
+		return data, nil
+	}
+	if c.coalesceTimeout == 0 {
+		return c.compressAndPut(key, compress)
+	}
+	c.mu.Lock()
+	if f, ok := c.inflight[key]; ok {
+		c.mu.Unlock()
+		t := time.NewTimer(c.coalesceTimeout)
+		defer t.Stop()
+		select {
+		case <-f.done:
+			if f.err == nil {
+				c.mu.Lock()
+				c.coalesced++
+				c.mu.Unlock()
+				return f.data, nil
+			}
+			// The other compression failed: try on our own.
+		case <-t.C:
+			c.mu.Lock()
+			c.timeouts++
+			c.mu.Unlock()
+		}
+		return c.compressAndPut(key, compress)
+	}
+	f := &flight{done: make(chan struct{}), err: errFlight}
+	c.inflight[key] = f
+	c.mu.Unlock()
+
+	defer func() {
+		// Always wake up the waiters, even if compress panics.
+		c.mu.Lock()
+		delete(c.inflight, key)
+		c.mu.Unlock()
+		close(f.done)
+	}()
+	f.data, f.err = c.compressAndPut(key, compress)
+	return f.data, f.err
+}
+
+var errFlight = errors.New("httpcompression: concurrent compression did not complete")
+
+func (c *Cache) compressAndPut(key string, compress func() ([]byte, error)) ([]byte, error) {
+	data, err := compress()
+	if err != nil {
+		return nil, err
+	}
+	c.put(key, data)
+	return data, nil
+}
+
+// ResponseCache is an option that sets the Cache used to store compressed responses.
+// If cache is nil (the default), responses are not cached.
+func ResponseCache(cache *Cache) Option {
+	return func(c *config) error {
+		c.cache = cache
+		return nil
+	}
+}
+
+// cacheProbe is the payload compressed to compute the fingerprint of compressors.
+var cacheProbe = []byte(strings.Repeat(`{"id":1234,"name":"httpcompression","tags":["gzip","br","zstd"],"value":0.5}`, 64))
+
+// compressorFingerprint returns a string that identifies the configuration of the
+// compressor, so that compressors using different levels, dictionaries, etc. do not
+// share cache entries. It is derived from the type of the compressor and from its
+// output when compressing a probe payload.
+func compressorFingerprint(comp CompressorProvider) (string, error) {
+	var buf bytes.Buffer
+	cw := comp.Get(&buf)
+	_, err := cw.Write(cacheProbe)
+	if cerr := cw.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%T\x00", comp)
+	h.Write(buf.Bytes())
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// cacheKey returns the cache key derived from the specified parts.
+func cacheKey(parts ...string) string {
+	h := sha256.New()
+	for _, p := range parts {
+		io.WriteString(h, p)
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// cachingWriter is the compressor used by compressWriter when a Cache is configured.
+// It buffers the uncompressed body until Close, so that the compressed body can be
+// looked up in the cache (or compressed and added to the cache).
+type cachingWriter struct {
+	parent io.Writer
+	comp   CompressorProvider
+	cache  *Cache
+	prefix string // encoding and compressor fingerprint
+	key    string // cache key, if known in advance (i.e. derived from the ETag)
+
+	buf []byte
+	cw  io.WriteCloser // compressor, if the body is not going to be cached
+	hit []byte         // cached body, if known in advance
+}
+
+var (
+	_ io.WriteCloser = &cachingWriter{}
+	_ Flusher        = &cachingWriter{}
+)
+
+func (w *cachingWriter) Write(b []byte) (int, error) {
+	switch {
+	case w.hit != nil:
+		// The body is going to be served from the cache.
+		return len(b), nil
+	case w.cw != nil:
+		return w.cw.Write(b)
+	case len(w.buf)+len(b) > w.cache.maxEntrySize:
+		if err := w.stream(); err != nil {
+			return 0, err
+		}
+		return w.cw.Write(b)
+	}
+	w.buf = append(w.buf, b...)
+	return len(b), nil
+}
+
+// stream gives up caching: the buffered data is passed to the compressor.
+func (w *cachingWriter) stream() error {
+	w.cw = w.comp.Get(w.parent)
+	buf := w.buf
+	w.buf = nil
+	_, err := w.cw.Write(buf)
+	return err
+}
+
+func (w *cachingWriter) Flush() error {
+	if w.hit != nil {
+		return nil
+	}
+	if w.cw == nil {
+		// A flushed response is not cached, as the handler wants the client
+		// to receive the data written so far.
+		if err := w.stream(); err != nil {
+			return err
+		}
+	}
+	if fw, ok := w.cw.(Flusher); ok {
+		return fw.Flush()
+	}
+	return nil
+}
+
+func (w *cachingWriter) Close() error {
+	if w.hit != nil {
+		_, err := w.parent.Write(w.hit)
+		return err
+	}
+	if w.cw != nil {
+		return w.cw.Close()
+	}
+
+	key := w.key
+	if key == "" {
+		sum := sha256.Sum256(w.buf)
+		key = cacheKey(w.prefix, "body", string(sum[:]))
+	}
+	data, err := w.cache.compress(key, func() ([]byte, error) {
+		var cbuf bytes.Buffer
+		cw := w.comp.Get(&cbuf)
+		_, err := cw.Write(w.buf)
+		if cerr := cw.Close(); err == nil {
+			err = cerr
+		}
+		return cbuf.Bytes(), err
+	})
+	if err != nil {
+		return err
+	}
+	_, err = w.parent.Write(data)
+	return err
+}
+
+// newCachingWriter returns the cachingWriter for the response being written by cw.
+func (cw *compressWriter) newCachingWriter(enc string, comp comp, parent io.Writer) *cachingWriter {
+	w := &cachingWriter{
+		parent: parent,
+		comp:   comp.comp,
+		cache:  cw.config.cache,
+		prefix: enc + "\x00" + comp.fingerprint,
+	}
+	if et := cw.Header().Get(etag); et != "" && !strings.HasPrefix(et, "W/") {
+		r := cw.request
+		w.key = cacheKey(w.prefix, "etag", r.Host, r.URL.RequestURI(), et)
+		if data, ok := w.cache.get(w.key); ok {
+			w.hit = data
+		}
+	}
+	return w
+}
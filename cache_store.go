@@ -0,0 +1,153 @@
+package httpcompression
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+)
+
+// CacheStore stores the compressed responses of a Cache.
+// Keys are lowercase hexadecimal strings. Values must not be modified after they
+// have been passed to Put or returned by Get.
+// Implementations must be safe for concurrent use.
+type CacheStore interface {
+	// Get returns the value stored for key, if any.
+	Get(key string) (value []byte, ok bool)
+	// Put stores value for key. Implementations are allowed to discard the value,
+	// e.g. if it is too large, or to evict other values to make room for it.
+	Put(key string, value []byte)
+	// Stats returns the statistics of the store.
+	Stats() StoreStats
+}
+
+// StoreStats are the statistics of a CacheStore.
+type StoreStats struct {
+	Evictions uint64 // Number of entries evicted from the store.
+	Entries   int    // Number of entries in the store.
+	Bytes     int64  // Size of the entries in the store.
+}
+
+// MemoryStore is a CacheStore that holds the values in memory, up to a maximum
+// size, evicting the least recently used ones when full.
+type MemoryStore struct {
+	mu        sync.Mutex
+	maxBytes  int64
+	size      int64
+	lru       *list.List // of *cacheEntry; front is most recently used
+	entries   map[string]*list.Element
+	evictions uint64
+}
+
+type cacheEntry struct {
+	key  string
+	data []byte
+}
+
+var _ CacheStore = &MemoryStore{}
+
+// NewMemoryStore returns a MemoryStore that holds up to maxBytes bytes.
+func NewMemoryStore(maxBytes int64) (*MemoryStore, error) {
+	if maxBytes <= 0 {
+		return nil, fmt.Errorf("cache size must be positive: %d", maxBytes)
+	}
+	return &MemoryStore{
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		entries:  map[string]*list.Element{},
+	}, nil
+}
+
+// Get implements CacheStore.
+func (s *MemoryStore) Get(key string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[key]
+	if !ok {
+		return nil, false
+	}
+	s.lru.MoveToFront(e)
+	return e.Value.(*cacheEntry).data, true
+}
+
+// Put implements CacheStore.
+func (s *MemoryStore) Put(key string, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if int64(len(data)) > s.maxBytes {
+		return
+	}
+	if e, ok := s.entries[key]; ok {
+		// Another response with the same key was added concurrently.
+		s.lru.MoveToFront(e)
+		return
+	}
+	s.entries[key] = s.lru.PushFront(&cacheEntry{key, data})
+	s.size += int64(len(data))
+	for s.size > s.maxBytes {
+		e := s.lru.Back()
+		ce := e.Value.(*cacheEntry)
+		s.lru.Remove(e)
+		delete(s.entries, ce.key)
+		s.size -= int64(len(ce.data))
+		s.evictions++
+	}
+}
+
+// Stats implements CacheStore.
+func (s *MemoryStore) Stats() StoreStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return StoreStats{
+		Evictions: s.evictions,
+		Entries:   s.lru.Len(),
+		Bytes:     s.size,
+	}
+}
+
+// TieredStore is a CacheStore that combines multiple stores, normally ordered
+// from the fastest and smallest (e.g. a MemoryStore) to the slowest and largest
+// (e.g. a DiskStore).
+// Values are added to all stores. Values found in one of the stores are also added
+// to the preceding ones.
+type TieredStore struct {
+	stores []CacheStore
+}
+
+var _ CacheStore = &TieredStore{}
+
+// NewTieredStore returns a TieredStore that combines the specified stores.
+func NewTieredStore(stores ...CacheStore) *TieredStore {
+	return &TieredStore{stores: append([]CacheStore(nil), stores...)}
+}
+
+// Get implements CacheStore.
+func (s *TieredStore) Get(key string) ([]byte, bool) {
+	for i, st := range s.stores {
+		if data, ok := st.Get(key); ok {
+			for _, prev := range s.stores[:i] {
+				prev.Put(key, data)
+			}
+			return data, true
+		}
+	}
+	return nil, false
+}
+
+// Put implements CacheStore.
+func (s *TieredStore) Put(key string, data []byte) {
+	for _, st := range s.stores {
+		st.Put(key, data)
+	}
+}
+
+// Stats implements CacheStore. It returns the sum of the statistics of all stores.
+func (s *TieredStore) Stats() StoreStats {
+	var ss StoreStats
+	for _, st := range s.stores {
+		t := st.Stats()
+		ss.Evictions += t.Evictions
+		ss.Entries += t.Entries
+		ss.Bytes += t.Bytes
+	}
+	return ss
+}
@@ -0,0 +1,196 @@
+package httpcompression
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testStore(t *testing.T, s CacheStore) {
+	_, ok := s.Get("aa00")
+	assert.False(t, ok)
+
+	s.Put("aa00", []byte("0123456789"))
+	s.Put("aa01", []byte("0123456789"))
+	s.Put("bb00", []byte("0123456789"))
+	v, ok := s.Get("aa00") // aa01 is now the least recently used
+	assert.True(t, ok)
+	assert.Equal(t, []byte("0123456789"), v)
+	assert.Equal(t, StoreStats{Entries: 3, Bytes: 30}, s.Stats())
+
+	s.Put("cc00", []byte("0123456789"))
+	_, ok = s.Get("aa01")
+	assert.False(t, ok)
+	for _, k := range []string{"aa00", "bb00", "cc00"} {
+		_, ok = s.Get(k)
+		assert.True(t, ok, k)
+	}
+	assert.Equal(t, StoreStats{Evictions: 1, Entries: 3, Bytes: 30}, s.Stats())
+
+	// Too large.
+	s.Put("dd00", bytes.Repeat([]byte("x"), 31))
+	_, ok = s.Get("dd00")
+	assert.False(t, ok)
+}
+
+func TestMemoryStore(t *testing.T) {
+	t.Parallel()
+
+	s, err := NewMemoryStore(30)
+	assert.Nil(t, err)
+	testStore(t, s)
+}
+
+func TestDiskStore(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	s, err := NewDiskStore(dir, 30)
+	assert.Nil(t, err)
+	testStore(t, s)
+
+	// Invalid keys are ignored.
+	s.Put("../x", []byte("x"))
+	_, ok := s.Get("../x")
+	assert.False(t, ok)
+
+	// No temporary files are left behind.
+	var files []string
+	filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if fi.Mode().IsRegular() {
+			rel, _ := filepath.Rel(dir, path)
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	assert.ElementsMatch(t, []string{"aa/aa00", "bb/bb00", "cc/cc00"}, files)
+	assertPerm(t, filepath.Join(dir, "aa", "aa00"), 0600)
+	assertPerm(t, filepath.Join(dir, "aa"), 0700)
+
+	// The entries survive a restart.
+	s2, err := NewDiskStore(dir, 30)
+	assert.Nil(t, err)
+	assert.Equal(t, StoreStats{Entries: 3, Bytes: 30}, s2.Stats())
+	v, ok := s2.Get("cc00")
+	assert.True(t, ok)
+	assert.Equal(t, []byte("0123456789"), v)
+
+	// Entries added by another process are visible.
+	s.Put("ee00", []byte("01234"))
+	v, ok = s2.Get("ee00")
+	assert.True(t, ok)
+	assert.Equal(t, []byte("01234"), v)
+
+	// A smaller limit evicts the least recently used entries on startup.
+	old := time.Now().Add(-time.Hour)
+	for _, f := range []string{"aa/aa00", "bb/bb00", "cc/cc00"} {
+		os.Chtimes(filepath.Join(dir, filepath.FromSlash(f)), old, old)
+	}
+	s3, err := NewDiskStore(dir, 14)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, s3.Stats().Entries)
+	_, err = os.Stat(filepath.Join(dir, "ee", "ee00"))
+	assert.Nil(t, err)
+
+	// The stale temporary files left behind by a crash are removed on startup,
+	// the recent ones may still be in use by another process.
+	stale, recent := filepath.Join(dir, "ee", ".tmp-1"), filepath.Join(dir, "ee", ".tmp-2")
+	assert.Nil(t, ioutil.WriteFile(stale, []byte("x"), 0644))
+	assert.Nil(t, ioutil.WriteFile(recent, []byte("x"), 0644))
+	old = time.Now().Add(-2 * time.Hour)
+	assert.Nil(t, os.Chtimes(stale, old, old))
+	_, err = NewDiskStore(dir, 14)
+	assert.Nil(t, err)
+	_, err = os.Stat(stale)
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(recent)
+	assert.Nil(t, err)
+}
+
+func TestDiskStorePerm(t *testing.T) {
+	t.Parallel()
+
+	dir := filepath.Join(t.TempDir(), "cache")
+	s, err := NewDiskStoreWithPerm(dir, 30, 0640)
+	assert.Nil(t, err)
+	s.Put("aa00", []byte("0123456789"))
+	assertPerm(t, filepath.Join(dir, "aa", "aa00"), 0640)
+	assertPerm(t, filepath.Join(dir, "aa"), 0750)
+	assertPerm(t, dir, 0750)
+
+	for _, perm := range []os.FileMode{0, 0400, 0700, 0666 | os.ModeSetuid} {
+		_, err = NewDiskStoreWithPerm(dir, 30, perm)
+		assert.NotNil(t, err, "%v", perm)
+	}
+}
+
+func assertPerm(t *testing.T, path string, perm os.FileMode) {
+	t.Helper()
+	fi, err := os.Stat(path)
+	if assert.Nil(t, err) && runtime.GOOS != "windows" {
+		assert.Equal(t, perm, fi.Mode().Perm(), path)
+	}
+}
+
+func TestTieredStore(t *testing.T) {
+	t.Parallel()
+
+	mem, err := NewMemoryStore(10)
+	assert.Nil(t, err)
+	disk, err := NewDiskStore(t.TempDir(), 100)
+	assert.Nil(t, err)
+	s := NewTieredStore(mem, disk)
+
+	s.Put("aa00", []byte("0123456789"))
+	s.Put("bb00", []byte("0123456789")) // evicts aa00 from mem
+	assert.Equal(t, StoreStats{Entries: 1, Bytes: 10, Evictions: 1}, mem.Stats())
+	assert.Equal(t, StoreStats{Entries: 2, Bytes: 20}, disk.Stats())
+
+	v, ok := s.Get("aa00") // promoted to mem
+	assert.True(t, ok)
+	assert.Equal(t, []byte("0123456789"), v)
+	_, ok = mem.Get("aa00")
+	assert.True(t, ok)
+	assert.Equal(t, StoreStats{Entries: 3, Bytes: 30, Evictions: 2}, s.Stats())
+}
+
+func TestCacheDiskStore(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, strings.Repeat(testBody, 2))
+	})
+	var body []byte
+	for i := 0; i < 2; i++ {
+		// Simulate a restart by creating a new store and middleware.
+		store, err := NewDiskStore(dir, 1<<20)
+		assert.Nil(t, err)
+		cache, err := NewCacheWithStore(store, 1<<20)
+		assert.Nil(t, err)
+		mw, err := DefaultAdapter(ResponseCache(cache))
+		assert.Nil(t, err)
+
+		w := cacheGet(mw(handler), "/", "zstd")
+		assert.Equal(t, "zstd", w.Header().Get(contentEncoding))
+		if i == 0 {
+			body = w.Body.Bytes()
+			assert.Equal(t, uint64(1), cache.Stats().Misses)
+		} else {
+			assert.Equal(t, body, w.Body.Bytes())
+			assert.Equal(t, uint64(1), cache.Stats().Hits)
+		}
+	}
+
+	_, err := NewCacheWithStore(nil, 1)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,264 @@
+package httpcompression
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// countingCompressor counts the compressors returned by Get.
+type countingCompressor struct {
+	CompressorProvider
+	n int64
+}
+
+func (c *countingCompressor) Get(w io.Writer) io.WriteCloser {
+	atomic.AddInt64(&c.n, 1)
+	return c.CompressorProvider.Get(w)
+}
+
+func newCountingGzip(t *testing.T, level int) *countingCompressor {
+	gz, err := NewDefaultGzipCompressor(level)
+	assert.Nil(t, err)
+	return &countingCompressor{CompressorProvider: gz}
+}
+
+func cacheGet(h http.Handler, path, ae string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, path, nil)
+	r.Header.Set(acceptEncoding, ae)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestCache(t *testing.T) {
+	t.Parallel()
+
+	cache, err := NewCache(1<<20, 1<<16)
+	assert.Nil(t, err)
+	comp := newCountingGzip(t, gzip.DefaultCompression)
+	mw, err := Adapter(GzipCompressor(comp), ResponseCache(cache))
+	assert.Nil(t, err)
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, strings.Repeat(r.URL.Query().Get("body"), 100))
+	}))
+	base := atomic.LoadInt64(&comp.n) // the fingerprint is computed when the adapter is created
+
+	first := cacheGet(h, "/?body=a", "gzip")
+	assert.Equal(t, "gzip", first.Header().Get(contentEncoding))
+	assert.Equal(t, gzipStrLevel(strings.Repeat("a", 100), gzip.DefaultCompression), first.Body.Bytes())
+	assert.Equal(t, base+1, atomic.LoadInt64(&comp.n))
+
+	// Same body, different URL: served from the cache.
+	second := cacheGet(h, "/?body=a&x=1", "gzip")
+	assert.Equal(t, first.Body.Bytes(), second.Body.Bytes())
+	assert.Equal(t, base+1, atomic.LoadInt64(&comp.n))
+
+	// Different body.
+	third := cacheGet(h, "/?body=b", "gzip")
+	assert.Equal(t, gzipStrLevel(strings.Repeat("b", 100), gzip.DefaultCompression), third.Body.Bytes())
+	assert.Equal(t, base+2, atomic.LoadInt64(&comp.n))
+
+	// Uncompressed responses are not cached.
+	cacheGet(h, "/?body=a", "")
+
+	assert.Equal(t, CacheStats{Hits: 1, Misses: 2, StoreStats: StoreStats{Entries: 2, Bytes: int64(first.Body.Len() + third.Body.Len())}}, cache.Stats())
+}
+
+func TestCacheCompressorConfig(t *testing.T) {
+	t.Parallel()
+
+	cache, err := NewCache(1<<20, 1<<16)
+	assert.Nil(t, err)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, testBody)
+	})
+	for _, level := range []int{1, 9, 1} {
+		mw, err := Adapter(GzipCompressionLevel(level), ResponseCache(cache))
+		assert.Nil(t, err)
+		w := cacheGet(mw(handler), "/", "gzip")
+		assert.Equal(t, gzipStrLevel(testBody, level), w.Body.Bytes())
+	}
+	assert.Equal(t, CacheStats{Hits: 1, Misses: 2, StoreStats: StoreStats{Entries: 2, Bytes: cache.Stats().Bytes}}, cache.Stats())
+}
+
+func TestCacheETag(t *testing.T) {
+	t.Parallel()
+
+	cache, err := NewCache(1<<20, 1<<16)
+	assert.Nil(t, err)
+	mw, err := DefaultAdapter(ResponseCache(cache))
+	assert.Nil(t, err)
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(etag, r.URL.Query().Get("etag"))
+		io.WriteString(w, strings.Repeat(r.URL.Query().Get("body"), 300))
+	}))
+
+	first := cacheGet(h, `/?etag="1"&body=a`, "br")
+	// Same strong ETag and URL: the body written by the handler is ignored.
+	second := cacheGet(h, `/?etag="1"&body=a`, "br")
+	assert.Equal(t, first.Body.Bytes(), second.Body.Bytes())
+	assert.Equal(t, uint64(1), cache.Stats().Hits)
+	// Same ETag, different URL.
+	cacheGet(h, `/?etag="1"&body=b`, "br")
+	// Weak ETags are ignored, and the body is hashed instead.
+	cacheGet(h, `/?etag=W/"1"&body=b`, "br")
+	cacheGet(h, `/?etag=W/"2"&body=b`, "br")
+	assert.Equal(t, CacheStats{Hits: 2, Misses: 3, StoreStats: StoreStats{Entries: 3, Bytes: cache.Stats().Bytes}}, cache.Stats())
+}
+
+func TestCacheUncacheable(t *testing.T) {
+	t.Parallel()
+
+	cache, err := NewCache(1<<20, 1000)
+	assert.Nil(t, err)
+	mw, err := DefaultAdapter(ResponseCache(cache))
+	assert.Nil(t, err)
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/large":
+			io.WriteString(w, testBody)
+		case "/flush":
+			io.WriteString(w, testBody[:500])
+			w.(http.Flusher).Flush()
+			io.WriteString(w, testBody[500:900])
+		}
+	}))
+
+	for i := 0; i < 2; i++ {
+		w := cacheGet(h, "/large", "gzip")
+		b, err := decodeGzip(w.Body)
+		assert.Nil(t, err)
+		assert.Equal(t, testBody, string(b))
+
+		w = cacheGet(h, "/flush", "gzip")
+		b, err = decodeGzip(w.Body)
+		assert.Nil(t, err)
+		assert.Equal(t, testBody[:900], string(b))
+	}
+	assert.Equal(t, CacheStats{}, cache.Stats())
+}
+
+func TestCacheEviction(t *testing.T) {
+	t.Parallel()
+
+	// All responses have the same compressed size, and only 3 fit.
+	size := len(gzipStrLevel(strings.Repeat("/a", 100), gzip.DefaultCompression))
+	cache, err := NewCache(int64(3*size), 1<<16)
+	assert.Nil(t, err)
+	mw, err := Adapter(GzipCompressionLevel(gzip.DefaultCompression), ResponseCache(cache))
+	assert.Nil(t, err)
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, strings.Repeat(r.URL.Path, 100))
+	}))
+
+	for _, p := range []string{"/a", "/b", "/c", "/a", "/d", "/b"} {
+		cacheGet(h, p, "gzip")
+	}
+	s := cache.Stats()
+	assert.Equal(t, uint64(1), s.Hits)   // "/a"
+	assert.Equal(t, uint64(5), s.Misses) // "/b" was evicted by "/d"
+	assert.Equal(t, uint64(2), s.Evictions)
+	assert.Equal(t, 3, s.Entries)
+	assert.Equal(t, int64(3*size), s.Bytes)
+
+	_, err = NewCache(0, 1)
+	assert.NotNil(t, err)
+}
+
+// blockingCompressor blocks the compressions (after the one used to compute the
+// fingerprint) until release is closed.
+type blockingCompressor struct {
+	countingCompressor
+	release chan struct{}
+}
+
+func (c *blockingCompressor) Get(w io.Writer) io.WriteCloser {
+	if atomic.AddInt64(&c.n, 1) > 1 {
+		<-c.release
+	}
+	return c.CompressorProvider.Get(w)
+}
+
+// coalescing returns the number of goroutines waiting in Cache.compress for a
+// concurrent compression to complete.
+func coalescing() int {
+	buf := make([]byte, 1<<20)
+	buf = buf[:runtime.Stack(buf, true)]
+	n := 0
+	for _, g := range strings.Split(string(buf), "\n\n") {
+		if strings.Contains(g, ".(*Cache).compress(") && !strings.Contains(g, ".(*Cache).compressAndPut(") {
+			n++
+		}
+	}
+	return n
+}
+
+// waitFor waits until cond returns true.
+func waitFor(cond func() bool) {
+	for !cond() {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// TestCacheCoalesce is not parallel, so that coalescing counts only its goroutines.
+func TestCacheCoalesce(t *testing.T) {
+
+	for _, timeout := range []time.Duration{time.Hour, time.Millisecond} {
+		cache, err := NewCache(1<<20, 1<<16, CoalesceTimeout(timeout))
+		assert.Nil(t, err)
+		comp := &blockingCompressor{*newCountingGzip(t, gzip.DefaultCompression), make(chan struct{})}
+		mw, err := Adapter(GzipCompressor(comp), ResponseCache(cache))
+		assert.Nil(t, err)
+		h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, testBody)
+		}))
+
+		const n = 10
+		var wg sync.WaitGroup
+		res := make([]*httptest.ResponseRecorder, n)
+		get := func(i int) {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				res[i] = cacheGet(h, "/", "gzip")
+			}()
+		}
+		// The first response is being compressed when the others start.
+		get(0)
+		waitFor(func() bool { return atomic.LoadInt64(&comp.n) == 2 })
+		for i := 1; i < n; i++ {
+			get(i)
+		}
+		if timeout == time.Hour {
+			// All the other responses wait for the first one.
+			waitFor(func() bool { return coalescing() == n-1 })
+		} else {
+			// All the other responses time out, and are being compressed on their own.
+			waitFor(func() bool { return atomic.LoadInt64(&comp.n) == n+1 })
+		}
+		close(comp.release)
+		wg.Wait()
+
+		for _, w := range res {
+			assert.Equal(t, gzipStrLevel(testBody, gzip.DefaultCompression), w.Body.Bytes())
+		}
+		s := cache.Stats()
+		if timeout == time.Hour {
+			assert.Equal(t, int64(2), atomic.LoadInt64(&comp.n))
+			assert.Equal(t, CacheStats{Misses: 1, Coalesced: n - 1, StoreStats: StoreStats{Entries: 1, Bytes: s.Bytes}}, s)
+		} else {
+			assert.Equal(t, int64(n+1), atomic.LoadInt64(&comp.n))
+			assert.Equal(t, CacheStats{Misses: n, Timeouts: n - 1, StoreStats: StoreStats{Entries: 1, Bytes: s.Bytes}}, s)
+		}
+	}
+}
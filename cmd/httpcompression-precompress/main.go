@@ -0,0 +1,97 @@
+// Command httpcompression-precompress writes precompressed siblings (e.g. style.css.br,
+// style.css.zst and style.css.gz for style.css) of the files in a directory, to be
+// served by httpcompression.FileServer.
+//
+// Usage:
+//
+//	httpcompression-precompress [flags] dir...
+//
+// Files are selected using the same rules used by the middleware to decide whether to
+// compress a response (see -min-size, -types and -exclude-types). Compressed files that
+// are not smaller than the original are not written. Siblings have the same modification
+// time as the original file.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/CAFxX/httpcompression"
+	"github.com/CAFxX/httpcompression/contrib/andybalholm/brotli"
+	"github.com/CAFxX/httpcompression/contrib/klauspost/zstd"
+
+	kpzstd "github.com/klauspost/compress/zstd"
+)
+
+func main() {
+	var (
+		gzipLevel   = flag.Int("gzip", 9, "gzip compression level (1-9); 0 disables gzip")
+		brotliLevel = flag.Int("brotli", 11, "brotli quality (0-11); -1 disables brotli")
+		zstdLevel   = flag.Int("zstd", 19, "zstd compression level (1-22); 0 disables zstd")
+		minSize     = flag.Int("min-size", httpcompression.DefaultMinSize, "minimum size of the files to compress")
+		types       = flag.String("types", "", "comma-separated list of content types to compress (default: all)")
+		exclude     = flag.Bool("exclude-types", false, "compress all content types except the ones listed in -types")
+		verbose     = flag.Bool("v", false, "print the outcome for each file")
+	)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] dir...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	opts := []httpcompression.Option{
+		httpcompression.MinSize(*minSize),
+	}
+	if *gzipLevel != 0 {
+		opts = append(opts, httpcompression.GzipCompressionLevel(*gzipLevel))
+	}
+	if *brotliLevel >= 0 {
+		c, err := brotli.New(brotli.Options{Quality: *brotliLevel, LGWin: 24})
+		if err != nil {
+			fatalf("brotli: %v", err)
+		}
+		opts = append(opts, httpcompression.BrotliCompressor(c))
+	}
+	if *zstdLevel != 0 {
+		c, err := zstd.New(kpzstd.WithEncoderLevel(kpzstd.EncoderLevelFromZstd(*zstdLevel)))
+		if err != nil {
+			fatalf("zstd: %v", err)
+		}
+		opts = append(opts, httpcompression.ZstandardCompressor(c))
+	}
+	if *types != "" {
+		opts = append(opts, httpcompression.ContentTypes(strings.Split(*types, ","), *exclude))
+	}
+
+	failed := false
+	for _, dir := range flag.Args() {
+		files, err := httpcompression.PrecompressDir(dir, opts...)
+		if *verbose {
+			for _, f := range files {
+				status := "written"
+				if !f.Written {
+					status = "skipped (not smaller)"
+				}
+				fmt.Printf("%s\t%s\t%d -> %d\t%s\n", f.Path, f.Encoding, f.Size, f.CompressedSize, status)
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", dir, err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(2)
+}
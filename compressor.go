@@ -1,7 +1,9 @@
 package httpcompression
 
 import (
+	"fmt"
 	"io"
+	"mime"
 )
 
 // CompressorProvider is the interface for compression implementations.
@@ -37,7 +39,71 @@ func Compressor(contentEncoding string, priority int, compressor CompressorProvi
 			delete(c.compressor, contentEncoding)
 			return nil
 		}
-		c.compressor[contentEncoding] = comp{compressor, priority}
+		c.compressor[contentEncoding] = comp{comp: compressor, priority: priority}
 		return nil
 	}
 }
+
+// ContentTypeCompressor returns an Option that sets the CompressorProvider used for a specific
+// Content-Encoding when the Content-Type of the response matches one of contentTypes, that are
+// compared to the Content-Type like in ContentTypes. This allows e.g. to compress the JSON
+// responses with a zstd dictionary built for them, and the other responses without.
+// The Content-Encoding must be enabled with Compressor, that also sets its priority and the
+// CompressorProvider used for the other responses: the Content-Encoding is negotiated before
+// the Content-Type of the response is known.
+// If the CompressorProviders set for multiple calls match a response, the last one is used.
+func ContentTypeCompressor(contentEncoding string, contentTypes []string, compressor CompressorProvider) Option {
+	if compressor == nil {
+		return errorOption(fmt.Errorf("nil content type compressor for %q", contentEncoding))
+	}
+	return contentTypeComp(contentEncoding, contentTypes, comp{comp: compressor})
+}
+
+// contentTypeCompressor overrides the compressor of an encoding for some content types.
+type contentTypeCompressor struct {
+	encoding     string
+	contentTypes []parsedContentType
+	comp         comp
+}
+
+func contentTypeComp(encoding string, contentTypes []string, cc comp) Option {
+	return func(c *config) error {
+		parsed, err := parseContentTypes(contentTypes)
+		if err != nil {
+			return err
+		}
+		c.contentTypeCompressors = append(c.contentTypeCompressors, contentTypeCompressor{
+			encoding:     encoding,
+			contentTypes: parsed,
+			comp:         cc,
+		})
+		return nil
+	}
+}
+
+// compressorFor returns the compressor to be used for the encoding enc and the
+// Content-Type ct, and whether the encoding is enabled.
+func (c *config) compressorFor(enc, ct string) (comp, bool) {
+	cc, ok := c.compressor[enc]
+	if !ok || len(c.contentTypeCompressors) == 0 || ct == "" {
+		return cc, ok
+	}
+	mediaType, params, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return cc, ok
+	}
+	for i := len(c.contentTypeCompressors) - 1; i >= 0; i-- {
+		ctc := &c.contentTypeCompressors[i]
+		if ctc.encoding != enc {
+			continue
+		}
+		for _, pct := range ctc.contentTypes {
+			if pct.equals(mediaType, params) {
+				o := ctc.comp
+				o.priority = cc.priority
+				return o, true
+			}
+		}
+	}
+	return cc, ok
+}
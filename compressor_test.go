@@ -0,0 +1,92 @@
+package httpcompression
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/CAFxX/httpcompression/contrib/klauspost/zstd"
+	"github.com/CAFxX/httpcompression/dictionary"
+	kpzstd "github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContentTypeCompressor(t *testing.T) {
+	t.Parallel()
+
+	const dictID = 1234
+	dict := []byte(testBody)
+	jsonComp, err := zstd.New(kpzstd.WithEncoderDictRaw(dictID, dict))
+	assert.NoError(t, err)
+	plain, err := kpzstd.NewReader(nil)
+	assert.NoError(t, err)
+	defer plain.Close()
+	withDict, err := kpzstd.NewReader(nil, kpzstd.WithDecoderDictRaw(dictID, dict))
+	assert.NoError(t, err)
+	defer withDict.Close()
+
+	cache, err := NewCache(1<<20, 1<<16)
+	assert.NoError(t, err)
+	for name, opts := range map[string][]Option{
+		"no cache": nil,
+		"cache":    {ResponseCache(cache)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			mw, err := DefaultAdapter(append(opts, ContentTypeCompressor(zstd.Encoding, []string{"application/json"}, jsonComp))...)
+			assert.NoError(t, err)
+			h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set(contentType, r.Header.Get("X-Type"))
+				w.Header().Set("ETag", `"v1"`)
+				w.Write([]byte(testBody))
+			}))
+
+			for ct, usesDict := range map[string]bool{
+				"application/json":                true,
+				"application/json; charset=utf-8": true,
+				"text/plain":                      false,
+			} {
+				r := httptest.NewRequest(http.MethodGet, "/", nil)
+				r.Header.Set(acceptEncoding, "zstd")
+				r.Header.Set("X-Type", ct)
+				w := httptest.NewRecorder()
+				h.ServeHTTP(w, r)
+				assert.Equal(t, zstd.Encoding, w.Header().Get(contentEncoding))
+
+				body, err := withDict.DecodeAll(w.Body.Bytes(), nil)
+				assert.NoError(t, err, ct)
+				assert.Equal(t, testBody, string(body), ct)
+				_, err = plain.DecodeAll(w.Body.Bytes(), nil)
+				assert.Equal(t, usesDict, err != nil, ct)
+			}
+		})
+	}
+}
+
+func TestContentTypeCompressorOptions(t *testing.T) {
+	t.Parallel()
+
+	comp, err := zstd.New()
+	assert.NoError(t, err)
+	dc, err := zstd.NewDictionary()
+	assert.NoError(t, err)
+	cases := map[string][]Option{
+		"nil":          {ContentTypeCompressor(zstd.Encoding, []string{"text/html"}, nil)},
+		"invalid type": {ContentTypeCompressor(zstd.Encoding, []string{"text/"}, comp)},
+		"disabled":     {ContentTypeCompressor("lz4", []string{"text/html"}, comp)},
+		"mixed":        {ContentTypeDictionaryCompressor(zstd.Encoding, []string{"text/html"}, dc)},
+		"mixed dictionary": {
+			DictionaryCompressor(dictionary.Zstd, 1000, dc),
+			ContentTypeCompressor(dictionary.Zstd, []string{"text/html"}, comp),
+		},
+	}
+	for name, opts := range cases {
+		_, err := DefaultAdapter(opts...)
+		assert.Error(t, err, name)
+	}
+
+	_, err = DefaultAdapter(
+		DictionaryCompressor(dictionary.Zstd, 1000, dc),
+		ContentTypeDictionaryCompressor(dictionary.Zstd, []string{"text/html"}, dc),
+	)
+	assert.NoError(t, err)
+}
@@ -30,19 +30,28 @@ import "mime"
 // By default, responses are compressed regardless of Content-Type.
 func ContentTypes(types []string, blacklist bool) Option {
 	return func(c *config) error {
-		c.contentTypes = []parsedContentType{}
-		for _, v := range types {
-			mediaType, params, err := mime.ParseMediaType(v)
-			if err != nil {
-				return err
-			}
-			c.contentTypes = append(c.contentTypes, parsedContentType{mediaType, params})
+		parsed, err := parseContentTypes(types)
+		if err != nil {
+			return err
 		}
+		c.contentTypes = parsed
 		c.blacklist = blacklist
 		return nil
 	}
 }
 
+func parseContentTypes(types []string) ([]parsedContentType, error) {
+	parsed := []parsedContentType{}
+	for _, v := range types {
+		mediaType, params, err := mime.ParseMediaType(v)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, parsedContentType{mediaType, params})
+	}
+	return parsed, nil
+}
+
 // Parsed representation of one of the inputs to ContentTypes.
 // See https://golang.org/pkg/mime/#ParseMediaType
 type parsedContentType struct {
@@ -60,3 +60,36 @@ func (w *writer) Close() error {
 	w.c.pool.Put(w)
 	return err
 }
+
+type decompressor struct {
+	pool sync.Pool
+}
+
+func NewDecompressor() (*decompressor, error) {
+	return &decompressor{}, nil
+}
+
+func (d *decompressor) Get(r io.Reader) io.ReadCloser {
+	if br, ok := d.pool.Get().(*reader); ok {
+		if err := br.Reset(r); err != nil {
+			d.pool.Put(br)
+			return utils.ErrorReadCloser{Err: err}
+		}
+		return br
+	}
+	return &reader{
+		Reader: brotli.NewReader(r),
+		d:      d,
+	}
+}
+
+type reader struct {
+	*brotli.Reader
+	d *decompressor
+}
+
+func (r *reader) Close() error {
+	r.Reset(nil)
+	r.d.pool.Put(r)
+	return nil
+}
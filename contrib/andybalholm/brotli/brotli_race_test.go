@@ -14,3 +14,10 @@ func TestZstdRace(t *testing.T) {
 	c, _ := brotli.New(brotli.Options{})
 	internal.RaceTestCompressionProvider(c, 100)
 }
+
+func TestBrotliDecompressorRace(t *testing.T) {
+	t.Parallel()
+	c, _ := brotli.New(brotli.Options{})
+	d, _ := brotli.NewDecompressor()
+	internal.RaceTestDecompressionProvider(c, d, 100)
+}
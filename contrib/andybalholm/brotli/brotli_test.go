@@ -7,11 +7,13 @@ import (
 
 	"github.com/CAFxX/httpcompression"
 	"github.com/CAFxX/httpcompression/contrib/andybalholm/brotli"
+	"github.com/CAFxX/httpcompression/contrib/internal"
 
 	_brotli "github.com/andybalholm/brotli"
 )
 
 var _ httpcompression.CompressorProvider = &brotli.Compressor{}
+var _ httpcompression.DecompressorProvider = &brotli.Decompressor{}
 
 func TestBrotli(t *testing.T) {
 	t.Parallel()
@@ -36,3 +38,19 @@ func TestBrotli(t *testing.T) {
 		t.Fatalf("decoded string mismatch\ngot: %q\nexp: %q", string(s), string(d))
 	}
 }
+
+func TestBrotliDecompressor(t *testing.T) {
+	t.Parallel()
+
+	c, err := brotli.New(brotli.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := brotli.NewDecompressor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := internal.RoundTrip(c, d, []byte("hello world!")); err != nil {
+		t.Fatal(err)
+	}
+}
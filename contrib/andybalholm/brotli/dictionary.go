@@ -0,0 +1,193 @@
+package brotli
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/CAFxX/httpcompression/contrib/internal/utils"
+	"github.com/CAFxX/httpcompression/dictionary"
+	"github.com/andybalholm/brotli"
+	"github.com/andybalholm/brotli/matchfinder"
+)
+
+// maxBackwardDistance is the maximum distance of the matches in the streams
+// written by brotli.Encoder, that use a 16MB window. Longer distances refer to
+// the static dictionary instead of the preceding data.
+const maxBackwardDistance = 1<<24 - 16
+
+// NewDictionary returns a dictionary.Compressor for the dcb Content-Encoding
+// (dictionary.Brotli), that uses the dictionaries as raw (prefix) dictionaries,
+// like BrotliDecoderAttachDictionary with BROTLI_SHARED_DICTIONARY_RAW does.
+// The compressor uses the same implementation as brotli.NewWriterV2: level must
+// be between 0 and 9, levels 0 to 2 are equivalent.
+func NewDictionary(level int) (c *dictionaryCompressor, err error) {
+	if level < 0 || level > 9 {
+		return nil, fmt.Errorf("brotli: invalid dictionary compression level: %d", level)
+	}
+	tw := newDictionaryWriter(io.Discard, []byte("test"), level, &sync.Pool{})
+	if err := utils.CheckWriter(tw); err != nil {
+		return nil, fmt.Errorf("brotli: writer initialization: %w", err)
+	}
+	return &dictionaryCompressor{level: level}, nil
+}
+
+type dictionaryCompressor struct {
+	level int
+}
+
+func (c *dictionaryCompressor) Get(w io.Writer, d *dictionary.Dictionary) io.WriteCloser {
+	// The writers using the dictionary are pooled as long as the dictionary is in use.
+	pool := d.Prepared(c, newPool).(*sync.Pool)
+	if dw, ok := pool.Get().(*dictionaryWriter); ok {
+		dw.Reset(w)
+		return dw
+	}
+	return newDictionaryWriter(w, d.Data(), c.level, pool)
+}
+
+func newPool(*dictionary.Dictionary) interface{} {
+	return &sync.Pool{}
+}
+
+// NewRawDictionary returns a compressor that always uses dict as a raw (prefix)
+// dictionary, e.g. for a custom Content-Encoding. The compressed data is a brotli
+// stream without the header of the dcb Content-Encoding. See NewDictionary for
+// the meaning of level.
+func NewRawDictionary(dict []byte, level int) (c *rawDictionaryCompressor, err error) {
+	if _, err := NewDictionary(level); err != nil {
+		return nil, err
+	}
+	return &rawDictionaryCompressor{
+		dict:  append([]byte(nil), dict...),
+		level: level,
+	}, nil
+}
+
+type rawDictionaryCompressor struct {
+	pool  sync.Pool
+	dict  []byte
+	level int
+}
+
+func (c *rawDictionaryCompressor) Get(w io.Writer) io.WriteCloser {
+	if dw, ok := c.pool.Get().(*dictionaryWriter); ok {
+		dw.Reset(w)
+		return dw
+	}
+	return newDictionaryWriter(w, c.dict, c.level, &c.pool)
+}
+
+// dictionaryWriter writes brotli streams whose matches can refer to the
+// dictionary, as if it preceded the data.
+type dictionaryWriter struct {
+	matchfinder.Writer
+	pool *sync.Pool
+}
+
+func newDictionaryWriter(w io.Writer, dict []byte, level int, pool *sync.Pool) *dictionaryWriter {
+	// Same parameters as brotli.NewWriterV2, that uses matchfinder.M0 (which can
+	// not use a dictionary) for the levels below 2.
+	hashLen, chainLen := 6, 64
+	if level >= 6 {
+		hashLen = 5
+	}
+	switch level {
+	case 0, 1, 2:
+		chainLen = 0
+	case 3:
+		chainLen = 1
+	case 4:
+		chainLen = 2
+	case 5:
+		chainLen = 4
+	case 6:
+		chainLen = 8
+	}
+	// The matches in the dictionary are valid only as long as their distance
+	// does not exceed the window, see maxBackwardDistance.
+	maxDistance := 1<<20 + len(dict)
+	if maxDistance > maxBackwardDistance {
+		maxDistance = maxBackwardDistance
+	}
+	return &dictionaryWriter{
+		Writer: matchfinder.Writer{
+			Dest: w,
+			MatchFinder: &dictionaryMatchFinder{
+				M4: matchfinder.M4{
+					MaxDistance:     maxDistance,
+					ChainLength:     chainLen,
+					HashLen:         hashLen,
+					DistanceBitCost: 57,
+				},
+				dict: dict,
+			},
+			Encoder:   &brotli.Encoder{},
+			BlockSize: 1 << 16,
+		},
+		pool: pool,
+	}
+}
+
+func (w *dictionaryWriter) Close() error {
+	err := w.Writer.Close()
+	w.Reset(nil)
+	w.pool.Put(w)
+	return err
+}
+
+// dictionaryMatchFinder is a matchfinder.M4 whose history starts with the
+// dictionary, so that the distances of the matches in the dictionary are the
+// ones expected by the decoders using it as a raw dictionary.
+type dictionaryMatchFinder struct {
+	matchfinder.M4
+	dict    []byte
+	primed  bool
+	pos     int // Number of bytes of data before the current block.
+	matches []matchfinder.Match
+}
+
+func (f *dictionaryMatchFinder) FindMatches(dst []matchfinder.Match, src []byte) []matchfinder.Match {
+	if !f.primed {
+		// Add the dictionary to the history; the matches found in it are not needed.
+		f.matches = f.M4.FindMatches(f.matches[:0], f.dict)
+		f.primed = true
+	}
+	f.matches = f.M4.FindMatches(f.matches[:0], src)
+
+	// The decoders do not allow a copy from the dictionary to continue in the
+	// data, so the matches that do are split in two.
+	pos, unmatched := f.pos, 0
+	for _, m := range f.matches {
+		pos += m.Unmatched
+		unmatched += m.Unmatched
+		if n := m.Distance - pos; n > 0 && m.Length > n {
+			dst, unmatched = appendMatch(dst, unmatched, n, m.Distance)
+			pos += n
+			m.Length -= n
+		}
+		dst, unmatched = appendMatch(dst, unmatched, m.Length, m.Distance)
+		pos += m.Length
+	}
+	if unmatched > 0 {
+		dst = append(dst, matchfinder.Match{Unmatched: unmatched})
+	}
+	f.pos = pos
+	return dst
+}
+
+// appendMatch appends the match to dst, unless it is too short to be worth
+// encoding: in that case the matched bytes are added to the unmatched ones.
+func appendMatch(dst []matchfinder.Match, unmatched, length, distance int) ([]matchfinder.Match, int) {
+	if length < 4 {
+		return dst, unmatched + length
+	}
+	dst = append(dst, matchfinder.Match{Unmatched: unmatched, Length: length, Distance: distance})
+	return dst, 0
+}
+
+func (f *dictionaryMatchFinder) Reset() {
+	f.M4.Reset()
+	f.primed = false
+	f.pos = 0
+}
@@ -0,0 +1,75 @@
+//go:build cgo && brotlidictionary
+// +build cgo,brotlidictionary
+
+package brotli_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/CAFxX/httpcompression"
+	"github.com/CAFxX/httpcompression/contrib/andybalholm/brotli"
+	"github.com/CAFxX/httpcompression/contrib/internal/brotlidict"
+	"github.com/CAFxX/httpcompression/dictionary"
+)
+
+// TestDictionaryLibbrotli checks that the streams are decoded by libbrotli
+// (1.1.0 or later), that supports raw dictionaries.
+func TestDictionaryLibbrotli(t *testing.T) {
+	t.Parallel()
+
+	testDictionaryRoundTrip(t, brotlidict.Decode)
+}
+
+func TestDictionaryMiddleware(t *testing.T) {
+	t.Parallel()
+
+	dict, data := testDictionaryData()
+	d, err := dictionary.New(dict, dictionary.Options{Match: "/*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := dictionary.NewMemoryStore(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Add("js", d)
+	dc, err := brotli.NewDictionary(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mw, err := httpcompression.DefaultAdapter(
+		httpcompression.DictionaryCompressor(dictionary.Brotli, 1000, dc),
+		httpcompression.DictionariesFrom(store),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/javascript")
+		w.Write(data)
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/app.js", nil)
+	r.Header.Set("Accept-Encoding", "br, dcb")
+	r.Header.Set(dictionary.AvailableDictionary, d.Hash().String())
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if ce := w.Header().Get("Content-Encoding"); ce != dictionary.Brotli {
+		t.Fatalf("unexpected Content-Encoding: %q", ce)
+	}
+	body := w.Body.Bytes()
+	prefix := dictionary.Header(dictionary.Brotli, d.Hash())
+	if !bytes.HasPrefix(body, prefix) {
+		t.Fatal("missing dcb header")
+	}
+	got, err := brotlidict.Decode(body[len(prefix):], dict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("decoded body does not match")
+	}
+}
@@ -0,0 +1,231 @@
+package brotli_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/bits"
+	"strings"
+	"testing"
+
+	"github.com/CAFxX/httpcompression"
+	"github.com/CAFxX/httpcompression/contrib/andybalholm/brotli"
+	"github.com/CAFxX/httpcompression/dictionary"
+
+	_brotli "github.com/andybalholm/brotli"
+)
+
+var _ dictionary.Compressor = &brotli.DictionaryCompressor{}
+var _ httpcompression.CompressorProvider = &brotli.RawDictionaryCompressor{}
+
+// testDictionaryData returns a dictionary and some data similar to it, but
+// larger than the blocks compressed at once.
+func testDictionaryData() (dict, data []byte) {
+	var d, b strings.Builder
+	for i := 0; i < 500; i++ {
+		fmt.Fprintf(&d, "function handler%d(event) { return dispatch(%q, event.target, %d); }\n", i, "click", i*7)
+	}
+	for i := 0; i < 3000; i++ {
+		fmt.Fprintf(&b, "function handler%d(event) { return dispatch(%q, event.target, %d); }\n", i%600, "click", i*7)
+	}
+	return []byte(d.String()), []byte(b.String())
+}
+
+// TestDictionaryRoundTrip checks that the streams decode to the original data
+// when the dictionary is inserted before the compressed data (see
+// decodePrefixed). The decoders supporting raw dictionaries are checked by
+// TestDictionaryLibbrotli.
+func TestDictionaryRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	testDictionaryRoundTrip(t, decodePrefixed)
+}
+
+func testDictionaryRoundTrip(t *testing.T, decode func(stream, dict []byte) ([]byte, error)) {
+	dict, data := testDictionaryData()
+	d, err := dictionary.New(dict, dictionary.Options{Match: "/*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, level := range []int{0, 2, 4, 6, 9} {
+		dc, err := brotli.NewDictionary(level)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rc, err := brotli.NewRawDictionary(dict, level)
+		if err != nil {
+			t.Fatal(err)
+		}
+		plain, err := brotli.New(brotli.Options{Quality: level})
+		if err != nil {
+			t.Fatal(err)
+		}
+		get := map[string]func(io.Writer) io.WriteCloser{
+			"dictionary":     func(w io.Writer) io.WriteCloser { return dc.Get(w, d) },
+			"raw dictionary": rc.Get,
+		}
+		for name, get := range get {
+			// The second iteration uses a pooled writer.
+			for i := 0; i < 2; i++ {
+				for _, in := range [][]byte{data, data[:100], nil} {
+					var buf bytes.Buffer
+					w := get(&buf)
+					for p := in; len(p) > 0; p = p[len(p)/2+1:] {
+						if _, err := w.Write(p[:len(p)/2+1]); err != nil {
+							t.Fatal(err)
+						}
+					}
+					if err := w.Close(); err != nil {
+						t.Fatal(err)
+					}
+
+					out, err := decode(buf.Bytes(), dict)
+					if err != nil {
+						t.Fatalf("level %d, %s, %d bytes, iteration %d: %v", level, name, len(in), i, err)
+					}
+					if !bytes.Equal(out, in) {
+						t.Fatalf("level %d, %s: decoded data does not match", level, name)
+					}
+					if len(in) == len(data) {
+						var pbuf bytes.Buffer
+						pw := plain.Get(&pbuf)
+						pw.Write(in)
+						pw.Close()
+						if buf.Len() >= pbuf.Len() {
+							t.Fatalf("level %d, %s: dictionary not used: %d >= %d bytes", level, name, buf.Len(), pbuf.Len())
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// decodePrefixed decodes a stream using dict as a raw dictionary, as written by
+// brotli.Encoder, with a decoder that does not support raw dictionaries: an
+// uncompressed meta-block containing dict is inserted between the stream header
+// and the compressed meta-blocks, so that the matches in the dictionary refer to
+// the preceding data.
+func decodePrefixed(stream, dict []byte) ([]byte, error) {
+	// brotli.Encoder writes a 4 bit stream header (WBITS=24) and ends the stream
+	// with an empty last meta-block (bits 1, 1) padded to a byte boundary.
+	if len(stream) == 0 || stream[len(stream)-1] == 0 {
+		return nil, fmt.Errorf("invalid stream")
+	}
+	if len(dict) == 0 || len(dict) > 1<<24 {
+		return nil, fmt.Errorf("invalid dictionary size: %d", len(dict))
+	}
+	end := 8*len(stream) - bits.LeadingZeros8(stream[len(stream)-1])
+
+	var w bitWriter
+	w.write(uint64(stream[0]&0xf), 4)
+	// ISLAST=0, MNIBBLES, MLEN-1, ISUNCOMPRESSED=1.
+	nibbles := 4
+	for len(dict)-1 >= 1<<uint(4*nibbles) {
+		nibbles++
+	}
+	w.write(0, 1)
+	w.write(uint64(nibbles-4), 2)
+	w.write(uint64(len(dict)-1), 4*nibbles)
+	w.write(1, 1)
+	w.align()
+	w.buf = append(w.buf, dict...)
+	for i := 4; i < end; i++ {
+		w.write(uint64(stream[i/8]>>uint(i%8)&1), 1)
+	}
+	w.align()
+
+	out, err := ioutil.ReadAll(_brotli.NewReader(bytes.NewReader(w.buf)))
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(out, dict) {
+		return nil, fmt.Errorf("dictionary not decoded")
+	}
+	return out[len(dict):], nil
+}
+
+// bitWriter writes bits least significant first, like the brotli encoders.
+type bitWriter struct {
+	buf   []byte
+	nbits int // Number of bits used in the last byte of buf.
+}
+
+func (w *bitWriter) write(v uint64, n int) {
+	for i := 0; i < n; i++ {
+		if w.nbits == 0 {
+			w.buf = append(w.buf, 0)
+		}
+		w.buf[len(w.buf)-1] |= byte(v>>uint(i)&1) << uint(w.nbits)
+		w.nbits = (w.nbits + 1) % 8
+	}
+}
+
+func (w *bitWriter) align() {
+	w.nbits = 0
+}
+
+func TestDictionaryCompressor(t *testing.T) {
+	t.Parallel()
+
+	dict, data := testDictionaryData()
+	d, err := dictionary.New(dict, dictionary.Options{Match: "/*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dc, err := brotli.NewDictionary(6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err := brotli.NewRawDictionary(dict, 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := brotli.New(brotli.Options{Quality: 6})
+	if err != nil {
+		t.Fatal(err)
+	}
+	compress := func(c httpcompression.CompressorProvider) []byte {
+		var buf bytes.Buffer
+		w := c.Get(&buf)
+		for p := data; len(p) > 0; p = p[len(p)/2+1:] {
+			if _, err := w.Write(p[:len(p)/2+1]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+
+	// The second iteration uses the pooled writers.
+	for i := 0; i < 2; i++ {
+		got := compress(compressorFunc(func(w io.Writer) io.WriteCloser { return dc.Get(w, d) }))
+		if raw := compress(rc); !bytes.Equal(got, raw) {
+			t.Fatalf("iteration %d: different output of the raw dictionary compressor", i)
+		}
+		if p := compress(plain); len(got) >= len(p) {
+			t.Fatalf("iteration %d: dictionary not used: %d >= %d bytes", i, len(got), len(p))
+		}
+	}
+}
+
+type compressorFunc func(io.Writer) io.WriteCloser
+
+func (f compressorFunc) Get(w io.Writer) io.WriteCloser { return f(w) }
+
+func TestNewDictionary(t *testing.T) {
+	t.Parallel()
+
+	for _, level := range []int{-1, 10} {
+		if _, err := brotli.NewDictionary(level); err == nil {
+			t.Fatalf("level %d: no error", level)
+		}
+		if _, err := brotli.NewRawDictionary([]byte("dictionary"), level); err == nil {
+			t.Fatalf("level %d: no error", level)
+		}
+	}
+}
@@ -1,3 +1,9 @@
 package brotli
 
 type Compressor = compressor
+
+type Decompressor = decompressor
+
+type DictionaryCompressor = dictionaryCompressor
+
+type RawDictionaryCompressor = rawDictionaryCompressor
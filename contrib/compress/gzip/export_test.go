@@ -1,3 +1,5 @@
 package gzip
 
 type Compressor = compressor
+
+type Decompressor = decompressor
@@ -63,3 +63,34 @@ func (w *gzipWriter) Close() error {
 	w.c.pool.Put(w)
 	return err
 }
+
+type decompressor struct {
+	pool sync.Pool
+}
+
+func NewDecompressor() (*decompressor, error) {
+	return &decompressor{}, nil
+}
+
+func (d *decompressor) Get(r io.Reader) io.ReadCloser {
+	gr, _ := d.pool.Get().(*gzipReader)
+	if gr == nil {
+		gr = &gzipReader{d: d}
+	}
+	if err := gr.Reset(r); err != nil {
+		d.pool.Put(gr)
+		return utils.ErrorReadCloser{Err: err}
+	}
+	return gr
+}
+
+type gzipReader struct {
+	gzip.Reader
+	d *decompressor
+}
+
+func (r *gzipReader) Close() error {
+	err := r.Reader.Close()
+	r.d.pool.Put(r)
+	return err
+}
@@ -15,3 +15,10 @@ func TestZstdRace(t *testing.T) {
 	c, _ := gzip.New(gzip.Options{})
 	internal.RaceTestCompressionProvider(c, 100)
 }
+
+func TestGzipDecompressorRace(t *testing.T) {
+	t.Parallel()
+	c, _ := gzip.New(gzip.Options{})
+	d, _ := gzip.NewDecompressor()
+	internal.RaceTestDecompressionProvider(c, d, 100)
+}
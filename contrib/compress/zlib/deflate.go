@@ -7,6 +7,7 @@ import (
 	"sync"
 
 	"github.com/CAFxX/httpcompression/contrib/internal/utils"
+	"github.com/CAFxX/httpcompression/dictionary"
 )
 
 const (
@@ -64,3 +65,104 @@ func (w *deflateWriter) Close() error {
 	w.c.pool.Put(w)
 	return err
 }
+
+type dictionaryCompressor struct {
+	level int
+}
+
+// NewDictionary returns a dictionary.Compressor that uses the dictionaries as
+// preset dictionaries. As no standard Content-Encoding uses them, it is only
+// useful with custom clients (see httpcompression.DictionaryCompressor).
+func NewDictionary(level int) (c *dictionaryCompressor, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			c, err = nil, fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	tw, err := zlib.NewWriterLevelDict(io.Discard, level, []byte("test"))
+	if err != nil {
+		return nil, err
+	}
+	if err := utils.CheckWriter(tw); err != nil {
+		return nil, fmt.Errorf("deflate: writer initialization: %w", err)
+	}
+
+	c = &dictionaryCompressor{level: level}
+	return c, nil
+}
+
+func (c *dictionaryCompressor) Get(w io.Writer, d *dictionary.Dictionary) io.WriteCloser {
+	// The writers using the dictionary are pooled as long as the dictionary is in use.
+	pool := d.Prepared(c, newPool).(*sync.Pool)
+	if gw, ok := pool.Get().(*deflateDictionaryWriter); ok {
+		gw.Reset(w)
+		return gw
+	}
+	gw, err := zlib.NewWriterLevelDict(w, c.level, d.Data())
+	if err != nil {
+		return utils.ErrorWriteCloser{Err: err}
+	}
+	return &deflateDictionaryWriter{
+		Writer: gw,
+		pool:   pool,
+	}
+}
+
+func newPool(*dictionary.Dictionary) interface{} {
+	return &sync.Pool{}
+}
+
+type deflateDictionaryWriter struct {
+	*zlib.Writer
+	pool *sync.Pool
+}
+
+func (w *deflateDictionaryWriter) Close() error {
+	err := w.Writer.Close()
+	w.Reset(nil)
+	w.pool.Put(w)
+	return err
+}
+
+type DecompressorOptions struct {
+	Dictionary []byte
+}
+
+type decompressor struct {
+	pool sync.Pool
+	opt  DecompressorOptions
+}
+
+func NewDecompressor(opt DecompressorOptions) (*decompressor, error) {
+	return &decompressor{opt: opt}, nil
+}
+
+func (d *decompressor) Get(r io.Reader) io.ReadCloser {
+	if dr, ok := d.pool.Get().(*deflateReader); ok {
+		if err := dr.ReadCloser.(zlib.Resetter).Reset(r, d.opt.Dictionary); err != nil {
+			d.pool.Put(dr)
+			return utils.ErrorReadCloser{Err: err}
+		}
+		return dr
+	}
+	dr, err := zlib.NewReaderDict(r, d.opt.Dictionary)
+	if err != nil {
+		return utils.ErrorReadCloser{Err: err}
+	}
+	return &deflateReader{
+		ReadCloser: dr,
+		d:          d,
+	}
+}
+
+type deflateReader struct {
+	io.ReadCloser
+	d *decompressor
+}
+
+func (r *deflateReader) Close() error {
+	err := r.ReadCloser.Close()
+	r.d.pool.Put(r)
+	return err
+}
@@ -15,3 +15,10 @@ func TestZstdRace(t *testing.T) {
 	c, _ := zlib.New(zlib.Options{})
 	internal.RaceTestCompressionProvider(c, 100)
 }
+
+func TestDeflateDecompressorRace(t *testing.T) {
+	t.Parallel()
+	c, _ := zlib.New(zlib.Options{})
+	d, _ := zlib.NewDecompressor(zlib.DecompressorOptions{})
+	internal.RaceTestDecompressionProvider(c, d, 100)
+}
@@ -9,9 +9,13 @@ import (
 
 	"github.com/CAFxX/httpcompression"
 	"github.com/CAFxX/httpcompression/contrib/compress/zlib"
+	"github.com/CAFxX/httpcompression/contrib/internal"
+	"github.com/CAFxX/httpcompression/dictionary"
 )
 
 var _ httpcompression.CompressorProvider = &zlib.Compressor{}
+var _ httpcompression.DecompressorProvider = &zlib.Decompressor{}
+var _ dictionary.Compressor = &zlib.DictionaryCompressor{}
 
 func TestDeflate(t *testing.T) {
 	t.Parallel()
@@ -39,3 +43,82 @@ func TestDeflate(t *testing.T) {
 		t.Fatalf("decoded string mismatch\ngot: %q\nexp: %q", string(s), string(d))
 	}
 }
+
+func TestDeflateDecompressor(t *testing.T) {
+	t.Parallel()
+
+	c, err := zlib.New(zlib.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := zlib.NewDecompressor(zlib.DecompressorOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := internal.RoundTrip(c, d, []byte("hello world!")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDeflateDecompressorDictionary(t *testing.T) {
+	t.Parallel()
+
+	dict := []byte("hello world! this is a dictionary")
+
+	c, err := zlib.New(zlib.Options{Level: zlib.DefaultCompression, Dictionary: dict})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := zlib.NewDecompressor(zlib.DecompressorOptions{Dictionary: dict})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := internal.RoundTrip(c, d, []byte("hello world! hello dictionary!")); err != nil {
+		t.Fatal(err)
+	}
+
+	// decompressing without the dictionary must fail
+	d, err = zlib.NewDecompressor(zlib.DecompressorOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := internal.RoundTrip(c, d, []byte("hello world! hello dictionary!")); err == nil {
+		t.Fatal("no error without dictionary")
+	}
+}
+
+func TestDeflateDictionary(t *testing.T) {
+	t.Parallel()
+
+	data := []byte("hello world! this is a dictionary")
+	dict, err := dictionary.New(data, dictionary.Options{Match: "/*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := zlib.NewDictionary(zlib.DefaultCompression)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ { // The second time, the writer is recycled.
+		s := []byte("hello world! hello dictionary!")
+		b := &bytes.Buffer{}
+		w := c.Get(b, dict)
+		w.Write(s)
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		r, err := stdzlib.NewReaderDict(b, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(s, d) {
+			t.Fatalf("decoded string mismatch\ngot: %q\nexp: %q", string(d), string(s))
+		}
+	}
+}
@@ -1,3 +1,7 @@
 package zlib
 
 type Compressor = compressor
+
+type Decompressor = decompressor
+
+type DictionaryCompressor = dictionaryCompressor
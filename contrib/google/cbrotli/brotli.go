@@ -59,3 +59,35 @@ func finalizer(cw *writer) {
 		_ = cw.Close()
 	}(cw)
 }
+
+type decompressor struct{}
+
+func NewDecompressor() (*decompressor, error) {
+	return &decompressor{}, nil
+}
+
+func (d *decompressor) Get(r io.Reader) io.ReadCloser {
+	cr := &reader{
+		Reader: cbrotli.NewReader(r),
+	}
+	runtime.SetFinalizer(cr, readerFinalizer)
+	return cr
+}
+
+type reader struct {
+	*cbrotli.Reader
+}
+
+func (r *reader) Close() error {
+	defer runtime.SetFinalizer(r, nil)
+	return r.Reader.Close()
+}
+
+func readerFinalizer(cr *reader) {
+	go func(cr *reader) {
+		defer func() {
+			recover()
+		}()
+		_ = cr.Close()
+	}(cr)
+}
@@ -16,3 +16,10 @@ func TestBrotliRace(t *testing.T) {
 	c, _ := cbrotli.New(gcbrotli.WriterOptions{})
 	internal.RaceTestCompressionProvider(c, 100)
 }
+
+func TestBrotliDecompressorRace(t *testing.T) {
+	t.Parallel()
+	c, _ := cbrotli.New(gcbrotli.WriterOptions{})
+	d, _ := cbrotli.NewDecompressor()
+	internal.RaceTestDecompressionProvider(c, d, 100)
+}
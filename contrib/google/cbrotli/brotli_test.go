@@ -10,10 +10,12 @@ import (
 
 	"github.com/CAFxX/httpcompression"
 	"github.com/CAFxX/httpcompression/contrib/google/cbrotli"
+	"github.com/CAFxX/httpcompression/contrib/internal"
 	gcbrotli "github.com/google/brotli/go/cbrotli"
 )
 
 var _ httpcompression.CompressorProvider = &cbrotli.Compressor{}
+var _ httpcompression.DecompressorProvider = &cbrotli.Decompressor{}
 
 func TestBrotli(t *testing.T) {
 	t.Parallel()
@@ -78,3 +80,19 @@ func TestBrotliFinalize(t *testing.T) {
 		t.Fatalf("writer: %q, finalizer writer: %q", writer, fw)
 	}
 }
+
+func TestBrotliDecompressor(t *testing.T) {
+	t.Parallel()
+
+	c, err := cbrotli.New(gcbrotli.WriterOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := cbrotli.NewDecompressor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := internal.RoundTrip(c, d, []byte("hello world!")); err != nil {
+		t.Fatal(err)
+	}
+}
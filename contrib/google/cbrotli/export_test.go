@@ -2,4 +2,6 @@ package cbrotli
 
 type Compressor = compressor
 
+type Decompressor = decompressor
+
 var FinalizerHook = &finalizerHook
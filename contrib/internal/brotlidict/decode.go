@@ -0,0 +1,55 @@
+//go:build cgo && brotlidictionary
+// +build cgo,brotlidictionary
+
+package brotlidict
+
+// #cgo LDFLAGS: -lbrotlidec -lbrotlicommon
+// #include <stdlib.h>
+// #include <brotli/decode.h>
+import "C"
+
+import "errors"
+
+// Decode decodes the brotli stream data, using dict as a raw dictionary.
+func Decode(data, dict []byte) ([]byte, error) {
+	s := C.BrotliDecoderCreateInstance(nil, nil, nil)
+	if s == nil {
+		return nil, errors.New("brotlidict: can not create decoder")
+	}
+	defer C.BrotliDecoderDestroyInstance(s)
+
+	// The dictionary must outlive the decoder, so it can not be in Go memory.
+	cdict := C.CBytes(dict)
+	defer C.free(cdict)
+	if C.BrotliDecoderAttachDictionary(s, C.BROTLI_SHARED_DICTIONARY_RAW, C.size_t(len(dict)), (*C.uint8_t)(cdict)) == 0 {
+		return nil, errors.New("brotlidict: can not attach dictionary")
+	}
+
+	in := C.CBytes(data)
+	defer C.free(in)
+	availIn := C.size_t(len(data))
+	nextIn := (*C.uint8_t)(in)
+	var out []byte
+	buf := make([]byte, 1<<16)
+	cbuf := C.malloc(C.size_t(len(buf)))
+	defer C.free(cbuf)
+	for {
+		availOut := C.size_t(len(buf))
+		nextOut := (*C.uint8_t)(cbuf)
+		res := C.BrotliDecoderDecompressStream(s, &availIn, &nextIn, &availOut, &nextOut, nil)
+		out = append(out, C.GoBytes(cbuf, C.int(len(buf)-int(availOut)))...)
+		switch res {
+		case C.BROTLI_DECODER_RESULT_SUCCESS:
+			if availIn != 0 {
+				return nil, errors.New("brotlidict: trailing data")
+			}
+			return out, nil
+		case C.BROTLI_DECODER_RESULT_NEEDS_MORE_OUTPUT:
+			continue
+		case C.BROTLI_DECODER_RESULT_NEEDS_MORE_INPUT:
+			return nil, errors.New("brotlidict: truncated stream")
+		default:
+			return nil, errors.New("brotlidict: " + C.GoString(C.BrotliDecoderErrorString(C.BrotliDecoderGetErrorCode(s))))
+		}
+	}
+}
@@ -0,0 +1,4 @@
+// Package brotlidict decodes brotli streams compressed with a raw dictionary,
+// using libbrotli (1.1.0 or later) via cgo. It is used only by the tests, and
+// it is empty unless the brotlidictionary build tag is set.
+package brotlidict
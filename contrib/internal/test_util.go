@@ -2,6 +2,8 @@ package internal
 
 import (
 	"bytes"
+	"fmt"
+	"io"
 	"runtime"
 	"sync"
 
@@ -25,3 +27,54 @@ func RaceTestCompressionProvider(c httpcompression.CompressorProvider, n int) {
 	}
 	wg.Wait()
 }
+
+func RaceTestDecompressionProvider(c httpcompression.CompressorProvider, d httpcompression.DecompressorProvider, n int) {
+	var wg sync.WaitGroup
+	for i := runtime.GOMAXPROCS(0); i >= 0; i-- {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < n; j++ {
+				_ = RoundTrip(c, d, []byte("hello world"))
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// RoundTrip compresses data using c, decompresses it using d, and returns an error
+// if the decompressed data does not match the original data.
+// Malformed input is also fed to d to check that it is correctly rejected, and
+// that the decompressor can be reused afterwards.
+func RoundTrip(c httpcompression.CompressorProvider, d httpcompression.DecompressorProvider, data []byte) error {
+	for i := 0; i < 2; i++ {
+		b := &bytes.Buffer{}
+		w := c.Get(b)
+		if _, err := w.Write(data); err != nil {
+			return fmt.Errorf("write: %w", err)
+		}
+		if err := w.Close(); err != nil {
+			return fmt.Errorf("close writer: %w", err)
+		}
+
+		r := d.Get(b)
+		got, err := io.ReadAll(r)
+		if err != nil {
+			return fmt.Errorf("read: %w", err)
+		}
+		if err := r.Close(); err != nil {
+			return fmt.Errorf("close reader: %w", err)
+		}
+		if !bytes.Equal(got, data) {
+			return fmt.Errorf("decoded data mismatch\ngot: %q\nexp: %q", got, data)
+		}
+
+		r = d.Get(bytes.NewReader([]byte("this is not a valid compressed stream")))
+		_, err = io.ReadAll(r)
+		r.Close()
+		if err == nil {
+			return fmt.Errorf("malformed input: no error")
+		}
+	}
+	return nil
+}
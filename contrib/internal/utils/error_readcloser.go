@@ -0,0 +1,13 @@
+package utils
+
+type ErrorReadCloser struct {
+	Err error
+}
+
+func (e ErrorReadCloser) Read(_ []byte) (int, error) {
+	return 0, e.Err
+}
+
+func (e ErrorReadCloser) Close() error {
+	return e.Err
+}
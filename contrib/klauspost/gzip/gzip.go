@@ -68,3 +68,34 @@ func (w *writer) Close() error {
 	w.c.pool.Put(w)
 	return err
 }
+
+type decompressor struct {
+	pool sync.Pool
+}
+
+func NewDecompressor() (*decompressor, error) {
+	return &decompressor{}, nil
+}
+
+func (d *decompressor) Get(r io.Reader) io.ReadCloser {
+	gr, _ := d.pool.Get().(*reader)
+	if gr == nil {
+		gr = &reader{d: d}
+	}
+	if err := gr.Reset(r); err != nil {
+		d.pool.Put(gr)
+		return utils.ErrorReadCloser{Err: err}
+	}
+	return gr
+}
+
+type reader struct {
+	gzip.Reader
+	d *decompressor
+}
+
+func (r *reader) Close() error {
+	err := r.Reader.Close()
+	r.d.pool.Put(r)
+	return err
+}
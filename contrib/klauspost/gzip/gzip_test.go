@@ -8,10 +8,12 @@ import (
 	stdgzip "compress/gzip"
 
 	"github.com/CAFxX/httpcompression"
+	"github.com/CAFxX/httpcompression/contrib/internal"
 	"github.com/CAFxX/httpcompression/contrib/klauspost/gzip"
 )
 
 var _ httpcompression.CompressorProvider = &gzip.Compressor{}
+var _ httpcompression.DecompressorProvider = &gzip.Decompressor{}
 
 func TestGzip(t *testing.T) {
 	t.Parallel()
@@ -39,3 +41,19 @@ func TestGzip(t *testing.T) {
 		t.Fatalf("decoded string mismatch\ngot: %q\nexp: %q", string(s), string(d))
 	}
 }
+
+func TestGzipDecompressor(t *testing.T) {
+	t.Parallel()
+
+	c, err := gzip.New(gzip.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := gzip.NewDecompressor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := internal.RoundTrip(c, d, []byte("hello world!")); err != nil {
+		t.Fatal(err)
+	}
+}
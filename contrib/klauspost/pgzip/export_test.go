@@ -1,3 +1,5 @@
 package pgzip
 
 type Compressor = compressor
+
+type Decompressor = decompressor
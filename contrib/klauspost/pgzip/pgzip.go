@@ -78,3 +78,55 @@ func (w *writer) Close() error {
 	w.c.pool.Put(w)
 	return err
 }
+
+type decompressor struct {
+	pool sync.Pool
+	opts DecompressorOptions
+}
+
+type DecompressorOptions struct {
+	BlockSize int
+	Blocks    int
+}
+
+func NewDecompressor(opts DecompressorOptions) (*decompressor, error) {
+	if opts.BlockSize < 0 || opts.Blocks < 0 {
+		return nil, fmt.Errorf("pgzip: invalid decompressor options: %+v", opts)
+	}
+	return &decompressor{opts: opts}, nil
+}
+
+func (d *decompressor) Get(r io.Reader) io.ReadCloser {
+	if gr, ok := d.pool.Get().(*reader); ok {
+		if err := gr.Reset(r); err != nil {
+			d.pool.Put(gr)
+			return utils.ErrorReadCloser{Err: err}
+		}
+		return gr
+	}
+	var gr *pgzip.Reader
+	var err error
+	if d.opts.BlockSize > 0 && d.opts.Blocks > 0 {
+		gr, err = pgzip.NewReaderN(r, d.opts.BlockSize, d.opts.Blocks)
+	} else {
+		gr, err = pgzip.NewReader(r)
+	}
+	if err != nil {
+		return utils.ErrorReadCloser{Err: err}
+	}
+	return &reader{
+		Reader: gr,
+		d:      d,
+	}
+}
+
+type reader struct {
+	*pgzip.Reader
+	d *decompressor
+}
+
+func (r *reader) Close() error {
+	err := r.Reader.Close()
+	r.d.pool.Put(r)
+	return err
+}
@@ -15,3 +15,10 @@ func TestPgzipRace(t *testing.T) {
 	c, _ := pgzip.New(pgzip.Options{BlockSize: 1 << 20, Blocks: runtime.GOMAXPROCS(0)})
 	internal.RaceTestCompressionProvider(c, 100)
 }
+
+func TestPgzipDecompressorRace(t *testing.T) {
+	t.Parallel()
+	c, _ := pgzip.New(pgzip.Options{BlockSize: 1 << 20, Blocks: runtime.GOMAXPROCS(0)})
+	d, _ := pgzip.NewDecompressor(pgzip.DecompressorOptions{})
+	internal.RaceTestDecompressionProvider(c, d, 100)
+}
@@ -9,10 +9,12 @@ import (
 	stdgzip "compress/gzip"
 
 	"github.com/CAFxX/httpcompression"
+	"github.com/CAFxX/httpcompression/contrib/internal"
 	"github.com/CAFxX/httpcompression/contrib/klauspost/pgzip"
 )
 
 var _ httpcompression.CompressorProvider = &pgzip.Compressor{}
+var _ httpcompression.DecompressorProvider = &pgzip.Decompressor{}
 
 func TestPgzip(t *testing.T) {
 	t.Parallel()
@@ -40,3 +42,19 @@ func TestPgzip(t *testing.T) {
 		t.Fatalf("decoded string mismatch\ngot: %q\nexp: %q", string(s), string(d))
 	}
 }
+
+func TestPgzipDecompressor(t *testing.T) {
+	t.Parallel()
+
+	c, err := pgzip.New(pgzip.Options{BlockSize: 1 << 20, Blocks: runtime.GOMAXPROCS(0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := pgzip.NewDecompressor(pgzip.DecompressorOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := internal.RoundTrip(c, d, []byte("hello world!")); err != nil {
+		t.Fatal(err)
+	}
+}
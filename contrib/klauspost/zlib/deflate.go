@@ -6,6 +6,7 @@ import (
 	"sync"
 
 	"github.com/CAFxX/httpcompression/contrib/internal/utils"
+	"github.com/CAFxX/httpcompression/dictionary"
 	"github.com/klauspost/compress/zlib"
 )
 
@@ -69,3 +70,104 @@ func (w *writer) Close() error {
 	w.c.pool.Put(w)
 	return err
 }
+
+type decompressor struct {
+	pool sync.Pool
+	opts DecompressorOptions
+}
+
+type dictionaryCompressor struct {
+	level int
+}
+
+// NewDictionary returns a dictionary.Compressor that uses the dictionaries as
+// preset dictionaries. As no standard Content-Encoding uses them, it is only
+// useful with custom clients (see httpcompression.DictionaryCompressor).
+func NewDictionary(level int) (c *dictionaryCompressor, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			c, err = nil, fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	tw, err := zlib.NewWriterLevelDict(io.Discard, level, []byte("test"))
+	if err != nil {
+		return nil, err
+	}
+	if err := utils.CheckWriter(tw); err != nil {
+		return nil, fmt.Errorf("deflate: writer initialization: %w", err)
+	}
+
+	c = &dictionaryCompressor{level: level}
+	return c, nil
+}
+
+func (c *dictionaryCompressor) Get(w io.Writer, d *dictionary.Dictionary) io.WriteCloser {
+	// The writers using the dictionary are pooled as long as the dictionary is in use.
+	pool := d.Prepared(c, newPool).(*sync.Pool)
+	if gw, ok := pool.Get().(*dictionaryWriter); ok {
+		gw.Reset(w)
+		return gw
+	}
+	gw, err := zlib.NewWriterLevelDict(w, c.level, d.Data())
+	if err != nil {
+		return utils.ErrorWriteCloser{Err: err}
+	}
+	return &dictionaryWriter{
+		Writer: gw,
+		pool:   pool,
+	}
+}
+
+func newPool(*dictionary.Dictionary) interface{} {
+	return &sync.Pool{}
+}
+
+type dictionaryWriter struct {
+	*zlib.Writer
+	pool *sync.Pool
+}
+
+func (w *dictionaryWriter) Close() error {
+	err := w.Writer.Close()
+	w.Reset(nil)
+	w.pool.Put(w)
+	return err
+}
+
+type DecompressorOptions struct {
+	Dictionary []byte
+}
+
+func NewDecompressor(opts DecompressorOptions) (*decompressor, error) {
+	return &decompressor{opts: opts}, nil
+}
+
+func (d *decompressor) Get(r io.Reader) io.ReadCloser {
+	if zr, ok := d.pool.Get().(*reader); ok {
+		if err := zr.ReadCloser.(zlib.Resetter).Reset(r, d.opts.Dictionary); err != nil {
+			d.pool.Put(zr)
+			return utils.ErrorReadCloser{Err: err}
+		}
+		return zr
+	}
+	zr, err := zlib.NewReaderDict(r, d.opts.Dictionary)
+	if err != nil {
+		return utils.ErrorReadCloser{Err: err}
+	}
+	return &reader{
+		ReadCloser: zr,
+		d:          d,
+	}
+}
+
+type reader struct {
+	io.ReadCloser
+	d *decompressor
+}
+
+func (r *reader) Close() error {
+	err := r.ReadCloser.Close()
+	r.d.pool.Put(r)
+	return err
+}
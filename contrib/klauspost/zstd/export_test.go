@@ -1,3 +1,9 @@
 package zstd
 
 type Compressor = compressor
+
+type Decompressor = decompressor
+
+type DictionaryCompressor = dictionaryCompressor
+
+var BuildDictionary = buildDictionary
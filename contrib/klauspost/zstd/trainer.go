@@ -0,0 +1,446 @@
+package zstd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CAFxX/httpcompression/dictionary"
+	"github.com/klauspost/compress/dict"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Default values of the TrainerOptions.
+const (
+	DefaultTrainerRate           = 0.01
+	DefaultTrainerMaxKeys        = 16
+	DefaultTrainerMaxSamples     = 100
+	DefaultTrainerMaxSampleSize  = 32 << 10
+	DefaultTrainerMinSamples     = 20
+	DefaultTrainerDictionarySize = 64 << 10
+	DefaultTrainerHoldout        = 0.25
+	DefaultTrainerThreshold      = 0.1
+)
+
+// trainerHashBytes is the minimum length of the matches indexed when training
+// the dictionaries.
+const trainerHashBytes = 6
+
+// TrainerOptions configures a Trainer. Zero values are replaced by the defaults.
+// The memory used by the samples is at most MaxKeys*MaxSamples*MaxSampleSize
+// (by default about 50MB), plus the responses being sampled.
+type TrainerOptions struct {
+	// Dictionary returns the options of the dictionaries trained for key, e.g.
+	// the requests that can use them and the Path they are served at.
+	// It is required.
+	Dictionary func(key string) dictionary.Options
+	// Key returns the key of the response to r: a dictionary is trained for each
+	// key. The responses with an empty key are not sampled. By default, the key
+	// is the media type of the response, e.g. "text/html".
+	// The dictionaries are served to all the clients, so the responses sharing a
+	// key must not contain data that is private to some users, unless they are
+	// skipped by Filter.
+	Key func(r *http.Request, contentType string) string
+	// Filter returns true if the response to r, whose header is header, can be
+	// sampled. By default (PublicResponse), the responses that may contain private
+	// data are skipped.
+	Filter func(r *http.Request, header http.Header) bool
+	// Rate is the fraction of the responses that are sampled.
+	Rate float64
+	// MaxKeys is the maximum number of keys: the responses with other keys are
+	// not sampled.
+	MaxKeys int
+	// MaxSamples is the number of samples kept for each key: older samples are
+	// replaced by newer ones.
+	MaxSamples int
+	// MaxSampleSize is the maximum size of each sample: longer bodies are truncated.
+	MaxSampleSize int
+	// MinSamples is the number of samples required to train a dictionary.
+	MinSamples int
+	// DictionarySize is the maximum size of the dictionaries.
+	DictionarySize int
+	// Holdout is the fraction of the samples used to evaluate the dictionaries,
+	// instead of training them.
+	Holdout float64
+	// Threshold is the minimum reduction of the compressed size of the holdout
+	// samples required to promote a dictionary, compared to compressing them
+	// without dictionary (and with the dictionary previously promoted, if any).
+	Threshold float64
+	// Level is the compression level used to evaluate the dictionaries.
+	// It should match the one used by the DictionaryCompressor.
+	Level zstd.EncoderLevel
+	// ErrorHandler, if set, is called by Run with the errors returned by Train.
+	ErrorHandler func(err error)
+}
+
+// Trainer builds dictionaries for the dcz Content-Encoding from samples of the
+// responses, and adds them to a dictionary.MemoryStore, so that they are used
+// by the middleware without restarts.
+//
+// The Trainer is a dictionary.Sampler: use it with httpcompression.SampleResponses
+// to collect the samples, and call Train (or Run) to periodically train the
+// dictionaries. The dictionaries are served by the Trainer itself (see ServeHTTP).
+// The dictionaries are trained with github.com/klauspost/compress/dict.
+type Trainer struct {
+	store *dictionary.MemoryStore
+	opts  TrainerOptions
+
+	mu   sync.Mutex
+	keys map[string]*trainerKey
+}
+
+type trainerKey struct {
+	samples  [][]byte // Ring buffer, see next.
+	next     int      // Index of the oldest sample, once samples is full.
+	promoted *dictionary.Dictionary
+}
+
+var _ dictionary.Sampler = &Trainer{}
+var _ http.Handler = &Trainer{}
+
+// NewTrainer returns a Trainer that adds the dictionaries to store, using the
+// keys as names.
+func NewTrainer(store *dictionary.MemoryStore, opts TrainerOptions) (*Trainer, error) {
+	if store == nil {
+		return nil, fmt.Errorf("zstd: nil dictionary store")
+	}
+	if opts.Dictionary == nil {
+		return nil, fmt.Errorf("zstd: nil dictionary options")
+	}
+	if opts.Rate < 0 || opts.Rate > 1 {
+		return nil, fmt.Errorf("zstd: invalid sampling rate: %v", opts.Rate)
+	}
+	if opts.Holdout < 0 || opts.Holdout >= 1 {
+		return nil, fmt.Errorf("zstd: invalid holdout fraction: %v", opts.Holdout)
+	}
+	if opts.Threshold < 0 || opts.Threshold >= 1 {
+		return nil, fmt.Errorf("zstd: invalid threshold: %v", opts.Threshold)
+	}
+	if opts.MaxKeys < 0 || opts.MaxSamples < 0 || opts.MaxSampleSize < 0 || opts.MinSamples < 0 || opts.DictionarySize < 0 {
+		return nil, fmt.Errorf("zstd: negative trainer limits")
+	}
+	if opts.Key == nil {
+		opts.Key = mediaType
+	}
+	if opts.Filter == nil {
+		opts.Filter = PublicResponse
+	}
+	if opts.Rate == 0 {
+		opts.Rate = DefaultTrainerRate
+	}
+	if opts.MaxKeys == 0 {
+		opts.MaxKeys = DefaultTrainerMaxKeys
+	}
+	if opts.MaxSamples == 0 {
+		opts.MaxSamples = DefaultTrainerMaxSamples
+	}
+	if opts.MaxSampleSize == 0 {
+		opts.MaxSampleSize = DefaultTrainerMaxSampleSize
+	}
+	if opts.MinSamples == 0 {
+		opts.MinSamples = DefaultTrainerMinSamples
+		if opts.MinSamples > opts.MaxSamples {
+			opts.MinSamples = opts.MaxSamples
+		}
+	}
+	if opts.MinSamples < 2 || opts.MinSamples > opts.MaxSamples {
+		return nil, fmt.Errorf("zstd: invalid minimum number of samples: %d", opts.MinSamples)
+	}
+	if opts.DictionarySize == 0 {
+		opts.DictionarySize = DefaultTrainerDictionarySize
+	}
+	if opts.Holdout == 0 {
+		opts.Holdout = DefaultTrainerHoldout
+	}
+	if opts.Threshold == 0 {
+		opts.Threshold = DefaultTrainerThreshold
+	}
+	if opts.Level == 0 {
+		opts.Level = DefaultCompression
+	}
+	return &Trainer{
+		store: store,
+		opts:  opts,
+		keys:  map[string]*trainerKey{},
+	}, nil
+}
+
+func mediaType(_ *http.Request, contentType string) string {
+	if i := strings.IndexByte(contentType, ';'); i >= 0 {
+		contentType = contentType[:i]
+	}
+	return strings.ToLower(strings.TrimSpace(contentType))
+}
+
+// PublicResponse returns false if the response to r, whose header is header, may
+// contain data that is private to a user: i.e. if the request has credentials
+// (Authorization or Cookie), or if the response sets cookies or can not be stored
+// by shared caches (Cache-Control: private or no-store).
+func PublicResponse(r *http.Request, header http.Header) bool {
+	if r.Header.Get("Authorization") != "" || r.Header.Get("Cookie") != "" || header.Get("Set-Cookie") != "" {
+		return false
+	}
+	for _, v := range header["Cache-Control"] {
+		for _, d := range strings.Split(v, ",") {
+			if i := strings.IndexByte(d, '='); i >= 0 {
+				d = d[:i]
+			}
+			if d = strings.TrimSpace(d); strings.EqualFold(d, "private") || strings.EqualFold(d, "no-store") {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Sample implements dictionary.Sampler.
+func (t *Trainer) Sample(r *http.Request, header http.Header) io.WriteCloser {
+	if t.opts.Rate < 1 && rand.Float64() >= t.opts.Rate {
+		return nil
+	}
+	if !t.opts.Filter(r, header) {
+		return nil
+	}
+	key := t.opts.Key(r, header.Get("Content-Type"))
+	if key == "" {
+		return nil
+	}
+	t.mu.Lock()
+	_, ok := t.keys[key]
+	full := !ok && len(t.keys) >= t.opts.MaxKeys
+	t.mu.Unlock()
+	if full {
+		return nil
+	}
+	return &sampleWriter{t: t, key: key}
+}
+
+type sampleWriter struct {
+	t   *Trainer
+	key string
+	buf []byte
+}
+
+func (w *sampleWriter) Write(b []byte) (int, error) {
+	if n := w.t.opts.MaxSampleSize - len(w.buf); len(b) > n {
+		w.buf = append(w.buf, b[:n]...)
+	} else {
+		w.buf = append(w.buf, b...)
+	}
+	return len(b), nil
+}
+
+func (w *sampleWriter) Close() error {
+	if len(w.buf) > 0 {
+		w.t.add(w.key, w.buf)
+		w.buf = nil
+	}
+	return nil
+}
+
+func (t *Trainer) add(key string, sample []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	k := t.keys[key]
+	if k == nil {
+		if len(t.keys) >= t.opts.MaxKeys {
+			return
+		}
+		k = &trainerKey{}
+		t.keys[key] = k
+	}
+	if len(k.samples) < t.opts.MaxSamples {
+		k.samples = append(k.samples, sample)
+		return
+	}
+	k.samples[k.next] = sample
+	k.next = (k.next + 1) % len(k.samples)
+}
+
+// Train trains a dictionary for each key with enough samples, and promotes the
+// ones that compress the holdout samples better than the threshold, replacing
+// the dictionary previously promoted for the same key, if any.
+// If training fails for some keys, the first error is returned.
+func (t *Trainer) Train() error {
+	type job struct {
+		key      string
+		samples  [][]byte
+		promoted *dictionary.Dictionary
+	}
+	var jobs []job
+	t.mu.Lock()
+	for key, k := range t.keys {
+		if len(k.samples) < t.opts.MinSamples {
+			continue
+		}
+		// Oldest samples first. The samples are never modified.
+		samples := make([][]byte, 0, len(k.samples))
+		samples = append(samples, k.samples[k.next:]...)
+		samples = append(samples, k.samples[:k.next]...)
+		jobs = append(jobs, job{key, samples, k.promoted})
+	}
+	t.mu.Unlock()
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].key < jobs[j].key })
+
+	var first error
+	for _, j := range jobs {
+		d, err := t.train(j.key, j.samples, j.promoted)
+		if err != nil {
+			if first == nil {
+				first = fmt.Errorf("zstd: training dictionary %q: %w", j.key, err)
+			}
+			continue
+		}
+		if d == nil {
+			continue
+		}
+		t.mu.Lock()
+		t.keys[j.key].promoted = d
+		t.mu.Unlock()
+		t.store.Add(j.key, d)
+	}
+	return first
+}
+
+// train returns the dictionary to be promoted for key, or nil if the new
+// dictionary does not pass the evaluation.
+func (t *Trainer) train(key string, samples [][]byte, promoted *dictionary.Dictionary) (*dictionary.Dictionary, error) {
+	// Spread the holdout samples evenly.
+	n := len(samples)
+	h := int(float64(n) * t.opts.Holdout)
+	if h < 1 {
+		h = 1
+	}
+	var training, holdout [][]byte
+	for i, s := range samples {
+		if i*h/n != (i+1)*h/n {
+			holdout = append(holdout, s)
+		} else {
+			training = append(training, s)
+		}
+	}
+
+	data, err := buildDictionary(training, t.opts.DictionarySize)
+	if err != nil || len(data) == 0 {
+		return nil, err
+	}
+	size, err := t.compressedSize(holdout, data)
+	if err != nil {
+		return nil, err
+	}
+	baseline, err := t.compressedSize(holdout, nil)
+	if err != nil {
+		return nil, err
+	}
+	if promoted != nil {
+		prev, err := t.compressedSize(holdout, promoted.Data())
+		if err != nil {
+			return nil, err
+		}
+		if prev < baseline {
+			baseline = prev
+		}
+	}
+	if float64(size) > float64(baseline)*(1-t.opts.Threshold) {
+		return nil, nil
+	}
+	return dictionary.New(data, t.opts.Dictionary(key))
+}
+
+// buildDictionary trains a raw content dictionary of at most size bytes from
+// the distinct samples. The dcz Content-Encoding uses the dictionaries as raw
+// content, so the zstd dictionary format (with entropy tables) is not used.
+// It returns nil if no dictionary can be trained from the samples.
+func buildDictionary(samples [][]byte, size int) (data []byte, err error) {
+	// The builder panics if the samples have no recurring content (e.g. if they
+	// are random, or too short).
+	defer func() {
+		if recover() != nil {
+			data, err = nil, nil
+		}
+	}()
+	var distinct [][]byte
+	seen := map[string]bool{}
+	for _, s := range samples {
+		if !seen[string(s)] {
+			seen[string(s)] = true
+			distinct = append(distinct, s)
+		}
+	}
+	if len(distinct) == 0 {
+		return nil, nil
+	}
+	return dict.BuildRawDict(distinct, dict.Options{
+		MaxDictSize: size,
+		HashBytes:   trainerHashBytes,
+	})
+}
+
+// compressedSize returns the size of the dcz responses for the samples,
+// including the dcz header, or of the zstd responses if dict is nil.
+func (t *Trainer) compressedSize(samples [][]byte, dict []byte) (int, error) {
+	opts := []zstd.EOption{zstd.WithEncoderLevel(t.opts.Level), zstd.WithEncoderConcurrency(1)}
+	header := 0
+	if dict != nil {
+		opts = append(opts, zstd.WithEncoderDictRaw(0, dict))
+		header = len(dictionary.Header(dictionary.Zstd, dictionary.Hash{}))
+	}
+	enc, err := zstd.NewWriter(nil, opts...)
+	if err != nil {
+		return 0, err
+	}
+	defer enc.Close()
+	size := 0
+	var buf []byte
+	for _, s := range samples {
+		buf = enc.EncodeAll(s, buf[:0])
+		size += header + len(buf)
+	}
+	return size, nil
+}
+
+// Run calls Train every interval, until ctx is done.
+func (t *Trainer) Run(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if err := t.Train(); err != nil && t.opts.ErrorHandler != nil {
+				t.opts.ErrorHandler(err)
+			}
+		}
+	}
+}
+
+// ServeHTTP serves the promoted dictionaries that have a Path, so that they
+// can be fetched by the clients, e.g. after being advertised with a
+// `Link: <path>; rel="compression-dictionary"` header. When the Trainer is
+// wrapped by the middleware, the responses have the Use-As-Dictionary header.
+func (t *Trainer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var d *dictionary.Dictionary
+	t.mu.Lock()
+	for _, k := range t.keys {
+		if k.promoted != nil && k.promoted.Path() != "" && k.promoted.Path() == r.URL.Path {
+			d = k.promoted
+			break
+		}
+	}
+	t.mu.Unlock()
+	if d == nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("ETag", `"`+strings.Trim(d.Hash().String(), ":")+`"`)
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(d.Data()))
+}
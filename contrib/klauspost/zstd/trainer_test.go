@@ -0,0 +1,378 @@
+package zstd_test
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/CAFxX/httpcompression"
+	"github.com/CAFxX/httpcompression/contrib/klauspost/zstd"
+	"github.com/CAFxX/httpcompression/dictionary"
+	kpzstd "github.com/klauspost/compress/zstd"
+)
+
+func trainerBody(i int) string {
+	return fmt.Sprintf(`{"id":%d,"user":{"name":"user%d","email":"user%d@example.com","roles":["reader","writer"],`+
+		`"preferences":{"theme":"dark","language":"en-US","timezone":"Europe/Rome","notifications":{"email":true,"push":false}}},`+
+		`"links":{"self":"https://api.example.com/v1/users/%d","avatar":"https://cdn.example.com/avatars/%d.png"}}`, i, i, i, i, i)
+}
+
+func trainerOptions(key string) dictionary.Options {
+	return dictionary.Options{Match: "/api/*", Path: "/dict/" + key}
+}
+
+func contentType(ct string) http.Header {
+	return http.Header{"Content-Type": {ct}}
+}
+
+func newTrainer(t *testing.T, opts zstd.TrainerOptions) (*zstd.Trainer, *dictionary.MemoryStore) {
+	store, err := dictionary.NewMemoryStore(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr, err := zstd.NewTrainer(store, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tr, store
+}
+
+func TestTrainer(t *testing.T) {
+	t.Parallel()
+
+	tr, store := newTrainer(t, zstd.TrainerOptions{
+		Dictionary: func(key string) dictionary.Options {
+			return trainerOptions("json")
+		},
+		Rate:       1,
+		MaxSamples: 20,
+		MinSamples: 10,
+		// The dictionaries trained on the same samples can differ: require a
+		// large improvement to replace the promoted one.
+		Threshold: 0.25,
+	})
+	r := httptest.NewRequest(http.MethodGet, "/api/users", nil)
+	rnd := rand.New(rand.NewSource(0))
+	for i := 0; i < 30; i++ {
+		body := trainerBody(i)
+		w := tr.Sample(r, contentType("application/json; charset=utf-8"))
+		w.Write([]byte(body[:10]))
+		w.Write([]byte(body[10:]))
+		w.Close()
+
+		// Random data can not be compressed, so no dictionary is promoted.
+		random := make([]byte, 500)
+		rnd.Read(random)
+		w = tr.Sample(r, contentType("application/octet-stream"))
+		w.Write(random)
+		w.Close()
+	}
+
+	if err := tr.Train(); err != nil {
+		t.Fatal(err)
+	}
+	active := store.Active()
+	if len(active) != 1 || active[0].Path() != "/dict/json" {
+		t.Fatalf("unexpected active dictionaries: %v", active)
+	}
+	d, ok := store.Get(active[0].Hash())
+	if !ok || d != active[0] {
+		t.Fatal("promoted dictionary not found")
+	}
+	if n := len(d.Data()); n == 0 || n > zstd.DefaultTrainerDictionarySize {
+		t.Fatalf("unexpected dictionary size: %d", n)
+	}
+
+	// A new dictionary trained on the same samples is not better than the
+	// promoted one, so it is not promoted.
+	if err := tr.Train(); err != nil {
+		t.Fatal(err)
+	}
+	if active := store.Active(); len(active) != 1 || active[0] != d {
+		t.Fatal("dictionary replaced")
+	}
+
+	w := httptest.NewRecorder()
+	tr.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/dict/json", nil))
+	if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), d.Data()) {
+		t.Fatalf("unexpected response: %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	tr.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/dict/octet-stream", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("unexpected response: %d", w.Code)
+	}
+}
+
+func TestTrainerMiddleware(t *testing.T) {
+	t.Parallel()
+
+	tr, store := newTrainer(t, zstd.TrainerOptions{
+		Dictionary: trainerOptions,
+		Key: func(r *http.Request, contentType string) string {
+			if r.URL.Path == "/api/users" {
+				return "users"
+			}
+			return ""
+		},
+		Rate: 1,
+	})
+	dc, err := zstd.NewDictionary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mw, err := httpcompression.DefaultAdapter(
+		httpcompression.DictionaryCompressor(dictionary.Zstd, 1000, dc),
+		httpcompression.DictionariesFrom(store),
+		httpcompression.SampleResponses(tr),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/dict/", tr)
+	i := 0
+	mux.HandleFunc("/api/users", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(trainerBody(i)))
+	})
+	h := mw(mux)
+
+	get := func(path string, header ...string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		r.Header.Set("Accept-Encoding", "zstd, dcz")
+		for j := 0; j < len(header); j += 2 {
+			r.Header.Set(header[j], header[j+1])
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	for ; i < 40; i++ {
+		if ce := get("/api/users").Header().Get("Content-Encoding"); ce != "zstd" {
+			t.Fatalf("unexpected Content-Encoding: %q", ce)
+		}
+	}
+	if err := tr.Train(); err != nil {
+		t.Fatal(err)
+	}
+
+	w := get("/dict/users")
+	if w.Code != http.StatusOK || w.Header().Get(dictionary.UseAsDictionary) != `match="/api/*"` {
+		t.Fatalf("dictionary not served: %d %q", w.Code, w.Header().Get(dictionary.UseAsDictionary))
+	}
+	dict := w.Body.Bytes()
+	if w.Header().Get("Content-Encoding") == "zstd" {
+		dec, err := kpzstd.NewReader(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer dec.Close()
+		if dict, err = dec.DecodeAll(dict, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	d, err := dictionary.New(dict, trainerOptions("users"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w = get("/api/users", dictionary.AvailableDictionary, d.Hash().String())
+	if ce := w.Header().Get("Content-Encoding"); ce != dictionary.Zstd {
+		t.Fatalf("unexpected Content-Encoding: %q", ce)
+	}
+	body := w.Body.Bytes()
+	prefix := dictionary.Header(dictionary.Zstd, d.Hash())
+	if !bytes.HasPrefix(body, prefix) {
+		t.Fatal("missing dcz header")
+	}
+	ddec, err := kpzstd.NewReader(nil, kpzstd.WithDecoderDictRaw(0, dict))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ddec.Close()
+	got, err := ddec.DecodeAll(body[len(prefix):], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != trainerBody(i) {
+		t.Fatalf("unexpected body: %q", got)
+	}
+	if len(body) >= len(get("/api/users").Body.Bytes()) {
+		t.Fatal("dictionary does not reduce the size")
+	}
+}
+
+func TestTrainerOptions(t *testing.T) {
+	t.Parallel()
+
+	store, err := dictionary.NewMemoryStore(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		store *dictionary.MemoryStore
+		opts  zstd.TrainerOptions
+	}{
+		{nil, zstd.TrainerOptions{Dictionary: trainerOptions}},
+		{store, zstd.TrainerOptions{}},
+		{store, zstd.TrainerOptions{Dictionary: trainerOptions, Rate: 2}},
+		{store, zstd.TrainerOptions{Dictionary: trainerOptions, Holdout: 1}},
+		{store, zstd.TrainerOptions{Dictionary: trainerOptions, Threshold: -1}},
+		{store, zstd.TrainerOptions{Dictionary: trainerOptions, MaxSamples: -1}},
+		{store, zstd.TrainerOptions{Dictionary: trainerOptions, MaxSamples: 10, MinSamples: 20}},
+	} {
+		if _, err := zstd.NewTrainer(c.store, c.opts); err == nil {
+			t.Fatalf("%+v: no error", c.opts)
+		}
+	}
+
+	tr, _ := newTrainer(t, zstd.TrainerOptions{Dictionary: trainerOptions, Rate: 1, MaxKeys: 1, MaxSampleSize: 4})
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	w := tr.Sample(r, contentType("text/html"))
+	if n, err := w.Write([]byte("truncated")); n != 9 || err != nil {
+		t.Fatalf("Write: %d, %v", n, err)
+	}
+	w.Close()
+	if tr.Sample(r, contentType("text/css")) != nil {
+		t.Fatal("sampled more than MaxKeys keys")
+	}
+	if tr.Sample(r, contentType("")) != nil {
+		t.Fatal("sampled response without key")
+	}
+	if tr.Sample(r, contentType("text/html")) == nil {
+		t.Fatal("not sampled")
+	}
+}
+
+func TestTrainerFilter(t *testing.T) {
+	t.Parallel()
+
+	tr, _ := newTrainer(t, zstd.TrainerOptions{Dictionary: trainerOptions, Rate: 1})
+	for _, c := range []struct {
+		req, res http.Header
+		sampled  bool
+	}{
+		{nil, nil, true},
+		{nil, http.Header{"Cache-Control": {"public, max-age=60"}}, true},
+		{http.Header{"Authorization": {"Bearer token"}}, nil, false},
+		{http.Header{"Cookie": {"session=secret"}}, nil, false},
+		{nil, http.Header{"Set-Cookie": {"session=secret"}}, false},
+		{nil, http.Header{"Cache-Control": {"Private"}}, false},
+		{nil, http.Header{"Cache-Control": {"max-age=60, no-store"}}, false},
+		{nil, http.Header{"Cache-Control": {"max-age=60", `private="Set-Cookie"`}}, false},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		for k, v := range c.req {
+			r.Header[k] = v
+		}
+		h := contentType("text/html")
+		for k, v := range c.res {
+			h[k] = v
+		}
+		if w := tr.Sample(r, h); (w != nil) != c.sampled {
+			t.Errorf("%v %v: sampled %v", c.req, c.res, w != nil)
+		} else if w != nil {
+			w.Close()
+		}
+	}
+
+	tr, _ = newTrainer(t, zstd.TrainerOptions{
+		Dictionary: trainerOptions,
+		Rate:       1,
+		Filter:     func(*http.Request, http.Header) bool { return true },
+	})
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "Bearer token")
+	w := tr.Sample(r, contentType("text/html"))
+	if w == nil {
+		t.Fatal("not sampled with custom Filter")
+	}
+	w.Close()
+}
+
+// variedBody returns a JSON document made of a random subset of the fields of
+// a schema, so that each document contains only part of the common content.
+func variedBody(rnd *rand.Rand) string {
+	var b strings.Builder
+	b.WriteString("{")
+	for f := 0; f < 40; f++ {
+		if rnd.Intn(4) != 0 {
+			continue
+		}
+		if b.Len() > 1 {
+			b.WriteString(",")
+		}
+		fmt.Fprintf(&b, `"field_%d_%s":{"value":%d,"unit":"unit_%d","description":"description of the field number %d"}`,
+			f, strings.Repeat(string(rune('a'+f%26)), 5), rnd.Intn(1000), f%7, f)
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+// TestBuildDictionary checks the compression ratio of the trained dictionaries.
+func TestBuildDictionary(t *testing.T) {
+	t.Parallel()
+
+	rnd := rand.New(rand.NewSource(0))
+	bodies := map[string]func(i int) string{
+		"similar": trainerBody,
+		"varied":  func(int) string { return variedBody(rnd) },
+	}
+	compressedSize := func(t *testing.T, samples [][]byte, dict []byte) int {
+		opts := []kpzstd.EOption{kpzstd.WithEncoderConcurrency(1)}
+		if dict != nil {
+			opts = append(opts, kpzstd.WithEncoderDictRaw(0, dict))
+		}
+		enc, err := kpzstd.NewWriter(nil, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer enc.Close()
+		n := 0
+		for _, s := range samples {
+			n += len(enc.EncodeAll(s, nil))
+		}
+		return n
+	}
+	for name, body := range bodies {
+		var training, holdout [][]byte
+		for i := 0; i < 200; i++ {
+			if i%5 == 0 {
+				holdout = append(holdout, []byte(body(i)))
+			} else {
+				training = append(training, []byte(body(i)))
+			}
+		}
+		for _, size := range []int{1 << 10, 4 << 10} {
+			trained, err := zstd.BuildDictionary(training, size)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(trained) == 0 || len(trained) > size {
+				t.Fatalf("%s: unexpected dictionary size: %d", name, len(trained))
+			}
+			none := compressedSize(t, holdout, nil)
+			withTrained := compressedSize(t, holdout, trained)
+			t.Logf("%s, %d bytes: %d without dictionary, %d with the trained dictionary", name, size, none, withTrained)
+			if withTrained > none*3/4 {
+				t.Errorf("%s, %d bytes: the trained dictionary does not compress well enough", name, size)
+			}
+		}
+	}
+
+	// No dictionary can be trained from random samples.
+	random := make([][]byte, 20)
+	for i := range random {
+		random[i] = make([]byte, 500)
+		rnd.Read(random[i])
+	}
+	if d, err := zstd.BuildDictionary(random, 1<<10); err != nil || d != nil {
+		t.Fatalf("unexpected dictionary from random samples: %d bytes, %v", len(d), err)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"sync"
 
 	"github.com/CAFxX/httpcompression/contrib/internal/utils"
+	"github.com/CAFxX/httpcompression/dictionary"
 	"github.com/klauspost/compress/zstd"
 )
 
@@ -66,3 +67,124 @@ func (w *zstdWriter) Close() error {
 	w.c.pool.Put(w)
 	return err
 }
+
+type decompressor struct {
+	pool sync.Pool
+	opts []zstd.DOption
+}
+
+// NewDecompressor returns a DecompressorProvider for zstd.
+// Dictionaries can be specified with zstd.WithDecoderDicts, and the maximum
+// window size with zstd.WithDecoderMaxWindow.
+// As decoders are recycled, decoder concurrency is always set to 1.
+func NewDecompressor(opts ...zstd.DOption) (d *decompressor, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			d, err = nil, fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	opts = append(append([]zstd.DOption(nil), opts...), zstd.WithDecoderConcurrency(1))
+
+	tr, err := zstd.NewReader(nil, opts...)
+	if err != nil {
+		return nil, err
+	}
+	tr.Close()
+
+	d = &decompressor{opts: opts}
+	return d, nil
+}
+
+func (d *decompressor) Get(r io.Reader) io.ReadCloser {
+	if zr, ok := d.pool.Get().(*zstdReader); ok {
+		if err := zr.Reset(r); err != nil {
+			d.pool.Put(zr)
+			return utils.ErrorReadCloser{Err: err}
+		}
+		return zr
+	}
+	zr, err := zstd.NewReader(r, d.opts...)
+	if err != nil {
+		return utils.ErrorReadCloser{Err: err}
+	}
+	return &zstdReader{
+		Decoder: zr,
+		d:       d,
+	}
+}
+
+type zstdReader struct {
+	*zstd.Decoder
+	d *decompressor
+}
+
+func (r *zstdReader) Close() error {
+	err := r.Reset(nil)
+	r.d.pool.Put(r)
+	return err
+}
+
+type dictionaryCompressor struct {
+	opts []zstd.EOption
+}
+
+// NewDictionary returns a dictionary.Compressor for the dcz Content-Encoding
+// (dictionary.Zstd), that uses the dictionaries as raw content dictionaries.
+// The window size must not exceed the larger of 8MB and 1.25 times the size
+// of the dictionaries: the default window size is 8MB.
+func NewDictionary(opts ...zstd.EOption) (c *dictionaryCompressor, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			c, err = nil, fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	opts = append([]zstd.EOption(nil), opts...)
+
+	tw, err := zstd.NewWriter(io.Discard, append(opts, zstd.WithEncoderDictRaw(0, []byte("test")))...)
+	if err != nil {
+		return nil, err
+	}
+	if err := utils.CheckWriter(tw); err != nil {
+		return nil, fmt.Errorf("zstd: writer initialization: %w", err)
+	}
+
+	c = &dictionaryCompressor{opts: opts}
+	return c, nil
+}
+
+func (c *dictionaryCompressor) Get(w io.Writer, d *dictionary.Dictionary) io.WriteCloser {
+	// The encoders using the dictionary are pooled as long as the dictionary is in use.
+	pool := d.Prepared(c, newPool).(*sync.Pool)
+	if gw, ok := pool.Get().(*zstdDictionaryWriter); ok {
+		gw.Reset(w)
+		return gw
+	}
+	// The dictionary ID is 0, so that it is not included in the frame header,
+	// as required by the dcz Content-Encoding.
+	gw, err := zstd.NewWriter(w, append(c.opts[:len(c.opts):len(c.opts)], zstd.WithEncoderDictRaw(0, d.Data()))...)
+	if err != nil {
+		return utils.ErrorWriteCloser{Err: err}
+	}
+	return &zstdDictionaryWriter{
+		Encoder: gw,
+		pool:    pool,
+	}
+}
+
+func newPool(*dictionary.Dictionary) interface{} {
+	return &sync.Pool{}
+}
+
+type zstdDictionaryWriter struct {
+	*zstd.Encoder
+	pool *sync.Pool
+}
+
+func (w *zstdDictionaryWriter) Close() error {
+	err := w.Encoder.Close()
+	w.Reset(nil)
+	w.pool.Put(w)
+	return err
+}
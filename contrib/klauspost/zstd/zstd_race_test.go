@@ -14,3 +14,10 @@ func TestZstdRace(t *testing.T) {
 	c, _ := zstd.New()
 	internal.RaceTestCompressionProvider(c, 100)
 }
+
+func TestZstdDecompressorRace(t *testing.T) {
+	t.Parallel()
+	c, _ := zstd.New()
+	d, _ := zstd.NewDecompressor()
+	internal.RaceTestDecompressionProvider(c, d, 100)
+}
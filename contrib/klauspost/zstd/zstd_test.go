@@ -6,11 +6,15 @@ import (
 	"testing"
 
 	"github.com/CAFxX/httpcompression"
+	"github.com/CAFxX/httpcompression/contrib/internal"
 	"github.com/CAFxX/httpcompression/contrib/klauspost/zstd"
+	"github.com/CAFxX/httpcompression/dictionary"
 	kpzstd "github.com/klauspost/compress/zstd"
 )
 
 var _ httpcompression.CompressorProvider = &zstd.Compressor{}
+var _ httpcompression.DecompressorProvider = &zstd.Decompressor{}
+var _ dictionary.Compressor = &zstd.DictionaryCompressor{}
 
 func TestZstd(t *testing.T) {
 	t.Parallel()
@@ -38,3 +42,92 @@ func TestZstd(t *testing.T) {
 		t.Fatalf("decoded string mismatch\ngot: %q\nexp: %q", string(s), string(d))
 	}
 }
+
+func TestZstdDecompressor(t *testing.T) {
+	t.Parallel()
+
+	c, err := zstd.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := zstd.NewDecompressor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := internal.RoundTrip(c, d, []byte("hello world!")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestZstdDecompressorDictionary(t *testing.T) {
+	t.Parallel()
+
+	dict := []byte("hello world! this is a dictionary")
+
+	c, err := zstd.New(kpzstd.WithEncoderDictRaw(1234, dict))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := zstd.NewDecompressor(kpzstd.WithDecoderDictRaw(1234, dict))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := internal.RoundTrip(c, d, []byte("hello world! hello dictionary!")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestZstdDictionary(t *testing.T) {
+	t.Parallel()
+
+	data := []byte("hello world! this is a dictionary")
+	dict, err := dictionary.New(data, dictionary.Options{Match: "/*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := zstd.NewDictionary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ { // The second time, the writer is recycled.
+		s := []byte("hello world! hello dictionary!")
+		b := &bytes.Buffer{}
+		w := c.Get(b, dict)
+		w.Write(s)
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		var h kpzstd.Header
+		if err := h.Decode(b.Bytes()); err != nil {
+			t.Fatal(err)
+		}
+		if h.DictionaryID != 0 {
+			t.Fatalf("unexpected dictionary ID: %d", h.DictionaryID)
+		}
+
+		// The output can not be decoded without the dictionary.
+		plain, err := kpzstd.NewReader(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := plain.DecodeAll(b.Bytes(), nil); err == nil {
+			t.Fatal("decoded without dictionary")
+		}
+		plain.Close()
+
+		r, err := kpzstd.NewReader(b, kpzstd.WithDecoderDictRaw(0, data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		d, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(s, d) {
+			t.Fatalf("decoded string mismatch\ngot: %q\nexp: %q", string(d), string(s))
+		}
+	}
+}
@@ -1,3 +1,5 @@
 package lz4
 
 type Compressor = compressor
+
+type Decompressor = decompressor
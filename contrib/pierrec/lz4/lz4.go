@@ -67,3 +67,54 @@ func (w *writer) Close() error {
 	w.c.pool.Put(w)
 	return err
 }
+
+type decompressor struct {
+	pool sync.Pool
+	opts []lz4.Option
+}
+
+func NewDecompressor(opts ...lz4.Option) (d *decompressor, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			d, err = nil, fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	opts = append([]lz4.Option(nil), opts...)
+
+	tr := lz4.NewReader(nil)
+	err = tr.Apply(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("lz4: apply options: %w", err)
+	}
+
+	d = &decompressor{opts: opts}
+	return d, nil
+}
+
+func (d *decompressor) Get(r io.Reader) io.ReadCloser {
+	if lr, ok := d.pool.Get().(*reader); ok {
+		lr.Reset(r)
+		return lr
+	}
+	lr := lz4.NewReader(r)
+	err := lr.Apply(d.opts...)
+	if err != nil {
+		return utils.ErrorReadCloser{Err: err}
+	}
+	return &reader{
+		Reader: lr,
+		d:      d,
+	}
+}
+
+type reader struct {
+	*lz4.Reader
+	d *decompressor
+}
+
+func (r *reader) Close() error {
+	r.Reset(nil)
+	r.d.pool.Put(r)
+	return nil
+}
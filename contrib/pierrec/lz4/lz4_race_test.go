@@ -15,3 +15,10 @@ func TestLz4Race(t *testing.T) {
 	c, _ := lz4.New()
 	internal.RaceTestCompressionProvider(c, 100)
 }
+
+func TestLz4DecompressorRace(t *testing.T) {
+	t.Parallel()
+	c, _ := lz4.New()
+	d, _ := lz4.NewDecompressor()
+	internal.RaceTestDecompressionProvider(c, d, 100)
+}
@@ -6,11 +6,13 @@ import (
 	"testing"
 
 	"github.com/CAFxX/httpcompression"
+	"github.com/CAFxX/httpcompression/contrib/internal"
 	"github.com/CAFxX/httpcompression/contrib/pierrec/lz4"
 	plz4 "github.com/pierrec/lz4/v4"
 )
 
 var _ httpcompression.CompressorProvider = &lz4.Compressor{}
+var _ httpcompression.DecompressorProvider = &lz4.Decompressor{}
 
 func TestLz4(t *testing.T) {
 	t.Parallel()
@@ -35,3 +37,19 @@ func TestLz4(t *testing.T) {
 		t.Fatalf("decoded string mismatch\ngot: %q\nexp: %q", string(s), string(d))
 	}
 }
+
+func TestLz4Decompressor(t *testing.T) {
+	t.Parallel()
+
+	c, err := lz4.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := lz4.NewDecompressor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := internal.RoundTrip(c, d, []byte("hello world!")); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,3 +1,5 @@
 package xz
 
 type Compressor = compressor
+
+type Decompressor = decompressor
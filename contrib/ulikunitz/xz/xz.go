@@ -43,3 +43,34 @@ func (c *compressor) Get(w io.Writer) io.WriteCloser {
 type xzWriter struct {
 	*xz.Writer
 }
+
+type decompressor struct {
+	opts xz.ReaderConfig
+}
+
+// NewDecompressor returns a DecompressorProvider for xz.
+// Note that opts.DictCap is not a limit: if the stream declares a larger
+// dictionary, the larger dictionary is used. To limit the dictionary size
+// use limit.XZDictionary.
+func NewDecompressor(opts xz.ReaderConfig) (*decompressor, error) {
+	if err := opts.Verify(); err != nil {
+		return nil, fmt.Errorf("xz: reader initialization: %w", err)
+	}
+	return &decompressor{opts: opts}, nil
+}
+
+func (d *decompressor) Get(r io.Reader) io.ReadCloser {
+	xr, err := d.opts.NewReader(r)
+	if err != nil {
+		return utils.ErrorReadCloser{Err: err}
+	}
+	return xzReader{xr}
+}
+
+type xzReader struct {
+	*xz.Reader
+}
+
+func (xzReader) Close() error {
+	return nil
+}
@@ -16,3 +16,10 @@ func TestXzRace(t *testing.T) {
 	c, _ := xz.New(pxz.WriterConfig{})
 	internal.RaceTestCompressionProvider(c, 100)
 }
+
+func TestXzDecompressorRace(t *testing.T) {
+	t.Parallel()
+	c, _ := xz.New(pxz.WriterConfig{})
+	d, _ := xz.NewDecompressor(pxz.ReaderConfig{})
+	internal.RaceTestDecompressionProvider(c, d, 100)
+}
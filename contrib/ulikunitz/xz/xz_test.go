@@ -6,11 +6,13 @@ import (
 	"testing"
 
 	"github.com/CAFxX/httpcompression"
+	"github.com/CAFxX/httpcompression/contrib/internal"
 	"github.com/CAFxX/httpcompression/contrib/ulikunitz/xz"
 	pxz "github.com/ulikunitz/xz"
 )
 
 var _ httpcompression.CompressorProvider = &xz.Compressor{}
+var _ httpcompression.DecompressorProvider = &xz.Decompressor{}
 
 func TestXz(t *testing.T) {
 	t.Parallel()
@@ -38,3 +40,19 @@ func TestXz(t *testing.T) {
 		t.Fatalf("decoded string mismatch\ngot: %q\nexp: %q", string(s), string(d))
 	}
 }
+
+func TestXzDecompressor(t *testing.T) {
+	t.Parallel()
+
+	c, err := xz.New(pxz.WriterConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := xz.NewDecompressor(pxz.ReaderConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := internal.RoundTrip(c, d, []byte("hello world!")); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,3 +1,5 @@
 package gozstd
 
 type Compressor = compressor
+
+type Decompressor = decompressor
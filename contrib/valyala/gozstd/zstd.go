@@ -57,3 +57,36 @@ func (w *zstdWriter) Close() error {
 	w.c.pool.Put(w)
 	return err
 }
+
+type decompressor struct {
+	pool sync.Pool
+	dict *gozstd.DDict
+}
+
+// NewDecompressor returns a DecompressorProvider for zstd.
+// dict is the (optional) dictionary to be used for decompression.
+func NewDecompressor(dict *gozstd.DDict) (*decompressor, error) {
+	return &decompressor{dict: dict}, nil
+}
+
+func (d *decompressor) Get(r io.Reader) io.ReadCloser {
+	if zr, ok := d.pool.Get().(*zstdReader); ok {
+		zr.Reset(r, d.dict)
+		return zr
+	}
+	return &zstdReader{
+		Reader: gozstd.NewReaderDict(r, d.dict),
+		d:      d,
+	}
+}
+
+type zstdReader struct {
+	*gozstd.Reader
+	d *decompressor
+}
+
+func (r *zstdReader) Close() error {
+	r.Reset(nil, r.d.dict) // drop reference to parent reader
+	r.d.pool.Put(r)
+	return nil
+}
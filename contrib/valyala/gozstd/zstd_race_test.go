@@ -16,3 +16,10 @@ func TestZstdRace(t *testing.T) {
 	c, _ := gozstd.New(vzstd.WriterParams{})
 	internal.RaceTestCompressionProvider(c, 100)
 }
+
+func TestZstdDecompressorRace(t *testing.T) {
+	t.Parallel()
+	c, _ := gozstd.New(vzstd.WriterParams{})
+	d, _ := gozstd.NewDecompressor(nil)
+	internal.RaceTestDecompressionProvider(c, d, 100)
+}
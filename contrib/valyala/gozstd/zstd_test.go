@@ -2,15 +2,18 @@ package gozstd_test
 
 import (
 	"bytes"
+	"fmt"
 	"io/ioutil"
 	"testing"
 
 	"github.com/CAFxX/httpcompression"
+	"github.com/CAFxX/httpcompression/contrib/internal"
 	"github.com/CAFxX/httpcompression/contrib/valyala/gozstd"
 	vzstd "github.com/valyala/gozstd"
 )
 
 var _ httpcompression.CompressorProvider = &gozstd.Compressor{}
+var _ httpcompression.DecompressorProvider = &gozstd.Decompressor{}
 
 func TestZstd(t *testing.T) {
 	t.Parallel()
@@ -38,3 +41,49 @@ func TestZstd(t *testing.T) {
 		t.Fatalf("decoded string mismatch\ngot: %q\nexp: %q", string(s), string(d))
 	}
 }
+
+func TestZstdDecompressor(t *testing.T) {
+	t.Parallel()
+
+	c, err := gozstd.New(vzstd.WriterParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := gozstd.NewDecompressor(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := internal.RoundTrip(c, d, []byte("hello world!")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestZstdDecompressorDictionary(t *testing.T) {
+	t.Parallel()
+
+	var samples [][]byte
+	for i := 0; i < 1000; i++ {
+		samples = append(samples, []byte(fmt.Sprintf("hello world %d! this is sample %d", i, i*i)))
+	}
+	dict := vzstd.BuildDict(samples, 1024)
+	cd, err := vzstd.NewCDict(dict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dd, err := vzstd.NewDDict(dict)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := gozstd.New(vzstd.WriterParams{Dict: cd})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := gozstd.NewDecompressor(dd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := internal.RoundTrip(c, d, []byte("hello world 42! this is sample 1764")); err != nil {
+		t.Fatal(err)
+	}
+}
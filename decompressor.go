@@ -0,0 +1,35 @@
+package httpcompression
+
+import (
+	"io"
+)
+
+// DecompressorProvider is the interface for decompression implementations.
+// It is the counterpart of CompressorProvider.
+type DecompressorProvider interface {
+	// Get returns a reader that reads decompressed data from the supplied parent io.Reader.
+	// Callers of Get() must ensure to always call Close() when the decompressor is not needed
+	// anymore. Callers of Close() must also ensure to not use the io.ReadCloser once Close()
+	// is called. Close() does not close the parent io.Reader.
+	// Implementations of DecompressorProvider are allowed to recycle the decompressor (e.g. put
+	// the ReadCloser in a pool to be reused by a later call to Get) when Close() is called.
+	// If the decompressor can not be initialized (e.g. because the parent io.Reader does not
+	// contain a valid header), the error is returned by the calls to Read.
+	Get(parent io.Reader) (decompressor io.ReadCloser)
+}
+
+// Decompressor returns an Option that sets the DecompressorProvider for a specific
+// Content-Encoding. If multiple DecompressorProviders are set for the same Content-Encoding,
+// the last one is used. If decompressor is nil, it disables the specified Content-Encoding.
+// DecompressorProviders are used by RequestDecompressor; if no DecompressorProvider is set for
+// a Content-Encoding for which a CompressorProvider is set, a default DecompressorProvider is
+// used if the Content-Encoding is one of the standard ones (gzip, deflate, br and zstd).
+func Decompressor(contentEncoding string, decompressor DecompressorProvider) Option {
+	return func(c *config) error {
+		if c.decompressor == nil {
+			c.decompressor = map[string]DecompressorProvider{}
+		}
+		c.decompressor[contentEncoding] = decompressor
+		return nil
+	}
+}
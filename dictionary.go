@@ -0,0 +1,138 @@
+package httpcompression
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/CAFxX/httpcompression/dictionary"
+)
+
+// DictionaryStore is a registry of the dictionaries that can be used by the
+// DictionaryCompressor encodings. See dictionary.MemoryStore.
+type DictionaryStore = dictionary.Store
+
+// DictionaryCompressor is an option to enable a Content-Encoding that compresses
+// using a dictionary, with the specified priority. The encoding is used only for
+// the requests whose Available-Dictionary header refers to one of the dictionaries
+// in the DictionaryStore, as specified by Compression Dictionary Transport (RFC 9842).
+// For the standard encodings, i.e. dictionary.Zstd ("dcz") and dictionary.Brotli
+// ("dcb"), the responses are prefixed with the header required by the encoding;
+// other encodings (e.g. deflate with a dictionary) are not supported by browsers,
+// and are only useful with custom clients.
+// As they are much smaller, dictionary encodings should normally have the highest
+// priority. Responses compressed with a dictionary are not stored in the ResponseCache.
+// If compressor is nil the encoding is disabled.
+func DictionaryCompressor(encoding string, priority int, compressor dictionary.Compressor) Option {
+	return func(c *config) error {
+		if compressor == nil {
+			delete(c.compressor, encoding)
+			return nil
+		}
+		c.compressor[encoding] = comp{dict: compressor, priority: priority}
+		return nil
+	}
+}
+
+// ContentTypeDictionaryCompressor is like ContentTypeCompressor, for the encodings
+// enabled with DictionaryCompressor: it sets the dictionary.Compressor used for
+// the responses whose Content-Type matches one of contentTypes.
+func ContentTypeDictionaryCompressor(encoding string, contentTypes []string, compressor dictionary.Compressor) Option {
+	if compressor == nil {
+		return errorOption(fmt.Errorf("nil content type compressor for %q", encoding))
+	}
+	return contentTypeComp(encoding, contentTypes, comp{dict: compressor})
+}
+
+// DictionariesFrom is an option to specify the DictionaryStore holding the
+// dictionaries that can be used by the DictionaryCompressor encodings.
+// The active dictionaries with a Path are advertised with the Use-As-Dictionary
+// header in the responses to the GET requests for that path, if the client
+// accepts one of the dictionary encodings.
+func DictionariesFrom(store DictionaryStore) Option {
+	return func(c *config) error {
+		if store == nil {
+			return fmt.Errorf("nil dictionary store")
+		}
+		c.dictionaries = store
+		return nil
+	}
+}
+
+// Dictionaries is like DictionariesFrom, with a DictionaryStore holding only
+// the specified dictionaries.
+func Dictionaries(dicts ...*dictionary.Dictionary) Option {
+	store, err := dictionary.NewMemoryStore(0)
+	if err != nil {
+		return errorOption(err)
+	}
+	for _, d := range dicts {
+		if d == nil {
+			return errorOption(fmt.Errorf("nil dictionary"))
+		}
+		store.Add(d.Hash().String(), d)
+	}
+	return DictionariesFrom(store)
+}
+
+// availableDictionary returns the dictionary referred to by the Available-Dictionary
+// (and Dictionary-ID) header of the request, or nil if there is none.
+func (c *config) availableDictionary(r *http.Request) *dictionary.Dictionary {
+	if c.dictionaries == nil {
+		return nil
+	}
+	h, ok := dictionary.ParseHash(r.Header.Get(dictionary.AvailableDictionary))
+	if !ok {
+		return nil
+	}
+	d, ok := c.dictionaries.Get(h)
+	if !ok || !d.MatchID(r.Header.Get(dictionary.DictionaryID)) {
+		return nil
+	}
+	return d
+}
+
+// announcedDictionary returns the active dictionary that is the content of the
+// response to the request, or nil if there is none.
+func (c *config) announcedDictionary(r *http.Request) *dictionary.Dictionary {
+	if c.dictionaries == nil || r.Method != http.MethodGet {
+		return nil
+	}
+	for _, d := range c.dictionaries.Active() {
+		if d.Path() != "" && d.Path() == r.URL.Path {
+			return d
+		}
+	}
+	return nil
+}
+
+// announceDictionary adds the Use-As-Dictionary header to successful responses
+// that have a dictionary as content.
+func (w *compressWriter) announceDictionary() {
+	if w.announce != nil && (w.code == 0 || w.code == http.StatusOK) {
+		w.Header().Set(dictionary.UseAsDictionary, w.announce.UseAsDictionary())
+	}
+}
+
+// SampleResponses is an option to send a copy of the uncompressed body of the
+// compressed responses to the specified Sampler, e.g. to train dictionaries
+// from the live traffic (see zstd.Trainer in contrib/klauspost/zstd).
+// All the compressed responses are passed to the Sampler, including the ones
+// that contain private data (e.g. the responses to authenticated requests): the
+// Sampler must skip them if the data it collects, like a dictionary, is shared
+// with other clients.
+func SampleResponses(s dictionary.Sampler) Option {
+	return func(c *config) error {
+		if s == nil {
+			return fmt.Errorf("nil sampler")
+		}
+		c.sampler = s
+		return nil
+	}
+}
+
+// sampleBody sends b to the Sampler, if the response is sampled.
+func (w *compressWriter) sampleBody(b []byte) {
+	if w.sample != nil && len(b) > 0 {
+		w.sample.Write(b)
+	}
+}
@@ -0,0 +1,275 @@
+// Package dictionary implements the parts of Compression Dictionary Transport
+// (RFC 9842) that are independent of the compression algorithm: the dictionaries
+// and their hashes, the HTTP headers used to advertise and select them, and the
+// headers that prefix the responses compressed with a dictionary.
+//
+// The dictionaries are used by the middleware (see httpcompression.Dictionaries)
+// with the compressors implementing Compressor, e.g. the one in
+// contrib/klauspost/zstd for the dcz Content-Encoding.
+package dictionary
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const (
+	// Zstd is the Content-Encoding of the responses compressed with Zstandard
+	// using a dictionary.
+	Zstd = "dcz"
+	// Brotli is the Content-Encoding of the responses compressed with Brotli
+	// using a dictionary.
+	Brotli = "dcb"
+)
+
+const (
+	// UseAsDictionary is the response header that tells the client that the
+	// response can be used as a dictionary for later requests.
+	UseAsDictionary = "Use-As-Dictionary"
+	// AvailableDictionary is the request header containing the hash of the
+	// dictionary available to the client.
+	AvailableDictionary = "Available-Dictionary"
+	// DictionaryID is the request header containing the ID of the dictionary
+	// available to the client, if the dictionary has one.
+	DictionaryID = "Dictionary-ID"
+)
+
+// maxID is the maximum length of the ID of a dictionary.
+const maxID = 1024
+
+// Hash is the SHA-256 hash of a dictionary, that identifies it.
+type Hash [sha256.Size]byte
+
+// String returns the hash as a Structured Field byte sequence, i.e. in the
+// format used by the Available-Dictionary header.
+func (h Hash) String() string {
+	return ":" + base64.StdEncoding.EncodeToString(h[:]) + ":"
+}
+
+// ParseHash parses the value of the Available-Dictionary header.
+func ParseHash(s string) (h Hash, ok bool) {
+	s = strings.TrimSpace(s)
+	if len(s) < 2 || s[0] != ':' || s[len(s)-1] != ':' {
+		return h, false
+	}
+	b, err := base64.StdEncoding.DecodeString(s[1 : len(s)-1])
+	if err != nil || len(b) != len(h) {
+		return h, false
+	}
+	copy(h[:], b)
+	return h, true
+}
+
+// Options are the options of a Dictionary.
+type Options struct {
+	// Match is the URL pattern of the requests for which the client can use the
+	// dictionary (see RFC 9842, section 2.1.1), e.g. "/js/app.*.js". It is required.
+	Match string
+	// MatchDest are the request destinations (i.e. the values of Sec-Fetch-Dest)
+	// for which the client can use the dictionary, e.g. "script". If empty, the
+	// dictionary can be used for all destinations.
+	MatchDest []string
+	// ID is an opaque identifier of the dictionary, that clients send back in the
+	// Dictionary-ID header. It is optional.
+	ID string
+	// Path is the path of the resource that has the dictionary as content: the
+	// Use-As-Dictionary header is added to the successful responses to GET requests
+	// for this path from clients that support dictionaries. If empty, the dictionary
+	// must be advertised by other means.
+	Path string
+}
+
+// Dictionary is a compression dictionary.
+type Dictionary struct {
+	data   []byte
+	hash   Hash
+	opts   Options
+	header string
+
+	prepared sync.Map // Values returned by Prepared.
+}
+
+// New returns a Dictionary with the specified content, that must not be modified
+// afterwards.
+func New(data []byte, opts Options) (*Dictionary, error) {
+	if opts.Match == "" {
+		return nil, errors.New("dictionary: match is required")
+	}
+	if len(opts.ID) > maxID {
+		return nil, fmt.Errorf("dictionary: id is too long: %d (maximum %d)", len(opts.ID), maxID)
+	}
+	header, err := useAsDictionary(opts)
+	if err != nil {
+		return nil, err
+	}
+	opts.MatchDest = append([]string(nil), opts.MatchDest...)
+	return &Dictionary{
+		data:   data,
+		hash:   sha256.Sum256(data),
+		opts:   opts,
+		header: header,
+	}, nil
+}
+
+// Data returns the content of the dictionary.
+func (d *Dictionary) Data() []byte {
+	return d.data
+}
+
+// Hash returns the SHA-256 hash of the content of the dictionary.
+func (d *Dictionary) Hash() Hash {
+	return d.hash
+}
+
+// ID returns the ID of the dictionary, if any.
+func (d *Dictionary) ID() string {
+	return d.opts.ID
+}
+
+// Path returns the path of the resource that has the dictionary as content, if any.
+func (d *Dictionary) Path() string {
+	return d.opts.Path
+}
+
+// UseAsDictionary returns the value of the Use-As-Dictionary header for the
+// responses that have the dictionary as content.
+func (d *Dictionary) UseAsDictionary() string {
+	return d.header
+}
+
+// Prepared returns the value prepared for the dictionary by the compressor
+// identified by key, calling prepare to create it the first time. It allows the
+// compressors to keep the state derived from the dictionary (e.g. a pool of
+// encoders using it) for as long as the dictionary is in use.
+func (d *Dictionary) Prepared(key interface{}, prepare func(*Dictionary) interface{}) interface{} {
+	if v, ok := d.prepared.Load(key); ok {
+		return v
+	}
+	v, _ := d.prepared.LoadOrStore(key, prepare(d))
+	return v
+}
+
+// MatchID returns true if the value id of the Dictionary-ID header of a request
+// whose Available-Dictionary is the hash of d refers to d.
+func (d *Dictionary) MatchID(id string) bool {
+	if id == "" || d.opts.ID == "" {
+		return true
+	}
+	s, ok := parseString(id)
+	return ok && s == d.opts.ID
+}
+
+// useAsDictionary returns the value of the Use-As-Dictionary header, a Structured
+// Field dictionary.
+func useAsDictionary(opts Options) (string, error) {
+	var sb strings.Builder
+	sb.WriteString("match=")
+	if err := writeString(&sb, opts.Match); err != nil {
+		return "", fmt.Errorf("dictionary: match: %w", err)
+	}
+	if len(opts.MatchDest) > 0 {
+		sb.WriteString(", match-dest=(")
+		for i, dest := range opts.MatchDest {
+			if i > 0 {
+				sb.WriteByte(' ')
+			}
+			if err := writeString(&sb, dest); err != nil {
+				return "", fmt.Errorf("dictionary: match-dest: %w", err)
+			}
+		}
+		sb.WriteByte(')')
+	}
+	if opts.ID != "" {
+		sb.WriteString(", id=")
+		if err := writeString(&sb, opts.ID); err != nil {
+			return "", fmt.Errorf("dictionary: id: %w", err)
+		}
+	}
+	return sb.String(), nil
+}
+
+// writeString writes s as a Structured Field string.
+func writeString(sb *strings.Builder, s string) error {
+	sb.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < 0x20 || c > 0x7e {
+			return fmt.Errorf("invalid character %q", c)
+		}
+		if c == '"' || c == '\\' {
+			sb.WriteByte('\\')
+		}
+		sb.WriteByte(c)
+	}
+	sb.WriteByte('"')
+	return nil
+}
+
+// parseString parses a Structured Field string.
+func parseString(s string) (string, bool) {
+	s = strings.TrimSpace(s)
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return "", false
+	}
+	s = s[1 : len(s)-1]
+	if strings.IndexByte(s, '\\') < 0 {
+		return s, true
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '\\' {
+			i++
+			if i == len(s) || s[i] != '"' && s[i] != '\\' {
+				return "", false
+			}
+			c = s[i]
+		}
+		sb.WriteByte(c)
+	}
+	return sb.String(), true
+}
+
+// Header returns the header that prefixes the responses compressed with the
+// dictionary with hash h using the Content-Encoding encoding, or nil if the
+// Content-Encoding is not one of Zstd and Brotli.
+func Header(encoding string, h Hash) []byte {
+	b := make([]byte, 0, 8+len(h))
+	switch encoding {
+	case Zstd:
+		// A Zstandard skippable frame containing the hash.
+		b = append(b, 0x5e, 0x2a, 0x4d, 0x18, 0x20, 0x00, 0x00, 0x00)
+	case Brotli:
+		b = append(b, 0xff, 0x44, 0x43, 0x42)
+	default:
+		return nil
+	}
+	return append(b, h[:]...)
+}
+
+// Compressor is implemented by the compressors that can compress using a
+// dictionary. The dictionary is used as raw content, i.e. as if it preceded
+// the data being compressed.
+type Compressor interface {
+	// Get returns a writer that writes to w the data compressed using the
+	// dictionary d. The header returned by Header is written by the caller.
+	// Callers of Get() must ensure to always call Close() when the compressor
+	// is not needed anymore, like for CompressorProvider.
+	Get(w io.Writer, d *Dictionary) io.WriteCloser
+}
+
+// Sampler receives copies of the uncompressed bodies of the responses, e.g. to
+// build dictionaries from them. Implementations must be safe for concurrent use.
+type Sampler interface {
+	// Sample returns a writer that receives a copy of the uncompressed body of the
+	// response to r, whose header is header, or nil if the response must not be
+	// sampled. The writer is closed once the whole body has been written. Errors
+	// returned by the writer are ignored. The header must not be modified.
+	Sample(r *http.Request, header http.Header) io.WriteCloser
+}
@@ -0,0 +1,136 @@
+package dictionary_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"strings"
+	"testing"
+
+	"github.com/CAFxX/httpcompression/dictionary"
+)
+
+func TestHash(t *testing.T) {
+	t.Parallel()
+
+	h := dictionary.Hash(sha256.Sum256([]byte("dictionary")))
+	s := h.String()
+	if !strings.HasPrefix(s, ":") || !strings.HasSuffix(s, ":") {
+		t.Fatalf("not a byte sequence: %q", s)
+	}
+	for _, v := range []string{s, " " + s + " "} {
+		if p, ok := dictionary.ParseHash(v); !ok || p != h {
+			t.Fatalf("ParseHash(%q) = %v, %v", v, p, ok)
+		}
+	}
+	for _, v := range []string{"", "::", s[1:], s[:len(s)-1], ":aGVsbG8=:", ":!" + s[2:]} {
+		if _, ok := dictionary.ParseHash(v); ok {
+			t.Fatalf("ParseHash(%q) succeeded", v)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		opts   dictionary.Options
+		header string
+	}{
+		{dictionary.Options{Match: "/js/app.*.js"}, `match="/js/app.*.js"`},
+		{dictionary.Options{Match: "/*", MatchDest: []string{"script", "style"}}, `match="/*", match-dest=("script" "style")`},
+		{dictionary.Options{Match: "/*", ID: `v1 "quoted" \`}, `match="/*", id="v1 \"quoted\" \\"`},
+		{dictionary.Options{}, ""},
+		{dictionary.Options{Match: "/\n"}, ""},
+		{dictionary.Options{Match: "/*", MatchDest: []string{"é"}}, ""},
+		{dictionary.Options{Match: "/*", ID: strings.Repeat("x", 1025)}, ""},
+	}
+	for _, c := range cases {
+		d, err := dictionary.New([]byte("dictionary"), c.opts)
+		if c.header == "" {
+			if err == nil {
+				t.Fatalf("%+v: no error", c.opts)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%+v: %v", c.opts, err)
+		}
+		if got := d.UseAsDictionary(); got != c.header {
+			t.Fatalf("%+v: got %q, exp %q", c.opts, got, c.header)
+		}
+		if d.Hash() != sha256.Sum256([]byte("dictionary")) {
+			t.Fatalf("%+v: wrong hash", c.opts)
+		}
+	}
+}
+
+func TestMatchID(t *testing.T) {
+	t.Parallel()
+
+	d, err := dictionary.New(nil, dictionary.Options{Match: "/*", ID: `v"1`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, exp := range map[string]bool{"": true, `"v\"1"`: true, `"v1"`: false, `v"1`: false, `"v\1"`: false} {
+		if got := d.MatchID(id); got != exp {
+			t.Fatalf("MatchID(%q) = %v", id, got)
+		}
+	}
+
+	d, err = dictionary.New(nil, dictionary.Options{Match: "/*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !d.MatchID(`"v1"`) {
+		t.Fatal("dictionary without ID does not match")
+	}
+}
+
+func TestHeader(t *testing.T) {
+	t.Parallel()
+
+	var h dictionary.Hash
+	for i := range h {
+		h[i] = byte(i)
+	}
+	cases := map[string][]byte{
+		dictionary.Zstd:   {0x5e, 0x2a, 0x4d, 0x18, 0x20, 0x00, 0x00, 0x00},
+		dictionary.Brotli: {0xff, 0x44, 0x43, 0x42},
+		"zstd":            nil,
+	}
+	for enc, magic := range cases {
+		got := dictionary.Header(enc, h)
+		if magic == nil {
+			if got != nil {
+				t.Fatalf("%s: unexpected header", enc)
+			}
+			continue
+		}
+		if !bytes.Equal(got, append(magic, h[:]...)) {
+			t.Fatalf("%s: got %x", enc, got)
+		}
+	}
+}
+
+func TestPrepared(t *testing.T) {
+	t.Parallel()
+
+	d, err := dictionary.New([]byte("dictionary"), dictionary.Options{Match: "/*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := 0
+	prepare := func(d *dictionary.Dictionary) interface{} {
+		calls++
+		return len(d.Data())
+	}
+	for i := 0; i < 3; i++ {
+		if v := d.Prepared("key", prepare); v != len("dictionary") {
+			t.Fatalf("unexpected value %v", v)
+		}
+	}
+	d.Prepared("other", prepare)
+	if calls != 2 {
+		t.Fatalf("prepare called %d times", calls)
+	}
+}
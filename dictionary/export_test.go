@@ -0,0 +1,7 @@
+package dictionary
+
+import "time"
+
+func SetNow(s *MemoryStore, now func() time.Time) {
+	s.now = now
+}
@@ -0,0 +1,164 @@
+package dictionary
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Store is a registry of dictionaries.
+// Implementations must be safe for concurrent use.
+type Store interface {
+	// Get returns the dictionary with hash h, if it can be used to compress
+	// responses, i.e. if it is active or it has been retired recently.
+	Get(h Hash) (*Dictionary, bool)
+	// Active returns the active dictionaries, i.e. the ones that are advertised
+	// to the clients. The returned slice must not be modified.
+	Active() []*Dictionary
+}
+
+// MemoryStore is a Store that holds multiple versions of named dictionaries.
+// For each name, only the latest version added is active: the previous ones
+// are retired, and can still be used by the clients that have them until the
+// grace period elapses.
+type MemoryStore struct {
+	grace time.Duration
+	now   func() time.Time
+
+	mu      sync.Mutex
+	entries map[Hash]*storeEntry
+	names   map[string]*Dictionary // Active version of each name.
+
+	// Read without holding mu.
+	snapshot atomic.Value // map[Hash]*storeEntry; replaced, never modified.
+	active   atomic.Value // []*Dictionary, sorted by name.
+}
+
+type storeEntry struct {
+	dict    *Dictionary
+	retired time.Time // Zero if the dictionary is active.
+}
+
+var _ Store = &MemoryStore{}
+
+// NewMemoryStore returns an empty MemoryStore, whose retired dictionaries can be
+// used for the specified grace period. The grace period should be at least as long
+// as the time the clients are allowed to cache the dictionaries.
+func NewMemoryStore(grace time.Duration) (*MemoryStore, error) {
+	if grace < 0 {
+		return nil, fmt.Errorf("dictionary: grace period can not be negative: %v", grace)
+	}
+	s := &MemoryStore{
+		grace:   grace,
+		now:     time.Now,
+		entries: map[Hash]*storeEntry{},
+		names:   map[string]*Dictionary{},
+	}
+	s.publish()
+	return s, nil
+}
+
+// Add adds d as the active version of the dictionary name, retiring the previous
+// version, if any. If d was retired, it becomes active again.
+func (s *MemoryStore) Add(name string, d *Dictionary) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	prev := s.names[name]
+	s.names[name] = d
+	s.entries[d.Hash()] = &storeEntry{dict: d}
+	if prev != nil && prev.Hash() != d.Hash() {
+		s.retire(prev, now)
+	}
+	s.purge(now)
+	s.publish()
+}
+
+// Retire retires the active version of the dictionary name, if any.
+func (s *MemoryStore) Retire(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	if d := s.names[name]; d != nil {
+		delete(s.names, name)
+		s.retire(d, now)
+	}
+	s.purge(now)
+	s.publish()
+}
+
+// Get implements Store.
+func (s *MemoryStore) Get(h Hash) (*Dictionary, bool) {
+	e := s.snapshot.Load().(map[Hash]*storeEntry)[h]
+	if e == nil {
+		return nil, false
+	}
+	if !e.retired.IsZero() && s.now().Sub(e.retired) >= s.grace {
+		s.mu.Lock()
+		s.purge(s.now())
+		s.publish()
+		s.mu.Unlock()
+		return nil, false
+	}
+	return e.dict, true
+}
+
+// Active implements Store.
+func (s *MemoryStore) Active() []*Dictionary {
+	return s.active.Load().([]*Dictionary)
+}
+
+// retire marks d as retired at now, unless it (or a dictionary with the same
+// content) is still the active version of another name. s.mu must be held.
+func (s *MemoryStore) retire(d *Dictionary, now time.Time) {
+	for _, a := range s.names {
+		if a.Hash() == d.Hash() {
+			return
+		}
+	}
+	if e := s.entries[d.Hash()]; e != nil {
+		s.entries[d.Hash()] = &storeEntry{dict: e.dict, retired: now}
+	}
+}
+
+// purge removes the dictionaries whose grace period has elapsed. s.mu must be held.
+func (s *MemoryStore) purge(now time.Time) {
+	for h, e := range s.entries {
+		if !e.retired.IsZero() && now.Sub(e.retired) >= s.grace {
+			delete(s.entries, h)
+		}
+	}
+}
+
+// publish makes the changes visible to Get and Active. s.mu must be held.
+func (s *MemoryStore) publish() {
+	snapshot := make(map[Hash]*storeEntry, len(s.entries))
+	for h, e := range s.entries {
+		snapshot[h] = e
+	}
+	s.snapshot.Store(snapshot)
+
+	names := make([]string, 0, len(s.names))
+	for name := range s.names {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	active := make([]*Dictionary, 0, len(names))
+	for _, name := range names {
+		if d := s.names[name]; !containsDictionary(active, d) {
+			active = append(active, d)
+		}
+	}
+	s.active.Store(active)
+}
+
+func containsDictionary(dicts []*Dictionary, d *Dictionary) bool {
+	for _, e := range dicts {
+		if e == d {
+			return true
+		}
+	}
+	return false
+}
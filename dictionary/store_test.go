@@ -0,0 +1,91 @@
+package dictionary_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/CAFxX/httpcompression/dictionary"
+)
+
+func newTestDictionary(t *testing.T, data string) *dictionary.Dictionary {
+	d, err := dictionary.New([]byte(data), dictionary.Options{Match: "/*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestMemoryStore(t *testing.T) {
+	t.Parallel()
+
+	s, err := dictionary.NewMemoryStore(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	dictionary.SetNow(s, func() time.Time { return now })
+
+	usable := func(d *dictionary.Dictionary) bool {
+		got, ok := s.Get(d.Hash())
+		if ok && got != d {
+			t.Fatalf("wrong dictionary")
+		}
+		return ok
+	}
+	active := func(exp ...*dictionary.Dictionary) {
+		t.Helper()
+		if got := s.Active(); !reflect.DeepEqual(got, append([]*dictionary.Dictionary{}, exp...)) {
+			t.Fatalf("active: got %d dictionaries, exp %d", len(got), len(exp))
+		}
+	}
+
+	v1, v2, css := newTestDictionary(t, "v1"), newTestDictionary(t, "v2"), newTestDictionary(t, "css")
+	active()
+	if usable(v1) {
+		t.Fatal("v1 usable before being added")
+	}
+
+	s.Add("js", v1)
+	s.Add("css", css)
+	active(css, v1)
+
+	// v2 replaces v1, that can still be used during the grace period.
+	s.Add("js", v2)
+	active(css, v2)
+	now = now.Add(59 * time.Minute)
+	if !usable(v1) || !usable(v2) {
+		t.Fatal("v1 or v2 not usable")
+	}
+	now = now.Add(time.Minute)
+	if usable(v1) || !usable(v2) {
+		t.Fatal("v1 usable after the grace period")
+	}
+
+	// Retired dictionaries can be added again.
+	s.Retire("js")
+	active(css)
+	if !usable(v2) {
+		t.Fatal("v2 not usable")
+	}
+	s.Add("js", v2)
+	now = now.Add(2 * time.Hour)
+	active(css, v2)
+	if !usable(v2) {
+		t.Fatal("v2 not usable")
+	}
+
+	// Dictionaries active for another name are not retired.
+	s.Add("js2", v2)
+	s.Retire("js")
+	now = now.Add(2 * time.Hour)
+	active(css, v2)
+	if !usable(v2) {
+		t.Fatal("v2 not usable")
+	}
+
+	_, err = dictionary.NewMemoryStore(-time.Second)
+	if err == nil {
+		t.Fatal("negative grace period accepted")
+	}
+}
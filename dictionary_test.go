@@ -0,0 +1,267 @@
+package httpcompression
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/CAFxX/httpcompression/contrib/klauspost/zstd"
+	"github.com/CAFxX/httpcompression/dictionary"
+	kpzstd "github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+)
+
+func newDictionaryHandler(t *testing.T, dicts ...*dictionary.Dictionary) http.Handler {
+	dc, err := zstd.NewDictionary()
+	assert.NoError(t, err)
+	mw, err := DefaultAdapter(
+		DictionaryCompressor(dictionary.Zstd, 1000, dc),
+		Dictionaries(dicts...),
+	)
+	assert.NoError(t, err)
+	return mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set(contentType, "text/plain")
+		w.Write([]byte(testBody))
+	}))
+}
+
+func TestDictionary(t *testing.T) {
+	t.Parallel()
+
+	dict, err := dictionary.New([]byte(testBody), dictionary.Options{Match: "/*", ID: "v1"})
+	assert.NoError(t, err)
+	other, err := dictionary.New([]byte("other"), dictionary.Options{Match: "/*"})
+	assert.NoError(t, err)
+	h := newDictionaryHandler(t, dict)
+
+	cases := []struct {
+		name     string
+		ae       string
+		hash     string
+		id       string
+		encoding string
+		vary     []string
+	}{
+		{"dictionary", "gzip, br, zstd, dcz", dict.Hash().String(), "", "dcz", []string{acceptEncoding, dictionary.AvailableDictionary}},
+		{"dictionary id", "gzip, br, zstd, dcz", dict.Hash().String(), `"v1"`, "dcz", []string{acceptEncoding, dictionary.AvailableDictionary}},
+		{"other id", "gzip, br, zstd, dcz", dict.Hash().String(), `"v2"`, "zstd", []string{acceptEncoding, dictionary.AvailableDictionary}},
+		{"no dictionary", "gzip, br, zstd, dcz", "", "", "zstd", []string{acceptEncoding, dictionary.AvailableDictionary}},
+		{"unknown dictionary", "gzip, br, zstd, dcz", other.Hash().String(), "", "zstd", []string{acceptEncoding, dictionary.AvailableDictionary}},
+		{"invalid hash", "gzip, br, zstd, dcz", "invalid", "", "zstd", []string{acceptEncoding, dictionary.AvailableDictionary}},
+		{"not accepted", "gzip, br, zstd", dict.Hash().String(), "", "zstd", []string{acceptEncoding}},
+		{"only dictionary", "dcz", "", "", "", []string{acceptEncoding, dictionary.AvailableDictionary}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set(acceptEncoding, c.ae)
+			if c.hash != "" {
+				r.Header.Set(dictionary.AvailableDictionary, c.hash)
+			}
+			if c.id != "" {
+				r.Header.Set(dictionary.DictionaryID, c.id)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			assert.Equal(t, c.encoding, w.Header().Get(contentEncoding))
+			assert.Equal(t, c.vary, w.Header().Values(vary))
+			assert.Empty(t, w.Header().Get(dictionary.UseAsDictionary))
+			if c.encoding != dictionary.Zstd {
+				return
+			}
+
+			body := w.Body.Bytes()
+			prefix := dictionary.Header(dictionary.Zstd, dict.Hash())
+			assert.True(t, bytes.HasPrefix(body, prefix))
+			d, err := kpzstd.NewReader(nil, kpzstd.WithDecoderDictRaw(0, dict.Data()))
+			assert.NoError(t, err)
+			defer d.Close()
+			dec, err := d.DecodeAll(body[len(prefix):], nil)
+			assert.NoError(t, err)
+			assert.Equal(t, testBody, string(dec))
+			assert.Less(t, len(body), 100)
+		})
+	}
+}
+
+func TestDictionaryUseAsDictionary(t *testing.T) {
+	t.Parallel()
+
+	dict, err := dictionary.New([]byte(testBody), dictionary.Options{Match: "/app.*.js", Path: "/app.v1.js"})
+	assert.NoError(t, err)
+	missing, err := dictionary.New([]byte("missing"), dictionary.Options{Match: "/*", Path: "/missing"})
+	assert.NoError(t, err)
+	h := newDictionaryHandler(t, dict, missing)
+
+	cases := []struct {
+		method string
+		path   string
+		header string
+	}{
+		{http.MethodGet, "/app.v1.js", `match="/app.*.js"`},
+		{http.MethodHead, "/app.v1.js", ""},
+		{http.MethodGet, "/app.v2.js", ""},
+		{http.MethodGet, "/missing", ""},
+	}
+	for _, c := range cases {
+		for ae, supported := range map[string]bool{"gzip, dcz": true, "br, dcz": true, "gzip": false} {
+			r := httptest.NewRequest(c.method, c.path, nil)
+			r.Header.Set(acceptEncoding, ae)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			exp := c.header
+			if !supported {
+				exp = ""
+			}
+			assert.Equal(t, exp, w.Header().Get(dictionary.UseAsDictionary), "%s %s %s", c.method, c.path, ae)
+		}
+	}
+}
+
+func TestDictionaryOptions(t *testing.T) {
+	t.Parallel()
+
+	_, err := DefaultAdapter(Dictionaries(nil))
+	assert.Error(t, err)
+	_, err = DefaultAdapter(DictionariesFrom(nil))
+	assert.Error(t, err)
+	_, err = DefaultAdapter(SampleResponses(nil))
+	assert.Error(t, err)
+}
+
+func TestDictionaryRotation(t *testing.T) {
+	t.Parallel()
+
+	v1, err := dictionary.New([]byte(testBody), dictionary.Options{Match: "/*", Path: "/dict"})
+	assert.NoError(t, err)
+	v2, err := dictionary.New([]byte(testBody+"v2"), dictionary.Options{Match: "/*", Path: "/dict"})
+	assert.NoError(t, err)
+	store, err := dictionary.NewMemoryStore(0)
+	assert.NoError(t, err)
+	dc, err := zstd.NewDictionary()
+	assert.NoError(t, err)
+	mw, err := DefaultAdapter(DictionaryCompressor(dictionary.Zstd, 1000, dc), DictionariesFrom(store))
+	assert.NoError(t, err)
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(contentType, "text/plain")
+		w.Write([]byte(testBody))
+	}))
+
+	get := func(path string, d *dictionary.Dictionary) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		r.Header.Set(acceptEncoding, "zstd, dcz")
+		r.Header.Set(dictionary.AvailableDictionary, d.Hash().String())
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	assert.Equal(t, "zstd", get("/", v1).Header().Get(contentEncoding))
+	store.Add("dict", v1)
+	assert.Equal(t, dictionary.Zstd, get("/", v1).Header().Get(contentEncoding))
+	assert.Equal(t, v1.UseAsDictionary(), get("/dict", v1).Header().Get(dictionary.UseAsDictionary))
+	store.Add("dict", v2)
+	assert.Equal(t, "zstd", get("/", v1).Header().Get(contentEncoding))
+	w := get("/", v2)
+	assert.Equal(t, dictionary.Zstd, w.Header().Get(contentEncoding))
+	assert.True(t, bytes.HasPrefix(w.Body.Bytes(), dictionary.Header(dictionary.Zstd, v2.Hash())))
+	store.Retire("dict")
+	assert.Equal(t, "zstd", get("/", v2).Header().Get(contentEncoding))
+	assert.Empty(t, get("/dict", v2).Header().Get(dictionary.UseAsDictionary))
+}
+
+func TestDictionaryETags(t *testing.T) {
+	t.Parallel()
+
+	v1, err := dictionary.New([]byte(testBody), dictionary.Options{Match: "/*"})
+	assert.NoError(t, err)
+	v2, err := dictionary.New([]byte(testBody+"v2"), dictionary.Options{Match: "/*"})
+	assert.NoError(t, err)
+	dc, err := zstd.NewDictionary()
+	assert.NoError(t, err)
+	mw, err := DefaultAdapter(
+		DictionaryCompressor(dictionary.Zstd, 1000, dc),
+		Dictionaries(v1, v2),
+		ETags(ETagSuffix),
+		RangeRequests(true),
+	)
+	assert.NoError(t, err)
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(etag, `"abc"`)
+		w.Header().Set(contentType, "text/plain")
+		w.Write([]byte(testBody))
+	}))
+	get := func(d *dictionary.Dictionary, header ...string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set(acceptEncoding, "zstd, dcz")
+		r.Header.Set(dictionary.AvailableDictionary, d.Hash().String())
+		for i := 0; i < len(header); i += 2 {
+			r.Header.Set(header[i], header[i+1])
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	// The responses compressed with different dictionaries differ, so their
+	// tags are weak.
+	w1, w2 := get(v1), get(v2)
+	assert.Equal(t, dictionary.Zstd, w1.Header().Get(contentEncoding))
+	assert.Equal(t, dictionary.Zstd, w2.Header().Get(contentEncoding))
+	assert.NotEqual(t, w1.Body.Bytes(), w2.Body.Bytes())
+	assert.Equal(t, `W/"abc-dcz"`, w1.Header().Get(etag))
+	assert.Equal(t, `W/"abc-dcz"`, w2.Header().Get(etag))
+
+	// A range of the response compressed with v2 is not served as the
+	// continuation of the one compressed with v1.
+	w := get(v2, _range, "bytes=4-", ifRange, w1.Header().Get(etag))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, w2.Body.Bytes(), w.Body.Bytes())
+
+	// The tag can still be used to revalidate the response.
+	w = get(v2, ifNoneMatch, w1.Header().Get(etag))
+	assert.Equal(t, http.StatusNotModified, w.Code)
+}
+
+type testSampler struct {
+	samples chan string
+}
+
+func (s testSampler) Sample(r *http.Request, header http.Header) io.WriteCloser {
+	return &testSample{s: s, ct: header.Get(contentType)}
+}
+
+type testSample struct {
+	bytes.Buffer
+	s  testSampler
+	ct string
+}
+
+func (w *testSample) Close() error {
+	w.s.samples <- w.ct + " " + w.String()
+	return nil
+}
+
+func TestSampleResponses(t *testing.T) {
+	t.Parallel()
+
+	s := testSampler{samples: make(chan string, 10)}
+	for _, body := range []string{testBody, "short"} {
+		h := newTestHandler(body, SampleResponses(s))
+		for _, ae := range []string{"gzip", ""} {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set(acceptEncoding, ae)
+			h.ServeHTTP(httptest.NewRecorder(), r)
+		}
+	}
+	// Only the compressed response is sampled.
+	assert.Len(t, s.samples, 1)
+	assert.True(t, <-s.samples == " "+testBody, "unexpected sample")
+}
@@ -0,0 +1,287 @@
+package httpcompression
+
+import (
+	"container/list"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DiskStore is a CacheStore that holds the values in files in a local directory,
+// so that they survive process restarts, up to a maximum total size, evicting the
+// least recently used ones when full.
+//
+// Each value is stored in a file named after its key. Files are written atomically
+// (by renaming a temporary file), so multiple processes on the same host can share
+// the same directory; in this case each process enforces the maximum size based on
+// the files it knows about (the ones that existed when it started, and the ones
+// that it read or wrote), so the actual size of the directory can temporarily
+// exceed the maximum size. By default the files can be read only by the user
+// running the process: see NewDiskStoreWithPerm for sharing the directory among
+// processes running as different users.
+type DiskStore struct {
+	dir      string
+	maxBytes int64
+	perm     os.FileMode // Permissions of the files; the directories are also searchable.
+
+	mu        sync.Mutex
+	size      int64
+	lru       *list.List // of *diskEntry; front is most recently used
+	entries   map[string]*list.Element
+	evictions uint64
+}
+
+type diskEntry struct {
+	key  string
+	size int64
+}
+
+var _ CacheStore = &DiskStore{}
+
+const (
+	diskTempPrefix = ".tmp-"
+	// diskStaleTemp is the age after which a temporary file is considered to be
+	// left behind by a process that crashed while writing it.
+	diskStaleTemp = time.Hour
+)
+
+// NewDiskStore returns a DiskStore that holds up to maxBytes bytes in the directory
+// dir, creating the directory if needed. The values already present in dir are
+// available in the returned store.
+// The files and directories created by the store can be accessed only by the user
+// running the process (0600 and 0700), as the compressed responses may contain
+// private data.
+func NewDiskStore(dir string, maxBytes int64) (*DiskStore, error) {
+	return NewDiskStoreWithPerm(dir, maxBytes, 0600)
+}
+
+// NewDiskStoreWithPerm is like NewDiskStore, but the files are created with the
+// permissions perm (e.g. 0640 to share the directory among processes running as
+// different users in the same group), and the directories are also searchable by
+// the users that can read the files.
+// Note that the compressed responses may contain private data: they can be read
+// by all the users that are granted access.
+func NewDiskStoreWithPerm(dir string, maxBytes int64, perm os.FileMode) (*DiskStore, error) {
+	if maxBytes <= 0 {
+		return nil, fmt.Errorf("cache size must be positive: %d", maxBytes)
+	}
+	if perm&^0666 != 0 || perm&0600 != 0600 {
+		return nil, fmt.Errorf("invalid cache file permissions: %v", perm)
+	}
+	s := &DiskStore{
+		dir:      dir,
+		maxBytes: maxBytes,
+		perm:     perm,
+		lru:      list.New(),
+		entries:  map[string]*list.Element{},
+	}
+	if err := os.MkdirAll(dir, s.dirPerm()); err != nil {
+		return nil, err
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// load adds to the index the files already present in the directory, from the
+// least to the most recently used, and removes the stale temporary files.
+func (s *DiskStore) load() error {
+	type file struct {
+		key   string
+		size  int64
+		mtime time.Time
+	}
+	var files []file
+	subdirs, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	for _, sd := range subdirs {
+		if !sd.IsDir() || len(sd.Name()) != 2 || !isCacheKey(sd.Name()) {
+			continue
+		}
+		fis, err := ioutil.ReadDir(filepath.Join(s.dir, sd.Name()))
+		if err != nil {
+			return err
+		}
+		for _, fi := range fis {
+			switch {
+			case !fi.Mode().IsRegular():
+			case isCacheKey(fi.Name()) && strings.HasPrefix(fi.Name(), sd.Name()):
+				files = append(files, file{fi.Name(), fi.Size(), fi.ModTime()})
+			case strings.HasPrefix(fi.Name(), diskTempPrefix) && time.Since(fi.ModTime()) > diskStaleTemp:
+				_ = os.Remove(filepath.Join(s.dir, sd.Name(), fi.Name()))
+			}
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].mtime.Before(files[j].mtime)
+	})
+	s.mu.Lock()
+	for _, f := range files {
+		s.add(f.key, f.size)
+	}
+	evicted := s.evict()
+	s.mu.Unlock()
+	s.remove(evicted)
+	return nil
+}
+
+// Get implements CacheStore. If the file is found, its modification time is
+// updated, so that the recency is preserved across restarts.
+func (s *DiskStore) Get(key string) ([]byte, bool) {
+	if !isCacheKey(key) {
+		return nil, false
+	}
+	path := s.path(key)
+	data, err := ioutil.ReadFile(path)
+
+	s.mu.Lock()
+	e, ok := s.entries[key]
+	if err != nil {
+		if ok {
+			// The file has been removed, e.g. by another process.
+			s.lru.Remove(e)
+			delete(s.entries, key)
+			s.size -= e.Value.(*diskEntry).size
+		}
+		s.mu.Unlock()
+		return nil, false
+	}
+	var evicted []string
+	if ok {
+		s.lru.MoveToFront(e)
+	} else {
+		// The file has been added by another process.
+		s.add(key, int64(len(data)))
+		evicted = s.evict()
+	}
+	s.mu.Unlock()
+
+	s.remove(evicted)
+	now := time.Now()
+	_ = os.Chtimes(path, now, now)
+	return data, true
+}
+
+// Put implements CacheStore.
+func (s *DiskStore) Put(key string, data []byte) {
+	if !isCacheKey(key) || int64(len(data)) > s.maxBytes {
+		return
+	}
+	s.mu.Lock()
+	if e, ok := s.entries[key]; ok {
+		s.lru.MoveToFront(e)
+		s.mu.Unlock()
+		return
+	}
+	s.mu.Unlock()
+
+	if err := s.write(key, data); err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	var evicted []string
+	if _, ok := s.entries[key]; !ok {
+		s.add(key, int64(len(data)))
+		evicted = s.evict()
+	}
+	s.mu.Unlock()
+	s.remove(evicted)
+}
+
+// Stats implements CacheStore.
+func (s *DiskStore) Stats() StoreStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return StoreStats{
+		Evictions: s.evictions,
+		Entries:   s.lru.Len(),
+		Bytes:     s.size,
+	}
+}
+
+func (s *DiskStore) path(key string) string {
+	return filepath.Join(s.dir, key[:2], key)
+}
+
+// write atomically writes the file for key.
+func (s *DiskStore) write(key string, data []byte) error {
+	path := s.path(key)
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, s.dirPerm()); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(dir, diskTempPrefix+"*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op if the file has been renamed
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Chmod(s.perm)
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	return err
+}
+
+// dirPerm returns the permissions of the directories: the ones of the files, plus
+// the permission to search them for the users that can read the files.
+func (s *DiskStore) dirPerm() os.FileMode {
+	return s.perm | s.perm&0444>>2
+}
+
+// add adds key to the index. s.mu must be held.
+func (s *DiskStore) add(key string, size int64) {
+	s.entries[key] = s.lru.PushFront(&diskEntry{key, size})
+	s.size += size
+}
+
+// evict removes from the index the least recently used entries until the size
+// is below the limit, and returns their keys. s.mu must be held.
+func (s *DiskStore) evict() []string {
+	var evicted []string
+	for s.size > s.maxBytes {
+		e := s.lru.Back()
+		de := e.Value.(*diskEntry)
+		s.lru.Remove(e)
+		delete(s.entries, de.key)
+		s.size -= de.size
+		s.evictions++
+		evicted = append(evicted, de.key)
+	}
+	return evicted
+}
+
+// remove removes the files of the specified keys.
+func (s *DiskStore) remove(keys []string) {
+	for _, key := range keys {
+		_ = os.Remove(s.path(key))
+	}
+}
+
+// isCacheKey returns true if key is a valid cache key, i.e. a lowercase hex string
+// long enough to be used as a file name in a two-level directory structure.
+func isCacheKey(key string) bool {
+	if len(key) < 2 {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if c := key[i]; (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
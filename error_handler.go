@@ -0,0 +1,48 @@
+package httpcompression
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// CompressionError is the error passed to the function set with ErrorHandler when
+// writing, flushing or closing a response fails. A CompressionError for a compressed
+// response normally means that the client received a truncated or corrupted body.
+type CompressionError struct {
+	// Op is the operation that failed: "write", "flush" or "close".
+	Op string
+	// Encoding is the Content-Encoding used for the response, or the empty string
+	// if the response was not compressed.
+	Encoding string
+	// Written is the number of (uncompressed) bytes that the handler successfully
+	// wrote to the response before the error.
+	Written int64
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *CompressionError) Error() string {
+	enc := e.Encoding
+	if enc == "" {
+		enc = identity
+	}
+	return fmt.Sprintf("httpcompression: %s (%s, %d bytes written): %v", e.Op, enc, e.Written, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *CompressionError) Unwrap() error {
+	return e.Err
+}
+
+// ErrorHandler is an option that sets a function that is called when an error occurs
+// while writing, flushing or closing a response. The error passed to the function is a
+// *CompressionError. The function is called at most once per response (for the first
+// error that occurs), and it is called synchronously from the goroutine that is serving
+// the request, so it should not block.
+// If handler is nil (the default), errors are not reported.
+func ErrorHandler(handler func(r *http.Request, err error)) Option {
+	return func(c *config) error {
+		c.errorHandler = handler
+		return nil
+	}
+}
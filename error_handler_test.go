@@ -0,0 +1,121 @@
+package httpcompression
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var errTest = errors.New("test error")
+
+// failingCompressor returns compressors whose Close fails.
+type failingCompressor struct{}
+
+func (failingCompressor) Get(w io.Writer) io.WriteCloser {
+	return failingCloser{w}
+}
+
+type failingCloser struct {
+	io.Writer
+}
+
+func (failingCloser) Close() error {
+	return errTest
+}
+
+// failingResponseWriter is a ResponseWriter whose Write fails after n bytes.
+type failingResponseWriter struct {
+	*httptest.ResponseRecorder
+	n int
+}
+
+func (w *failingResponseWriter) Write(b []byte) (int, error) {
+	if len(b) > w.n {
+		n, _ := w.ResponseRecorder.Write(b[:w.n])
+		w.n = 0
+		return n, errTest
+	}
+	w.n -= len(b)
+	return w.ResponseRecorder.Write(b)
+}
+
+func TestErrorHandlerClose(t *testing.T) {
+	t.Parallel()
+
+	var errs []error
+	mw, err := Adapter(
+		Compressor("test", 0, failingCompressor{}),
+		ErrorHandler(func(r *http.Request, err error) {
+			assert.Equal(t, "/path", r.URL.Path)
+			errs = append(errs, err)
+		}),
+	)
+	assert.Nil(t, err)
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, testBody)
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/path", nil)
+	r.Header.Set(acceptEncoding, "test")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	if assert.Len(t, errs, 1) {
+		var ce *CompressionError
+		assert.True(t, errors.As(errs[0], &ce))
+		assert.Equal(t, "close", ce.Op)
+		assert.Equal(t, "test", ce.Encoding)
+		assert.Equal(t, int64(len(testBody)), ce.Written)
+		assert.True(t, errors.Is(errs[0], errTest))
+	}
+}
+
+func TestErrorHandlerWrite(t *testing.T) {
+	t.Parallel()
+
+	var errs []error
+	mw, err := DefaultAdapter(ErrorHandler(func(r *http.Request, err error) {
+		errs = append(errs, err)
+	}))
+	assert.Nil(t, err)
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < 3; i++ {
+			if _, err := io.WriteString(w, testBody); err != nil {
+				return
+			}
+			w.(http.Flusher).Flush()
+		}
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(acceptEncoding, "gzip")
+	h.ServeHTTP(&failingResponseWriter{httptest.NewRecorder(), 10}, r)
+
+	// Only the first error is reported.
+	if assert.Len(t, errs, 1) {
+		var ce *CompressionError
+		assert.True(t, errors.As(errs[0], &ce))
+		assert.Equal(t, "gzip", ce.Encoding)
+		assert.True(t, errors.Is(errs[0], errTest))
+	}
+}
+
+func TestErrorHandlerNoError(t *testing.T) {
+	t.Parallel()
+
+	mw, err := DefaultAdapter(ErrorHandler(func(r *http.Request, err error) {
+		t.Errorf("unexpected error: %v", err)
+	}))
+	assert.Nil(t, err)
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, testBody)
+	}))
+	for _, ae := range []string{"", "gzip", "br", "zstd"} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set(acceptEncoding, ae)
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+}
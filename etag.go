@@ -0,0 +1,217 @@
+package httpcompression
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+const ifNoneMatch = "If-None-Match"
+
+// ETags controls how the middleware rewrites the ETag header of the responses
+// that it compresses. See the comments on the ETagMode constants for the
+// supported values.
+//
+// When ETags are rewritten, the If-None-Match header of the requests is
+// evaluated against the rewritten tags: the tags sent by the client that were
+// rewritten by the middleware are also passed to the handler in their original
+// form, so that the handler can respond with 304 Not Modified as usual (the ETag
+// of the 304 response is then rewritten to the tag sent by the client). If the
+// handler does not evaluate If-None-Match itself, and the rewritten ETag of a
+// compressed GET or HEAD response matches one of the tags sent by the client, the
+// middleware responds with 304 Not Modified, discarding the body.
+func ETags(mode ETagMode) Option {
+	return func(c *config) error {
+		switch mode {
+		case ETagKeep, ETagSuffix, ETagWeak:
+			c.etags = mode
+			return nil
+		default:
+			return fmt.Errorf("unknown etag mode: %v", mode)
+		}
+	}
+}
+
+// ETagMode controls how the ETag header of compressed responses is rewritten.
+type ETagMode byte
+
+const (
+	// ETagKeep leaves the ETag header unchanged. As a result the same ETag is
+	// used for all the encodings of a response.
+	// ETagKeep is the default.
+	ETagKeep ETagMode = iota
+
+	// ETagSuffix appends the Content-Encoding to the ETag of compressed responses,
+	// e.g. "abc" becomes "abc-gzip", and W/"abc" becomes W/"abc-gzip".
+	// This requires compressors to be deterministic (see RangeRequests), as the
+	// rewritten tags are strong if the original ones were strong. The tags of the
+	// responses compressed with a dictionary (e.g. dcz) are always weak, e.g.
+	// W/"abc-dcz", as the compressed bytes also depend on the dictionary.
+	ETagSuffix
+
+	// ETagWeak turns the strong ETags of compressed responses into weak ones,
+	// e.g. "abc" becomes W/"abc". Weak tags are left unchanged.
+	ETagWeak
+)
+
+// rewriteETag returns the tag to be used for a response with ETag tag that is
+// compressed using the encoding enc. dict is true if enc uses a dictionary.
+func rewriteETag(tag, enc string, dict bool, mode ETagMode) string {
+	weak, opaque, ok := parseETag(tag)
+	if !ok {
+		return tag
+	}
+	switch mode {
+	case ETagSuffix:
+		if dict {
+			weak = "W/"
+		}
+		return weak + opaque[:len(opaque)-1] + "-" + enc + `"`
+	case ETagWeak:
+		return "W/" + opaque
+	}
+	return tag
+}
+
+// originalETag returns the tag, set by the handler, that rewriteETag turned into
+// tag when compressing the response with one of the encodings in common.
+func originalETag(tag string, common []string, mode ETagMode) (string, bool) {
+	weak, opaque, ok := parseETag(tag)
+	if !ok {
+		return "", false
+	}
+	switch mode {
+	case ETagSuffix:
+		for _, enc := range common {
+			if suffix := "-" + enc + `"`; strings.HasSuffix(opaque, suffix) && len(opaque) > len(suffix) {
+				return weak + opaque[:len(opaque)-len(suffix)] + `"`, true
+			}
+		}
+	case ETagWeak:
+		if weak != "" {
+			return opaque, true
+		}
+	}
+	return "", false
+}
+
+// parseETag splits tag into its weakness indicator (either "W/" or "") and its
+// quoted opaque part.
+func parseETag(tag string) (weak, opaque string, ok bool) {
+	if strings.HasPrefix(tag, "W/") {
+		weak, tag = "W/", tag[2:]
+	}
+	if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		return "", "", false
+	}
+	return weak, tag, true
+}
+
+// etagMatch returns true if tag matches, using the weak comparison function,
+// any of the tags in the If-None-Match header values inm.
+func etagMatch(inm []string, tag string) bool {
+	_, opaque, ok := parseETag(tag)
+	if !ok {
+		return false
+	}
+	for _, v := range inm {
+		for _, t := range strings.Split(v, ",") {
+			t = strings.TrimSpace(t)
+			if t == "*" {
+				return true
+			}
+			if _, o, ok := parseETag(t); ok && o == opaque {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// conditionalRequest returns r, or a copy of r whose If-None-Match header also
+// includes the original form of the rewritten tags sent by the client.
+func (c *config) conditionalRequest(r *http.Request, neg negotiation) *http.Request {
+	inm := r.Header.Values(ifNoneMatch)
+	if c.etags == ETagKeep || len(inm) == 0 {
+		return r
+	}
+	common := c.table.acceptedEncodings(neg)
+	var tags []string
+	for _, v := range inm {
+		for _, t := range strings.Split(v, ",") {
+			if orig, ok := originalETag(strings.TrimSpace(t), common, c.etags); ok {
+				tags = append(tags, orig)
+			}
+		}
+	}
+	if len(tags) == 0 {
+		return r
+	}
+	r = r.Clone(r.Context())
+	r.Header.Set(ifNoneMatch, strings.Join(append(inm, tags...), ", "))
+	return r
+}
+
+// rewriteETag rewrites the ETag of the response, that is being compressed using
+// the encoding enc. It returns true if the rewritten ETag matches the If-None-Match
+// header of the request, so that the response must be turned into a 304 Not Modified.
+func (w *compressWriter) rewriteETag(enc string) bool {
+	tag := w.Header().Get(etag)
+	if w.config.etags == ETagKeep || tag == "" {
+		return false
+	}
+	tag = rewriteETag(tag, enc, w.config.compressor[enc].dict != nil, w.config.etags)
+	w.Header().Set(etag, tag)
+
+	r := w.request
+	if (w.code != 0 && w.code != http.StatusOK) || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+		return false
+	}
+	return etagMatch(r.Header.Values(ifNoneMatch), tag)
+}
+
+// notModifiedETag sets the ETag of a 304 Not Modified response sent by the
+// handler to the (rewritten) tag sent by the client that the handler matched.
+func (w *compressWriter) notModifiedETag() {
+	tag := w.Header().Get(etag)
+	if w.config.etags == ETagKeep || tag == "" {
+		return
+	}
+	_, opaque, ok := parseETag(tag)
+	if !ok {
+		return
+	}
+	common := w.config.table.acceptedEncodings(w.neg)
+	for _, v := range w.request.Header.Values(ifNoneMatch) {
+		for _, t := range strings.Split(v, ",") {
+			t = strings.TrimSpace(t)
+			if t == tag {
+				// The client sent the tag set by the handler.
+				return
+			}
+			if orig, ok := originalETag(t, common, w.config.etags); ok {
+				if _, o, _ := parseETag(orig); o == opaque {
+					w.Header().Set(etag, t)
+					return
+				}
+			}
+		}
+	}
+}
+
+// notModified turns the response into a 304 Not Modified, as the rewritten ETag
+// matched the If-None-Match header of the request. The body written by the
+// handler is discarded.
+func (w *compressWriter) notModified() {
+	h := w.Header()
+	h.Del(contentType)
+	h.Del(contentLength)
+	h.Del(contentEncoding)
+	h.Del(lastModified)
+	w.ResponseWriter.WriteHeader(http.StatusNotModified)
+	w.code = 0
+	w.w = ioutil.Discard
+	w.enc = ""
+	w.skip = SkipNotModified
+}
@@ -0,0 +1,151 @@
+package httpcompression
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRewriteETag(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		tag  string
+		enc  string
+		mode ETagMode
+		exp  string
+		orig string // Expected result of originalETag, if exp != tag.
+	}{
+		{`"abc"`, "gzip", ETagKeep, `"abc"`, ""},
+		{`"abc"`, "gzip", ETagSuffix, `"abc-gzip"`, `"abc"`},
+		{`W/"abc"`, "gzip", ETagSuffix, `W/"abc-gzip"`, `W/"abc"`},
+		{`""`, "gzip", ETagSuffix, `"-gzip"`, `""`},
+		{`"abc"`, "gzip", ETagWeak, `W/"abc"`, `"abc"`},
+		{`W/"abc"`, "gzip", ETagWeak, `W/"abc"`, ""},
+		{`abc`, "gzip", ETagSuffix, `abc`, ""},
+		{`"abc`, "gzip", ETagWeak, `"abc`, ""},
+		{`"abc"`, "dcz", ETagKeep, `"abc"`, ""},
+		{`"abc"`, "dcz", ETagSuffix, `W/"abc-dcz"`, `W/"abc"`},
+		{`W/"abc"`, "dcz", ETagSuffix, `W/"abc-dcz"`, `W/"abc"`},
+		{`"abc"`, "dcz", ETagWeak, `W/"abc"`, `"abc"`},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.exp, rewriteETag(c.tag, c.enc, c.enc == "dcz", c.mode), "%s %s %v", c.tag, c.enc, c.mode)
+		if c.exp != c.tag {
+			orig, ok := originalETag(c.exp, []string{"br", "gzip", "dcz"}, c.mode)
+			assert.True(t, ok, c.exp)
+			assert.Equal(t, c.orig, orig, c.exp)
+		}
+	}
+
+	_, ok := originalETag(`"abc-zstd"`, []string{"br", "gzip"}, ETagSuffix)
+	assert.False(t, ok)
+	_, ok = originalETag(`"abc"`, []string{"gzip"}, ETagWeak)
+	assert.False(t, ok)
+}
+
+func TestETagsOption(t *testing.T) {
+	t.Parallel()
+
+	_, err := DefaultAdapter(ETags(ETagMode(42)))
+	assert.NotNil(t, err)
+}
+
+// etagHandler returns a handler that sets the ETag "v1" and, if conditional is
+// true, evaluates If-None-Match.
+func etagHandler(t *testing.T, conditional bool, opts ...Option) http.Handler {
+	mw, err := DefaultAdapter(opts...)
+	assert.NoError(t, err)
+	return mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(etag, `"v1"`)
+		w.Header().Set(contentType, "text/plain")
+		if conditional && etagMatch(r.Header.Values(ifNoneMatch), `"v1"`) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte(testBody))
+	}))
+}
+
+func etagGet(h http.Handler, ae string, inm ...string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set(acceptEncoding, ae)
+	for _, t := range inm {
+		req.Header.Add(ifNoneMatch, t)
+	}
+	resp := httptest.NewRecorder()
+	h.ServeHTTP(resp, req)
+	return resp
+}
+
+func TestETags(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		mode ETagMode
+		ae   string
+		exp  string
+	}{
+		{ETagKeep, "gzip", `"v1"`},
+		{ETagSuffix, "gzip", `"v1-gzip"`},
+		{ETagSuffix, "br", `"v1-br"`},
+		{ETagSuffix, "identity", `"v1"`},
+		{ETagWeak, "gzip", `W/"v1"`},
+		{ETagWeak, "identity", `"v1"`},
+	}
+	for _, c := range cases {
+		for _, conditional := range []bool{false, true} {
+			h := etagHandler(t, conditional, ETags(c.mode))
+			res := etagGet(h, c.ae)
+			assert.Equal(t, http.StatusOK, res.Code)
+			assert.Equal(t, c.exp, res.Header().Get(etag))
+
+			if !conditional && (c.mode == ETagKeep || c.ae == "identity") {
+				// The middleware evaluates If-None-Match only for rewritten tags.
+				continue
+			}
+			res = etagGet(h, c.ae, c.exp)
+			assert.Equal(t, http.StatusNotModified, res.Code, "%v %s %v", c.mode, c.ae, conditional)
+			assert.Equal(t, c.exp, res.Header().Get(etag))
+			assert.Equal(t, "", res.Header().Get(contentEncoding))
+			assert.Equal(t, 0, res.Body.Len())
+		}
+	}
+}
+
+func TestETagsNotModifiedOtherEncoding(t *testing.T) {
+	t.Parallel()
+
+	for _, conditional := range []bool{false, true} {
+		h := etagHandler(t, conditional, ETags(ETagSuffix))
+
+		// The client has the gzip response, but it does not accept gzip anymore.
+		res := etagGet(h, "br", `"v1-gzip"`)
+		assert.Equal(t, http.StatusOK, res.Code)
+		assert.Equal(t, `"v1-br"`, res.Header().Get(etag))
+		assert.Equal(t, "br", res.Header().Get(contentEncoding))
+
+		// The client has the gzip and br responses.
+		res = etagGet(h, "br", `"v0", "v1-gzip"`, `"v1-br"`)
+		assert.Equal(t, http.StatusNotModified, res.Code)
+		assert.Equal(t, `"v1-br"`, res.Header().Get(etag))
+	}
+}
+
+func TestETagsNotModifiedStatus(t *testing.T) {
+	t.Parallel()
+
+	mw, err := DefaultAdapter(ETags(ETagSuffix))
+	assert.NoError(t, err)
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(etag, `"v1"`)
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(testBody))
+	}))
+	res := etagGet(h, "gzip", `"v1-gzip"`)
+	assert.Equal(t, http.StatusNotFound, res.Code)
+	assert.Equal(t, `"v1-gzip"`, res.Header().Get(etag))
+	assert.Equal(t, "gzip", res.Header().Get(contentEncoding))
+}
@@ -1,11 +1,14 @@
 package httpcompression_test
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"encoding/binary"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"net/http/httptest"
 	"os"
 
 	"github.com/CAFxX/httpcompression"
@@ -111,6 +114,56 @@ func readZstdDictionary(file string) (dict []byte, coding string, err error) {
 	return
 }
 
+func Example_brotliDictionary() {
+	// brotli compressor with custom dictionary
+	dict, coding, err := readBrotliDictionary("test/brotli-dictionary")
+	if err != nil {
+		log.Fatal(err)
+	}
+	bdEnc, err := brotli.NewRawDictionary(dict, 6)
+	if err != nil {
+		log.Fatal(err)
+	}
+	compress, err := httpcompression.DefaultAdapter(
+		// Add the brotli compressor with the dictionary, using a custom content-encoding
+		// name (see ExampleWithDictionary).
+		httpcompression.Compressor(coding, 3, bdEnc),
+		httpcompression.Prefer(httpcompression.PreferServer),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// A page similar to the dictionary.
+	page := bytes.Replace(dict, []byte("</main>"), []byte("<h1>Hello world!</h1>\n</main>"), 1)
+	h := compress(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(page)
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip, br, "+coding)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	fmt.Println(w.Header().Get("Content-Encoding"), w.Body.Len() < len(page)/10)
+	// Output: b_e441e0fd true
+}
+
+func readBrotliDictionary(file string) (dict []byte, coding string, err error) {
+	dict, err = ioutil.ReadFile(file)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(dict) == 0 {
+		return nil, "", fmt.Errorf("invalid dictionary")
+	}
+	// Unlike zstd dictionaries, brotli raw dictionaries have no ID: so we use a prefix of
+	// their SHA-256 hash to build the encoding name b_XXXXXXXX. The same considerations
+	// of readZstdDictionary apply.
+	hash := sha256.Sum256(dict)
+	coding = fmt.Sprintf("b_%x", hash[:4])
+	return
+}
+
 // ExampleCustomCompressor shows how to create an httpcompression adapter with a custom compressor.
 // In this case we use the pierrec/lz4 compressor in contrib, but it could be replaced with any
 // other compressor, as long as it implements the CompressorProvider interface.
@@ -0,0 +1,214 @@
+package httpcompression
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// defaultPrecompressedExtensions are the file extensions of the precompressed
+// siblings looked up by FileServer, by Content-Encoding.
+var defaultPrecompressedExtensions = map[string]string{
+	"br":   ".br",
+	"zstd": ".zst",
+	"gzip": ".gz",
+}
+
+// defaultPrecompressedPriorities are the priorities used by FileServer for the
+// encodings of precompressed siblings for which no compressor is registered.
+// They match the priorities used by the respective compressor options.
+var defaultPrecompressedPriorities = map[string]int{
+	"deflate": -300,
+	"gzip":    -200,
+	"br":      -100,
+	"zstd":    -50,
+}
+
+// FileServer returns a handler that serves the files in fsys, like
+// http.FileServer(http.FS(fsys)), that serves precompressed files if available.
+// When a file (e.g. "style.css") is requested, FileServer looks for precompressed
+// siblings in the same directory (e.g. "style.css.br", "style.css.zst" and
+// "style.css.gz"); if any of the siblings uses a Content-Encoding accepted by the
+// client, the sibling is served as-is, with the Content-Type of the original file
+// and the Content-Encoding of the sibling. If multiple siblings are acceptable,
+// the one to be served is chosen according to the priorities of the compressors
+// and to the Prefer (or Negotiation) option, like Adapter does.
+// If no acceptable sibling exists, the file is served by http.FileServer wrapped
+// with Adapter, so that it is compressed on the fly by the configured compressors.
+// It accepts the same options as Adapter; see also PrecompressedExtension.
+// An error will be returned if invalid options are given.
+func FileServer(fsys fs.FS, opts ...Option) (http.Handler, error) {
+	c := config{
+		prefer:        PreferServer,
+		compressor:    comps{},
+		precompressed: map[string]string{},
+	}
+	for enc, ext := range defaultPrecompressedExtensions {
+		c.precompressed[enc] = ext
+	}
+	for _, o := range opts {
+		err := o(&c)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	mw, err := Adapter(opts...)
+	if err != nil {
+		return nil, err
+	}
+	fallback := mw(http.FileServer(http.FS(fsys)))
+	if len(c.precompressed) == 0 {
+		return fallback, nil
+	}
+
+	// Only the priorities are needed to choose among the precompressed siblings.
+	prio := comps{}
+	for enc := range c.precompressed {
+		if cc, ok := c.compressor[enc]; ok {
+			prio[enc] = comp{priority: cc.priority}
+		} else {
+			prio[enc] = comp{priority: defaultPrecompressedPriorities[enc]}
+		}
+	}
+	table, err := newEncodingTable(prio, c.prefer)
+	if err != nil {
+		return nil, err
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			fallback.ServeHTTP(w, r)
+			return
+		}
+		addVaryHeader(w.Header(), acceptEncoding)
+
+		name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+		if name == "" || strings.HasSuffix(r.URL.Path, "/") || path.Base(name) == "index.html" {
+			// Directories (and their index files, that http.FileServer
+			// redirects to the directory) are handled by http.FileServer.
+			fallback.ServeHTTP(w, r)
+			return
+		}
+
+		vv := r.Header.Values(acceptEncoding)
+		n := table.negotiate(vv)
+		var (
+			siblings uint64 // Bitmask of the accepted encodings with a sibling.
+			common   []string
+			smallest string
+			size     int64
+		)
+		for i, enc := range table.encodings {
+			if n.accepted&(1<<uint(i)) == 0 {
+				continue
+			}
+			if fi, err := fs.Stat(fsys, name+c.precompressed[enc]); err == nil && fi.Mode().IsRegular() {
+				siblings |= 1 << uint(i)
+				common = append(common, enc)
+				if smallest == "" || fi.Size() < size || fi.Size() == size && enc < smallest {
+					smallest, size = enc, fi.Size()
+				}
+			}
+		}
+		if len(common) == 0 {
+			fallback.ServeHTTP(w, r)
+			return
+		}
+		fi, err := fs.Stat(fsys, name)
+		if err != nil || !fi.Mode().IsRegular() {
+			// Do not serve siblings of files that do not exist.
+			fallback.ServeHTTP(w, r)
+			return
+		}
+
+		ct, err := fileContentType(fsys, name)
+		if err != nil {
+			fallback.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set(contentType, ct)
+
+		var enc string
+		switch {
+		case c.negotiator == nil && c.prefer == PreferSmallest:
+			enc = smallest
+		case c.negotiator == nil:
+			enc = table.encodings[table.parseAmong(vv, siblings).best]
+		default:
+			// The candidates are sorted by decreasing server priority.
+			enc = c.negotiator.Negotiate(r, parseEncodings(vv), common, w.Header())
+			if !contains(common, enc) {
+				fallback.ServeHTTP(w, r)
+				return
+			}
+		}
+		f, err := fsys.Open(name + c.precompressed[enc])
+		if err != nil {
+			fallback.ServeHTTP(w, r)
+			return
+		}
+		defer f.Close()
+		rs, ok := f.(io.ReadSeeker)
+		if !ok {
+			fallback.ServeHTTP(w, r)
+			return
+		}
+		sfi, err := f.Stat()
+		if err != nil {
+			fallback.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set(contentEncoding, enc)
+		// http.ServeContent sets Content-Length, and handles conditional
+		// and range requests (ranges apply to the precompressed file).
+		http.ServeContent(w, r, name, sfi.ModTime(), rs)
+	}), nil
+}
+
+// fileContentType returns the Content-Type of the file, determined by its
+// extension or, like http.FileServer does, by sniffing its content.
+func fileContentType(fsys fs.FS, name string) (string, error) {
+	if ct := mime.TypeByExtension(path.Ext(name)); ct != "" {
+		return ct, nil
+	}
+	f, err := fsys.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	var buf [512]byte
+	n, err := io.ReadFull(f, buf[:])
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	return http.DetectContentType(buf[:n]), nil
+}
+
+// PrecompressedExtension is an option that sets the file extension of the
+// precompressed siblings with the specified Content-Encoding that are served
+// by FileServer. If ext is empty, precompressed siblings with the specified
+// Content-Encoding are not served.
+// The defaults are ".br" for "br", ".zst" for "zstd" and ".gz" for "gzip".
+// It is used only by FileServer.
+func PrecompressedExtension(contentEncoding, ext string) Option {
+	return func(c *config) error {
+		if ext == "" {
+			delete(c.precompressed, contentEncoding)
+			return nil
+		}
+		if !strings.HasPrefix(ext, ".") || strings.Contains(ext, "/") {
+			return fmt.Errorf("invalid precompressed file extension: %q", ext)
+		}
+		if c.precompressed == nil {
+			c.precompressed = map[string]string{}
+		}
+		c.precompressed[contentEncoding] = ext
+		return nil
+	}
+}
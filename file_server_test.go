@@ -0,0 +1,114 @@
+package httpcompression
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+
+	ibrotli "github.com/andybalholm/brotli"
+)
+
+func TestFileServer(t *testing.T) {
+	t.Parallel()
+
+	gz := gzipStrLevel(testBody, gzip.BestCompression)
+	br := brotliStrLevel(testBody, 11)
+	fsys := fstest.MapFS{
+		"a.txt":         {Data: []byte(testBody)},
+		"a.txt.gz":      {Data: gz},
+		"a.txt.br":      {Data: br},
+		"noext":         {Data: []byte("<html><body>" + testBody + "</body></html>")},
+		"noext.gz":      {Data: gzipStrLevel("<html><body>"+testBody+"</body></html>", gzip.BestCompression)},
+		"b.txt":         {Data: []byte(testBody)},
+		"orphan.txt.gz": {Data: gz},
+	}
+	h, err := FileServer(fsys, GzipCompressionLevel(gzip.DefaultCompression), BrotliCompressionLevel(5), MinSize(DefaultMinSize))
+	assert.Nil(t, err)
+
+	cases := []struct {
+		name     string
+		path     string
+		ae       string
+		status   int
+		encoding string
+		ct       string
+		body     []byte
+	}{
+		{"identity", "/a.txt", "", 200, "", "text/plain; charset=utf-8", []byte(testBody)},
+		{"gzip sibling", "/a.txt", "gzip", 200, "gzip", "text/plain; charset=utf-8", gz},
+		{"br sibling", "/a.txt", "gzip, br", 200, "br", "text/plain; charset=utf-8", br},
+		{"q-values", "/a.txt", "gzip, br;q=0", 200, "gzip", "text/plain; charset=utf-8", gz},
+		{"sniffed type", "/noext", "gzip", 200, "gzip", "text/html; charset=utf-8", nil},
+		{"on the fly", "/b.txt", "gzip", 200, "gzip", "text/plain; charset=utf-8", gzipStrLevel(testBody, gzip.DefaultCompression)},
+		{"no sibling accepted", "/a.txt", "zstd", 200, "", "text/plain; charset=utf-8", []byte(testBody)},
+		{"orphan sibling", "/orphan.txt", "gzip", 404, "", "text/plain; charset=utf-8", nil},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, c.path, nil)
+			r.Header.Set(acceptEncoding, c.ae)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			res := w.Result()
+			assert.Equal(t, c.status, res.StatusCode)
+			assert.Equal(t, c.encoding, res.Header.Get(contentEncoding))
+			assert.Equal(t, c.ct, res.Header.Get(contentType))
+			assert.Equal(t, []string{acceptEncoding}, res.Header.Values(vary))
+			if c.body != nil {
+				assert.Equal(t, c.body, w.Body.Bytes())
+			}
+			if cl := res.Header.Get(contentLength); cl != "" {
+				assert.Equal(t, strconv.Itoa(w.Body.Len()), cl)
+			}
+		})
+	}
+}
+
+func TestFileServerPreferClient(t *testing.T) {
+	t.Parallel()
+
+	fsys := fstest.MapFS{
+		"a.txt":    {Data: []byte(testBody)},
+		"a.txt.gz": {Data: gzipStrLevel(testBody, gzip.BestCompression)},
+		"a.txt.br": {Data: brotliStrLevel(testBody, 11)},
+	}
+	h, err := FileServer(fsys, Prefer(PreferClient))
+	assert.Nil(t, err)
+
+	r := httptest.NewRequest(http.MethodGet, "/a.txt", nil)
+	r.Header.Set(acceptEncoding, "gzip, br;q=0.5")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, "gzip", w.Header().Get(contentEncoding))
+
+	h, err = FileServer(fsys, PrecompressedExtension("gzip", ""))
+	assert.Nil(t, err)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, "br", w.Header().Get(contentEncoding))
+	b, err := io.ReadAll(ibrotli.NewReader(bytes.NewReader(w.Body.Bytes())))
+	assert.Nil(t, err)
+	assert.Equal(t, testBody, string(b))
+
+	_, err = FileServer(fsys, PrecompressedExtension("gzip", "gz"))
+	assert.NotNil(t, err)
+
+	// The preferred encoding is chosen among the ones that have a sibling.
+	delete(fsys, "a.txt.br")
+	for _, prefer := range []PreferType{PreferServer, PreferClient} {
+		h, err = FileServer(fsys, Prefer(prefer))
+		assert.Nil(t, err)
+		r.Header.Set(acceptEncoding, "br, gzip;q=0.5")
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		assert.Equal(t, "gzip", w.Header().Get(contentEncoding))
+	}
+}
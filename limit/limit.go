@@ -0,0 +1,124 @@
+// Package limit provides protection against decompression bombs, i.e. small
+// compressed payloads that expand to huge amounts of data when decoded.
+//
+// The limits are enforced by wrapping the encoded and decoded streams, so that
+// they can be used with any decoder, e.g. by the request decompression middleware
+// or directly with the decoders in contrib.
+package limit
+
+import (
+	"errors"
+	"io"
+)
+
+var (
+	// ErrSize is returned when the decoded stream exceeds Limits.MaxSize.
+	ErrSize = errors.New("limit: decoded size exceeds the limit")
+	// ErrRatio is returned when the decoded stream exceeds Limits.MaxRatio.
+	ErrRatio = errors.New("limit: decompression ratio exceeds the limit")
+	// ErrWindow is returned by CheckWindow when the window declared by the
+	// encoded stream exceeds the limit.
+	ErrWindow = errors.New("limit: window size exceeds the limit")
+)
+
+// IsExceeded returns true if err is (or wraps) one of the errors returned
+// when a limit is exceeded.
+func IsExceeded(err error) bool {
+	return errors.Is(err, ErrSize) || errors.Is(err, ErrRatio) || errors.Is(err, ErrWindow)
+}
+
+// RatioMinSize is the number of decoded bytes below which Limits.MaxRatio is
+// not enforced. Short, highly-redundant payloads routinely have very high
+// compression ratios (e.g. a few KB of whitespace) so enforcing the ratio from
+// the first byte would reject legitimate payloads.
+const RatioMinSize = 64 << 10
+
+// Limits specifies the limits enforced by Reader.
+type Limits struct {
+	// MaxSize is the maximum number of decoded bytes that can be read.
+	// Zero means no limit.
+	MaxSize int64
+	// MaxRatio is the maximum ratio between the number of decoded bytes and the
+	// number of encoded bytes. It is enforced only once more than RatioMinSize
+	// bytes have been decoded. Zero means no limit.
+	MaxRatio float64
+}
+
+// Enabled returns true if at least one of the limits is set.
+func (l Limits) Enabled() bool {
+	return l.MaxSize > 0 || l.MaxRatio > 0
+}
+
+// Counter is an io.Reader that counts the bytes read from the encoded stream.
+type Counter struct {
+	r io.Reader
+	n int64
+}
+
+// NewCounter returns a Counter reading from the encoded stream r.
+func NewCounter(r io.Reader) *Counter {
+	return &Counter{r: r}
+}
+
+func (c *Counter) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// N returns the number of bytes read so far.
+func (c *Counter) N() int64 {
+	return c.n
+}
+
+// Reader is an io.Reader that reads from a decoded stream and fails
+// once the configured Limits are exceeded.
+type Reader struct {
+	r   io.Reader
+	c   *Counter
+	l   Limits
+	n   int64
+	err error
+}
+
+// NewReader returns a Reader that reads the decoded stream from r, enforcing l.
+// c must be the Counter wrapping the encoded stream that is being decoded by r;
+// it can be nil if l.MaxRatio is not set.
+//
+// A typical usage is:
+//
+//	c := limit.NewCounter(body)
+//	d := newDecoder(c)
+//	r := limit.NewReader(d, c, limit.Limits{MaxSize: 1 << 20})
+func NewReader(r io.Reader, c *Counter, l Limits) *Reader {
+	return &Reader{r: r, c: c, l: l}
+}
+
+func (r *Reader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	if r.l.MaxSize > 0 && int64(len(p)) > r.l.MaxSize-r.n+1 {
+		// Read at most one byte more than allowed, so that we can detect
+		// that the limit has been exceeded without reading too much.
+		p = p[:r.l.MaxSize-r.n+1]
+	}
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	if r.l.MaxSize > 0 && r.n > r.l.MaxSize {
+		n -= int(r.n - r.l.MaxSize)
+		r.n = r.l.MaxSize
+		r.err = ErrSize
+		return n, r.err
+	}
+	if r.l.MaxRatio > 0 && r.c != nil && r.n > RatioMinSize && float64(r.n) > r.l.MaxRatio*float64(r.c.N()) {
+		r.err = ErrRatio
+		return n, r.err
+	}
+	return n, err
+}
+
+// N returns the number of decoded bytes read so far.
+func (r *Reader) N() int64 {
+	return r.n
+}
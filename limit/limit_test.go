@@ -0,0 +1,196 @@
+package limit_test
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/CAFxX/httpcompression/limit"
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+func gzipBytes(t *testing.T, b []byte) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write(b)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestReaderMaxSize(t *testing.T) {
+	t.Parallel()
+
+	data := bytes.Repeat([]byte("a"), 100000)
+	for _, max := range []int64{1, 1000, 99999, 100000, 100001} {
+		c := limit.NewCounter(bytes.NewReader(gzipBytes(t, data)))
+		d, err := gzip.NewReader(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := limit.NewReader(d, c, limit.Limits{MaxSize: max})
+		b, err := ioutil.ReadAll(r)
+		if max < int64(len(data)) {
+			if err != limit.ErrSize || !limit.IsExceeded(err) {
+				t.Errorf("max=%d: unexpected error %v", max, err)
+			}
+			if int64(len(b)) != max {
+				t.Errorf("max=%d: read %d bytes", max, len(b))
+			}
+		} else if err != nil || !bytes.Equal(b, data) {
+			t.Errorf("max=%d: unexpected error %v", max, err)
+		}
+	}
+}
+
+func TestReaderMaxRatio(t *testing.T) {
+	t.Parallel()
+
+	data := bytes.Repeat([]byte("a"), 1<<20)
+	enc := gzipBytes(t, data)
+	ratio := float64(len(data)) / float64(len(enc))
+
+	for _, max := range []float64{ratio / 2, ratio * 2} {
+		c := limit.NewCounter(bytes.NewReader(enc))
+		d, err := gzip.NewReader(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := limit.NewReader(d, c, limit.Limits{MaxRatio: max})
+		_, err = io.Copy(ioutil.Discard, r)
+		if max < ratio && err != limit.ErrRatio {
+			t.Errorf("max=%v ratio=%v: unexpected error %v", max, ratio, err)
+		} else if max > ratio && err != nil {
+			t.Errorf("max=%v ratio=%v: unexpected error %v", max, ratio, err)
+		}
+	}
+}
+
+func TestZstdWindow(t *testing.T) {
+	t.Parallel()
+
+	data := []byte(strings.Repeat("hello world ", 1000))
+	big := []byte(strings.Repeat("hello world ", 200000))
+	for _, ws := range []int{1 << 10, 1 << 16, 1 << 20} {
+		var buf bytes.Buffer
+		w, err := zstd.NewWriter(&buf, zstd.WithWindowSize(ws), zstd.WithEncoderLevel(zstd.SpeedFastest))
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(big)
+		w.Close()
+
+		got, err := limit.ZstdWindow(bufio.NewReader(&buf))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != int64(ws) {
+			t.Errorf("window: got %d, expected %d", got, ws)
+		}
+	}
+
+	// single segment: the window is the content size
+	enc, _ := zstd.NewWriter(nil, zstd.WithSingleSegment(true))
+	b := enc.EncodeAll(data, nil)
+	got, err := limit.ZstdWindow(bufio.NewReader(bytes.NewReader(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != int64(len(data)) {
+		t.Errorf("single segment window: got %d, expected %d", got, len(data))
+	}
+
+	err = limit.CheckWindow(bufio.NewReader(bytes.NewReader(b)), limit.ZstdWindow, 1000)
+	if !limit.IsExceeded(err) {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	// Skippable frames larger than the buffer of the reader are discarded.
+	skippable := func(size int) []byte {
+		f := make([]byte, 8+size)
+		binary.LittleEndian.PutUint32(f, 0x184D2A51)
+		binary.LittleEndian.PutUint32(f[4:], uint32(size))
+		return f
+	}
+	r := bufio.NewReader(bytes.NewReader(append(append(skippable(10000), skippable(5)...), b...)))
+	got, err = limit.ZstdWindow(r)
+	if err != nil || got != int64(len(data)) {
+		t.Errorf("skippable frames: got %d, %v", got, err)
+	}
+	if dec, err := zstd.NewReader(r); err != nil {
+		t.Error(err)
+	} else if out, err := ioutil.ReadAll(dec); err != nil || !bytes.Equal(out, data) {
+		t.Errorf("skippable frames: decoding failed: %v", err)
+	}
+
+	for _, c := range []struct {
+		name  string
+		input []byte
+		ok    bool
+	}{
+		{"empty", nil, true},
+		{"only skippable", skippable(100), true},
+		{"truncated header", b[:3], false},
+		{"truncated skippable", skippable(100)[:50], false},
+		{"skippable too large", append(skippable(2<<20), b...), false},
+		{"skippable size overflow", []byte{0x50, 0x2A, 0x4D, 0x18, 0xFF, 0xFF, 0xFF, 0xFF}, false},
+	} {
+		got, err := limit.ZstdWindow(bufio.NewReader(bytes.NewReader(c.input)))
+		if c.ok && (err != nil || got != 0) {
+			t.Errorf("%s: got %d, %v", c.name, got, err)
+		} else if !c.ok && err == nil {
+			t.Errorf("%s: no error", c.name)
+		}
+	}
+}
+
+func TestBrotliWindow(t *testing.T) {
+	t.Parallel()
+
+	data := []byte(strings.Repeat("hello world ", 1000))
+	for lgwin := 10; lgwin <= 24; lgwin++ {
+		var buf bytes.Buffer
+		w := brotli.NewWriterOptions(&buf, brotli.WriterOptions{Quality: 5, LGWin: lgwin})
+		w.Write(data)
+		w.Close()
+
+		got, err := limit.BrotliWindow(bufio.NewReader(&buf))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exp := int64(1)<<uint(lgwin) - 16; got != exp {
+			t.Errorf("lgwin %d: got %d, expected %d", lgwin, got, exp)
+		}
+	}
+}
+
+func TestXZDictionary(t *testing.T) {
+	t.Parallel()
+
+	data := []byte(strings.Repeat("hello world ", 1000))
+	for _, dc := range []int{1 << 12, 1 << 16, 3 << 20, 8 << 20} {
+		var buf bytes.Buffer
+		w, err := xz.WriterConfig{DictCap: dc}.NewWriter(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(data)
+		w.Close()
+
+		got, err := limit.XZDictionary(bufio.NewReader(&buf))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != int64(dc) {
+			t.Errorf("dictionary: got %d, expected %d", got, dc)
+		}
+	}
+}
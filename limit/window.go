@@ -0,0 +1,224 @@
+package limit
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// WindowFunc returns the window size (i.e. the amount of memory that the decoder
+// needs to allocate for its history buffer) declared in the header of the encoded
+// stream read from r. Implementations must not consume data from r (they should
+// use r.Peek instead), except for data that the decoder would ignore anyway (e.g.
+// zstd skippable frames).
+type WindowFunc func(r *bufio.Reader) (int64, error)
+
+var errTruncated = errors.New("limit: truncated header")
+
+// CheckWindow returns ErrWindow if the window size returned by f for the
+// encoded stream r exceeds max, and any error returned by f.
+// Only data ignored by the decoder is consumed from r, so r can then be passed
+// to the decoder.
+func CheckWindow(r *bufio.Reader, f WindowFunc, max int64) error {
+	w, err := f(r)
+	if err != nil {
+		return err
+	}
+	if w > max {
+		return fmt.Errorf("%w: %d > %d", ErrWindow, w, max)
+	}
+	return nil
+}
+
+const (
+	zstdMagic          = 0xFD2FB528
+	zstdSkippableMagic = 0x184D2A50
+	zstdSkippableMask  = 0xFFFFFFF0
+	zstdMaxSkippable   = 16      // maximum number of leading skippable frames we are willing to skip
+	zstdMaxSkipped     = 1 << 20 // maximum total size of the leading skippable frames
+)
+
+// ZstdWindow is a WindowFunc for zstd streams (RFC 8878).
+// Leading skippable frames (up to 16 frames and 1MB in total) are discarded from r.
+// An empty stream (or one containing only skippable frames) has a window size of 0.
+// Only the header of the first zstd frame is inspected; the decoders in contrib
+// additionally enforce their own window limits (if configured) on all frames.
+func ZstdWindow(r *bufio.Reader) (int64, error) {
+	skipped := int64(0)
+	for i := 0; ; i++ {
+		hdr, err := r.Peek(8)
+		if err == io.EOF && len(hdr) == 0 {
+			return 0, nil
+		} else if err != nil {
+			return 0, errTruncated
+		}
+		magic := binary.LittleEndian.Uint32(hdr)
+		if magic&zstdSkippableMask == zstdSkippableMagic && i < zstdMaxSkippable {
+			size := 8 + int64(binary.LittleEndian.Uint32(hdr[4:]))
+			if skipped+size > zstdMaxSkipped {
+				return 0, errors.New("limit: zstd: skippable frames too large")
+			}
+			if _, err := r.Discard(int(size)); err != nil {
+				return 0, errTruncated
+			}
+			skipped += size
+			continue
+		}
+		if magic != zstdMagic {
+			return 0, errors.New("limit: zstd: invalid magic number")
+		}
+		break
+	}
+
+	hdr, err := r.Peek(6)
+	if err != nil {
+		return 0, errTruncated
+	}
+	fhd := hdr[4]
+	singleSegment := fhd&0x20 != 0
+	if !singleSegment {
+		wd := hdr[5]
+		windowLog := 10 + uint(wd>>3)
+		windowBase := int64(1) << windowLog
+		return windowBase + windowBase/8*int64(wd&7), nil
+	}
+
+	// In single segment mode the window size is the frame content size.
+	fcsOff := 5 + [4]int{0, 1, 2, 4}[fhd&3]
+	fcsSize := [4]int{1, 2, 4, 8}[fhd>>6]
+	hdr, err = r.Peek(fcsOff + fcsSize)
+	if err != nil {
+		return 0, errTruncated
+	}
+	fcs := hdr[fcsOff:]
+	switch fcsSize {
+	case 1:
+		return int64(fcs[0]), nil
+	case 2:
+		return int64(binary.LittleEndian.Uint16(fcs)) + 256, nil
+	case 4:
+		return int64(binary.LittleEndian.Uint32(fcs)), nil
+	default:
+		v := binary.LittleEndian.Uint64(fcs)
+		if v > 1<<62 {
+			v = 1 << 62
+		}
+		return int64(v), nil
+	}
+}
+
+// BrotliWindow is a WindowFunc for brotli streams (RFC 7932, including the
+// large window extension).
+func BrotliWindow(r *bufio.Reader) (int64, error) {
+	hdr, err := r.Peek(1)
+	if err != nil {
+		return 0, errTruncated
+	}
+	b := hdr[0]
+	var wbits uint
+	switch {
+	case b&1 == 0:
+		wbits = 16
+	case (b>>1)&7 != 0:
+		wbits = 17 + uint((b>>1)&7)
+	case (b>>4)&7 == 1:
+		// Large window brotli: the window size is encoded in the following 6 bits
+		// (after a reserved bit that must be zero).
+		if b&0x80 != 0 {
+			return 0, errors.New("limit: brotli: invalid large window header")
+		}
+		hdr, err := r.Peek(2)
+		if err != nil {
+			return 0, errTruncated
+		}
+		wbits = uint(hdr[1] & 0x3F)
+		if wbits < 10 || wbits > 30 {
+			return 0, errors.New("limit: brotli: invalid large window size")
+		}
+	case (b>>4)&7 != 0:
+		wbits = 8 + uint((b>>4)&7)
+	default:
+		wbits = 17
+	}
+	return int64(1)<<wbits - 16, nil
+}
+
+var xzMagic = [6]byte{0xFD, '7', 'z', 'X', 'Z', 0x00}
+
+const (
+	xzStreamHeaderSize = 12
+	xzFilterLZMA2      = 0x21
+)
+
+// XZDictionary is a WindowFunc for xz streams. It returns the size of the
+// LZMA2 dictionary declared in the header of the first block.
+// Only the first block of the first stream is inspected.
+func XZDictionary(r *bufio.Reader) (int64, error) {
+	hdr, err := r.Peek(xzStreamHeaderSize + 1)
+	if err != nil {
+		return 0, errTruncated
+	}
+	if [6]byte{hdr[0], hdr[1], hdr[2], hdr[3], hdr[4], hdr[5]} != xzMagic {
+		return 0, errors.New("limit: xz: invalid magic number")
+	}
+	if hdr[xzStreamHeaderSize] == 0 {
+		// Index indicator: the stream contains no blocks.
+		return 0, nil
+	}
+	size := (int(hdr[xzStreamHeaderSize]) + 1) * 4
+	hdr, err = r.Peek(xzStreamHeaderSize + size)
+	if err != nil {
+		return 0, errTruncated
+	}
+	bh := hdr[xzStreamHeaderSize+1:]
+	flags := bh[0]
+	bh = bh[1:]
+	// Skip the optional compressed and uncompressed sizes.
+	for _, present := range []bool{flags&0x40 != 0, flags&0x80 != 0} {
+		if present {
+			if _, bh, err = xzVLI(bh); err != nil {
+				return 0, err
+			}
+		}
+	}
+	var dict int64
+	for i := 0; i <= int(flags&3); i++ {
+		var id, propSize uint64
+		if id, bh, err = xzVLI(bh); err != nil {
+			return 0, err
+		}
+		if propSize, bh, err = xzVLI(bh); err != nil {
+			return 0, err
+		}
+		if uint64(len(bh)) < propSize {
+			return 0, errTruncated
+		}
+		if id == xzFilterLZMA2 && propSize == 1 {
+			d := bh[0]
+			switch {
+			case d > 40:
+				return 0, errors.New("limit: xz: invalid dictionary size")
+			case d == 40:
+				dict = 0xFFFFFFFF
+			default:
+				dict = int64(2|(d&1)) << (d/2 + 11)
+			}
+		}
+		bh = bh[propSize:]
+	}
+	return dict, nil
+}
+
+// xzVLI decodes a variable-length integer as used in the xz format.
+func xzVLI(b []byte) (uint64, []byte, error) {
+	var v uint64
+	for i := 0; i < 9 && i < len(b); i++ {
+		v |= uint64(b[i]&0x7F) << (7 * uint(i))
+		if b[i]&0x80 == 0 {
+			return v, b[i+1:], nil
+		}
+	}
+	return 0, nil, errTruncated
+}
@@ -0,0 +1,254 @@
+// Package metrics provides a collector of the compression statistics reported by
+// the httpcompression middleware (see httpcompression.Observer).
+//
+// The collected metrics can be published via expvar, or exposed in the Prometheus
+// text exposition format without depending on the Prometheus client library.
+package metrics
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/CAFxX/httpcompression"
+)
+
+// identity is the encoding label used for responses that were not compressed.
+const identity = "identity"
+
+var (
+	// RatioBuckets are the upper bounds of the buckets of the compression ratio
+	// (uncompressed bytes / compressed bytes) histogram.
+	RatioBuckets = []float64{1, 1.5, 2, 3, 4, 6, 8, 12, 16, 32}
+	// LatencyBuckets are the upper bounds, in seconds, of the buckets of the
+	// compressor latency histogram.
+	LatencyBuckets = []float64{.00001, .00005, .0001, .0005, .001, .005, .01, .05, .1, .5, 1}
+)
+
+// Collector collects the statistics of the responses served by the middleware.
+// Its Observe method has to be passed to the httpcompression.Observer option.
+// Collector implements expvar.Var, so it can be published with expvar.Publish
+// (or with Publish).
+// A Collector is safe for concurrent use. The zero value is not usable: use New.
+type Collector struct {
+	mu        sync.Mutex
+	encodings map[string]*encodingStats
+	skipped   map[httpcompression.SkipReason]uint64
+}
+
+type encodingStats struct {
+	Responses         uint64     `json:"responses"`
+	UncompressedBytes uint64     `json:"uncompressed_bytes"`
+	CompressedBytes   uint64     `json:"compressed_bytes"`
+	Ratio             *histogram `json:"ratio,omitempty"`
+	CompressorSeconds *histogram `json:"compressor_seconds,omitempty"`
+}
+
+var _ expvar.Var = &Collector{}
+
+// New returns a new Collector.
+func New() *Collector {
+	return &Collector{
+		encodings: map[string]*encodingStats{},
+		skipped:   map[httpcompression.SkipReason]uint64{},
+	}
+}
+
+// Observe records the statistics of a response. It has the signature required by
+// the httpcompression.Observer option.
+func (c *Collector) Observe(_ *http.Request, s httpcompression.Stats) {
+	enc := s.Encoding
+	if enc == "" {
+		enc = identity
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := c.encodings[enc]
+	if e == nil {
+		e = &encodingStats{}
+		if enc != identity {
+			e.Ratio = newHistogram(RatioBuckets)
+			e.CompressorSeconds = newHistogram(LatencyBuckets)
+		}
+		c.encodings[enc] = e
+	}
+	e.Responses++
+	e.UncompressedBytes += uint64(s.UncompressedBytes)
+	e.CompressedBytes += uint64(s.CompressedBytes)
+	if enc != identity {
+		if s.CompressedBytes > 0 {
+			e.Ratio.observe(float64(s.UncompressedBytes) / float64(s.CompressedBytes))
+		}
+		e.CompressorSeconds.observe(s.CompressorTime.Seconds())
+	}
+	if s.SkipReason != httpcompression.NotSkipped {
+		c.skipped[s.SkipReason]++
+	}
+}
+
+// String returns the collected metrics as a JSON object. It implements expvar.Var.
+func (c *Collector) String() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b, err := json.Marshal(struct {
+		Encodings map[string]*encodingStats             `json:"encodings"`
+		Skipped   map[httpcompression.SkipReason]uint64 `json:"skipped"`
+	}{c.encodings, c.skipped})
+	if err != nil {
+		// This should never happen.
+		panic(err)
+	}
+	return string(b)
+}
+
+// Publish publishes the collector via expvar with the specified name.
+// Like expvar.Publish, it panics if the name is already in use.
+func (c *Collector) Publish(name string) {
+	expvar.Publish(name, c)
+}
+
+// WritePrometheus writes the collected metrics to w in the Prometheus text
+// exposition format. All metric names are prefixed with "httpcompression_".
+func (c *Collector) WritePrometheus(w io.Writer) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	encs := make([]string, 0, len(c.encodings))
+	for enc := range c.encodings {
+		encs = append(encs, enc)
+	}
+	sort.Strings(encs)
+	reasons := make([]string, 0, len(c.skipped))
+	for r := range c.skipped {
+		reasons = append(reasons, string(r))
+	}
+	sort.Strings(reasons)
+
+	pw := &promWriter{w: w}
+	pw.header("httpcompression_responses_total", "counter", "Number of responses, by Content-Encoding.")
+	for _, enc := range encs {
+		pw.sample("httpcompression_responses_total", "encoding", enc, "", "", float64(c.encodings[enc].Responses))
+	}
+	pw.header("httpcompression_uncompressed_bytes_total", "counter", "Bytes of response bodies written by handlers, by Content-Encoding.")
+	for _, enc := range encs {
+		pw.sample("httpcompression_uncompressed_bytes_total", "encoding", enc, "", "", float64(c.encodings[enc].UncompressedBytes))
+	}
+	pw.header("httpcompression_compressed_bytes_total", "counter", "Bytes of response bodies sent to clients, by Content-Encoding.")
+	for _, enc := range encs {
+		pw.sample("httpcompression_compressed_bytes_total", "encoding", enc, "", "", float64(c.encodings[enc].CompressedBytes))
+	}
+	pw.header("httpcompression_compression_ratio", "histogram", "Compression ratio of compressed responses, by Content-Encoding.")
+	for _, enc := range encs {
+		if h := c.encodings[enc].Ratio; h != nil {
+			pw.histogram("httpcompression_compression_ratio", enc, h)
+		}
+	}
+	pw.header("httpcompression_compressor_seconds", "histogram", "Time spent in the compressor, by Content-Encoding.")
+	for _, enc := range encs {
+		if h := c.encodings[enc].CompressorSeconds; h != nil {
+			pw.histogram("httpcompression_compressor_seconds", enc, h)
+		}
+	}
+	pw.header("httpcompression_skipped_total", "counter", "Number of responses that were not compressed, by reason.")
+	for _, r := range reasons {
+		pw.sample("httpcompression_skipped_total", "reason", r, "", "", float64(c.skipped[httpcompression.SkipReason(r)]))
+	}
+	return pw.err
+}
+
+// Handler returns a http.Handler that serves the collected metrics in the
+// Prometheus text exposition format.
+func (c *Collector) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = c.WritePrometheus(w)
+	})
+}
+
+// histogram is a cumulative histogram with fixed buckets.
+type histogram struct {
+	bounds []float64
+	counts []uint64 // counts[i] is the number of observations <= bounds[i]; the last one is +Inf
+	sum    float64
+	count  uint64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{
+		bounds: bounds,
+		counts: make([]uint64, len(bounds)+1),
+	}
+}
+
+func (h *histogram) observe(v float64) {
+	for i, b := range h.bounds {
+		if v <= b {
+			h.counts[i]++
+		}
+	}
+	h.counts[len(h.bounds)]++
+	h.sum += v
+	h.count++
+}
+
+func (h *histogram) MarshalJSON() ([]byte, error) {
+	buckets := make(map[string]uint64, len(h.counts))
+	for i, b := range h.bounds {
+		buckets[formatFloat(b)] = h.counts[i]
+	}
+	buckets["+Inf"] = h.counts[len(h.bounds)]
+	return json.Marshal(struct {
+		Buckets map[string]uint64 `json:"buckets"`
+		Sum     float64           `json:"sum"`
+		Count   uint64            `json:"count"`
+	}{buckets, h.sum, h.count})
+}
+
+// promWriter writes metrics in the Prometheus text exposition format,
+// keeping track of the first error.
+type promWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (p *promWriter) printf(format string, args ...interface{}) {
+	if p.err != nil {
+		return
+	}
+	_, p.err = fmt.Fprintf(p.w, format, args...)
+}
+
+func (p *promWriter) header(name, typ, help string) {
+	p.printf("# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func (p *promWriter) sample(name, label, value, label2, value2 string, v float64) {
+	if label2 == "" {
+		p.printf("%s{%s=%q} %s\n", name, label, value, formatFloat(v))
+		return
+	}
+	p.printf("%s{%s=%q,%s=%q} %s\n", name, label, value, label2, value2, formatFloat(v))
+}
+
+func (p *promWriter) histogram(name, enc string, h *histogram) {
+	for i, b := range h.bounds {
+		p.sample(name+"_bucket", "encoding", enc, "le", formatFloat(b), float64(h.counts[i]))
+	}
+	p.sample(name+"_bucket", "encoding", enc, "le", "+Inf", float64(h.counts[len(h.bounds)]))
+	p.sample(name+"_sum", "encoding", enc, "", "", h.sum)
+	p.sample(name+"_count", "encoding", enc, "", "", float64(h.count))
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
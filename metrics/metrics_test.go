@@ -0,0 +1,125 @@
+package metrics_test
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/CAFxX/httpcompression"
+	"github.com/CAFxX/httpcompression/metrics"
+)
+
+func serve(t *testing.T, c *metrics.Collector) {
+	mw, err := httpcompression.DefaultAdapter(httpcompression.Observer(c.Observe))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.URL.Query().Get("body"))
+	}))
+	for _, req := range []struct{ ae, body string }{
+		{"gzip", strings.Repeat("hello world ", 100)},
+		{"gzip", strings.Repeat("hello world ", 200)},
+		{"br", strings.Repeat("hello world ", 100)},
+		{"gzip", "hello world"},
+		{"", strings.Repeat("hello world ", 100)},
+	} {
+		r := httptest.NewRequest("GET", "/?body="+strings.Replace(req.body, " ", "+", -1), nil)
+		r.Header.Set("Accept-Encoding", req.ae)
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+}
+
+func TestPrometheus(t *testing.T) {
+	t.Parallel()
+
+	c := metrics.New()
+	serve(t, c)
+
+	w := httptest.NewRecorder()
+	c.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	b, _ := ioutil.ReadAll(w.Body)
+	out := string(b)
+
+	for _, exp := range []string{
+		"# TYPE httpcompression_responses_total counter\n",
+		`httpcompression_responses_total{encoding="gzip"} 2` + "\n",
+		`httpcompression_responses_total{encoding="br"} 1` + "\n",
+		`httpcompression_responses_total{encoding="identity"} 2` + "\n",
+		`httpcompression_uncompressed_bytes_total{encoding="gzip"} 3600` + "\n",
+		`httpcompression_uncompressed_bytes_total{encoding="identity"} 1211` + "\n",
+		"# TYPE httpcompression_compression_ratio histogram\n",
+		`httpcompression_compression_ratio_bucket{encoding="gzip",le="+Inf"} 2` + "\n",
+		`httpcompression_compression_ratio_bucket{encoding="gzip",le="1"} 0` + "\n",
+		`httpcompression_compression_ratio_count{encoding="br"} 1` + "\n",
+		`httpcompression_compressor_seconds_count{encoding="gzip"} 2` + "\n",
+		`httpcompression_skipped_total{reason="min_size"} 1` + "\n",
+		`httpcompression_skipped_total{reason="no_common_encoding"} 1` + "\n",
+	} {
+		if !strings.Contains(out, exp) {
+			t.Errorf("missing %q in:\n%s", exp, out)
+		}
+	}
+	if strings.Contains(out, `httpcompression_compression_ratio_count{encoding="identity"}`) {
+		t.Errorf("unexpected ratio for identity:\n%s", out)
+	}
+}
+
+func TestExpvar(t *testing.T) {
+	t.Parallel()
+
+	c := metrics.New()
+	serve(t, c)
+
+	var v struct {
+		Encodings map[string]struct {
+			Responses         uint64 `json:"responses"`
+			UncompressedBytes uint64 `json:"uncompressed_bytes"`
+			CompressedBytes   uint64 `json:"compressed_bytes"`
+			Ratio             *struct {
+				Buckets map[string]uint64 `json:"buckets"`
+				Count   uint64            `json:"count"`
+			} `json:"ratio"`
+		} `json:"encodings"`
+		Skipped map[string]uint64 `json:"skipped"`
+	}
+	if err := json.Unmarshal([]byte(c.String()), &v); err != nil {
+		t.Fatal(err)
+	}
+
+	gz := v.Encodings["gzip"]
+	if gz.Responses != 2 || gz.UncompressedBytes != 3600 || gz.CompressedBytes == 0 || gz.CompressedBytes >= 3600 {
+		t.Errorf("unexpected gzip stats: %+v", gz)
+	}
+	if gz.Ratio == nil || gz.Ratio.Count != 2 || gz.Ratio.Buckets["+Inf"] != 2 {
+		t.Errorf("unexpected gzip ratio: %+v", gz.Ratio)
+	}
+	if id := v.Encodings["identity"]; id.Responses != 2 || id.Ratio != nil {
+		t.Errorf("unexpected identity stats: %+v", id)
+	}
+	if v.Skipped["min_size"] != 1 || v.Skipped["no_common_encoding"] != 1 {
+		t.Errorf("unexpected skipped: %+v", v.Skipped)
+	}
+}
+
+// published makes the names published by TestPublish unique, as the expvar
+// names can not be reused (e.g. with go test -count).
+var published int64
+
+func TestPublish(t *testing.T) {
+	t.Parallel()
+
+	c := metrics.New()
+	name := fmt.Sprintf("httpcompression_test_%d", atomic.AddInt64(&published, 1))
+	c.Publish(name)
+	if v := expvar.Get(name); v != c {
+		t.Fatalf("unexpected published var: %v", v)
+	}
+}
@@ -0,0 +1,267 @@
+package httpcompression
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// maxEncodings is the maximum number of compressors that can be enabled
+	// in Adapter, as the accepted encodings are tracked using a bitmask.
+	maxEncodings = 64
+
+	// negotiationCacheSize is the maximum number of distinct Accept-Encoding
+	// values whose negotiation is cached.
+	negotiationCacheSize = 64
+
+	// maxCachedAcceptEncoding is the maximum length of the Accept-Encoding values
+	// whose negotiation is cached.
+	maxCachedAcceptEncoding = 256
+)
+
+// encodingTable is the list of the encodings enabled in Adapter, ordered by
+// decreasing priority (and then by name). It is built once by Adapter, and it
+// is used to negotiate the Content-Encoding of each response without allocating.
+type encodingTable struct {
+	encodings    []string
+	priority     []int
+	prefer       PreferType
+	dictionaries uint64 // Bitmask of the indices of the dictionary encodings.
+
+	cache negotiationCache
+}
+
+// negotiation is the result of the negotiation of the Content-Encoding for the
+// Accept-Encoding header of a request.
+type negotiation struct {
+	accepted uint64 // Bitmask of the indices, in the encodingTable, of the accepted encodings.
+	best     int    // Index of the preferred encoding, or -1 if no encoding is accepted.
+	fallback int    // Like best, but excluding the dictionary encodings.
+	identity bool   // Whether the identity coding is acceptable.
+}
+
+func newEncodingTable(comps comps, prefer PreferType) (*encodingTable, error) {
+	if len(comps) > maxEncodings {
+		return nil, fmt.Errorf("too many compressors: %d (maximum %d)", len(comps), maxEncodings)
+	}
+	t := &encodingTable{prefer: prefer}
+	for enc := range comps {
+		t.encodings = append(t.encodings, enc)
+	}
+	sort.Slice(t.encodings, func(i, j int) bool {
+		pi, pj := comps[t.encodings[i]].priority, comps[t.encodings[j]].priority
+		if pi != pj {
+			return pi > pj // desc
+		}
+		return t.encodings[i] < t.encodings[j] // asc
+	})
+	for i, enc := range t.encodings {
+		t.priority = append(t.priority, comps[enc].priority)
+		if comps[enc].dict != nil {
+			t.dictionaries |= 1 << uint(i)
+		}
+	}
+	return t, nil
+}
+
+// negotiate returns the result of the negotiation for the Accept-Encoding header
+// values vv. It does not allocate, except when the result is added to the cache.
+func (t *encodingTable) negotiate(vv []string) negotiation {
+	if len(vv) == 1 && len(vv[0]) <= maxCachedAcceptEncoding {
+		if n, ok := t.cache.get(vv[0]); ok {
+			return n
+		}
+		n := t.parse(vv)
+		t.cache.put(vv[0], n)
+		return n
+	}
+	return t.parse(vv)
+}
+
+// parse is like negotiate, but it does not use the cache.
+func (t *encodingTable) parse(vv []string) negotiation {
+	return t.parseAmong(vv, ^uint64(0))
+}
+
+// parseAmong is like parse, but it considers only the encodings whose index is
+// set in the bitmask among (e.g. the ones for which FileServer has a sibling).
+func (t *encodingTable) parseAmong(vv []string, among uint64) negotiation {
+	var (
+		q         [maxEncodings]float64
+		explicit  uint64
+		wildcard  = -1.0
+		identityQ = -1.0
+	)
+	for _, v := range vv {
+		for v != "" {
+			var sv string
+			if i := strings.IndexByte(v, ','); i >= 0 {
+				sv, v = v[:i], v[i+1:]
+			} else {
+				sv, v = v, ""
+			}
+			coding, qvalue, ok := parseCoding(sv)
+			if !ok {
+				continue
+			}
+			switch {
+			case coding == anyCoding:
+				wildcard = qvalue
+			case strings.EqualFold(coding, identity):
+				identityQ = qvalue
+			default:
+				if i := t.index(coding); i >= 0 {
+					q[i] = qvalue
+					explicit |= 1 << uint(i)
+				}
+			}
+		}
+	}
+
+	n := negotiation{best: -1, fallback: -1, identity: true}
+	switch {
+	case identityQ >= 0:
+		n.identity = identityQ > 0
+	case wildcard >= 0:
+		n.identity = wildcard > 0
+	}
+	for i := range t.encodings {
+		if explicit&(1<<uint(i)) == 0 {
+			q[i] = wildcard
+		}
+		if q[i] <= 0 || among&(1<<uint(i)) == 0 {
+			continue
+		}
+		n.accepted |= 1 << uint(i)
+		if n.best < 0 || t.better(i, n.best, &q) {
+			n.best = i
+		}
+		if t.dictionaries&(1<<uint(i)) == 0 && (n.fallback < 0 || t.better(i, n.fallback, &q)) {
+			n.fallback = i
+		}
+	}
+	return n
+}
+
+// withoutDictionaries returns the negotiation n, excluding the dictionary
+// encodings, e.g. because the client has no dictionary that can be used.
+func (t *encodingTable) withoutDictionaries(n negotiation) negotiation {
+	n.accepted &^= t.dictionaries
+	n.best = n.fallback
+	return n
+}
+
+// better returns true if the encoding at index i is preferable to the one at
+// index j, according to the PreferType.
+func (t *encodingTable) better(i, j int, q *[maxEncodings]float64) bool {
+	pi, pj := t.priority[i], t.priority[j]
+	qi, qj := q[i], q[j]
+	switch t.prefer {
+	case PreferClient:
+		if qi != qj {
+			return qi > qj
+		}
+		if pi != pj {
+			return pi > pj
+		}
+	default:
+		if pi != pj {
+			return pi > pj
+		}
+		if qi != qj {
+			return qi > qj
+		}
+	}
+	return t.encodings[i] < t.encodings[j]
+}
+
+// index returns the index of the specified coding, or one of its aliases, in
+// the table, or -1 if it is not present.
+func (t *encodingTable) index(coding string) int {
+	coding = resolveAlias(coding)
+	for i, enc := range t.encodings {
+		if strings.EqualFold(coding, enc) {
+			return i
+		}
+	}
+	return -1
+}
+
+// accepts returns true if the encoding enc is accepted.
+func (t *encodingTable) accepts(n negotiation, enc string) bool {
+	i := t.index(enc)
+	return i >= 0 && n.accepted&(1<<uint(i)) != 0
+}
+
+// acceptedEncodings returns the list of the accepted encodings, in table order.
+func (t *encodingTable) acceptedEncodings(n negotiation) []string {
+	var encs []string
+	for i, enc := range t.encodings {
+		if n.accepted&(1<<uint(i)) != 0 {
+			encs = append(encs, enc)
+		}
+	}
+	return encs
+}
+
+// negotiationCache caches the negotiation of the most common Accept-Encoding
+// values. Lookups are lock-free: the map is replaced, never modified, when a
+// value is added. Once full, adding a value evicts the ones that have not been
+// used since the cache was last full, so that a burst of unusual values can not
+// permanently displace the common ones.
+type negotiationCache struct {
+	m  atomic.Value // map[string]*cachedNegotiation
+	mu sync.Mutex
+}
+
+type cachedNegotiation struct {
+	n    negotiation
+	used uint32 // Set by get, cleared by put when the cache is full.
+}
+
+func (c *negotiationCache) get(accept string) (negotiation, bool) {
+	m, _ := c.m.Load().(map[string]*cachedNegotiation)
+	e, ok := m[accept]
+	if !ok {
+		return negotiation{}, false
+	}
+	if atomic.LoadUint32(&e.used) == 0 {
+		atomic.StoreUint32(&e.used, 1)
+	}
+	return e.n, true
+}
+
+func (c *negotiationCache) put(accept string, n negotiation) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	m, _ := c.m.Load().(map[string]*cachedNegotiation)
+	if _, ok := m[accept]; ok {
+		return
+	}
+	full := len(m) >= negotiationCacheSize
+	nm := make(map[string]*cachedNegotiation, len(m)+1)
+	for k, e := range m {
+		if full {
+			// Evict the entries not used since the cache was last full, and give
+			// the others another chance.
+			if atomic.LoadUint32(&e.used) == 0 {
+				continue
+			}
+			atomic.StoreUint32(&e.used, 0)
+		}
+		nm[k] = e
+	}
+	if len(nm) >= negotiationCacheSize {
+		// All the entries have been used: evict a random one.
+		for k := range nm {
+			delete(nm, k)
+			break
+		}
+	}
+	// Copy the key, so that the request it comes from is not retained.
+	nm[string(append([]byte(nil), accept...))] = &cachedNegotiation{n: n}
+	c.m.Store(nm)
+}
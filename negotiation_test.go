@@ -0,0 +1,222 @@
+package httpcompression
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var negotiationTestHeaders = []string{
+	"",
+	"gzip",
+	"gzip, deflate, br",
+	"gzip, deflate, br, zstd",
+	"gzip, deflate",
+	"br;q=1.0, gzip;q=0.8, *;q=0.1",
+	"gzip;q=0.5, br;q=0.5",
+	"deflate;q=1, gzip;q=0.9, br;q=0.9, zstd;q=0.1",
+	"*",
+	"*;q=0",
+	"*;q=0, identity",
+	"identity",
+	"identity;q=0",
+	"identity;q=0, gzip;q=0",
+	"x-gzip",
+	"GZIP, Br",
+	"gzip;q=2",
+	"gzip;q=0.1234, br",
+	"zstd;q=0, *",
+	"unknown",
+	" , ;q=1, gzip ; q = 0.3 ;level=5,",
+}
+
+func TestNegotiationTable(t *testing.T) {
+	t.Parallel()
+
+	c := config{compressor: comps{}}
+	for _, o := range []Option{
+		DeflateCompressionLevel(1),
+		GzipCompressionLevel(1),
+		BrotliCompressionLevel(1),
+		defaultZstandardCompressor(),
+	} {
+		assert.NoError(t, o(&c))
+	}
+	server, err := newEncodingTable(c.compressor, PreferServer)
+	assert.NoError(t, err)
+	client, err := newEncodingTable(c.compressor, PreferClient)
+	assert.NoError(t, err)
+
+	cases := []struct {
+		vv       []string
+		accepted []string // In table order.
+		server   string   // Best encoding with PreferServer.
+		client   string   // Best encoding with PreferClient.
+		identity bool
+	}{
+		{[]string{""}, nil, "", "", true},
+		{[]string{"", "gzip;q=0.3"}, []string{"gzip"}, "gzip", "gzip", true},
+		{[]string{"gzip"}, []string{"gzip"}, "gzip", "gzip", true},
+		{[]string{"gzip, deflate, br"}, []string{"br", "gzip", "deflate"}, "br", "br", true},
+		{[]string{"gzip, deflate, br, zstd"}, []string{"zstd", "br", "gzip", "deflate"}, "zstd", "zstd", true},
+		{[]string{"gzip, deflate", "gzip;q=0.3"}, []string{"gzip", "deflate"}, "gzip", "deflate", true},
+		{[]string{"br;q=1.0, gzip;q=0.8, *;q=0.1"}, []string{"zstd", "br", "gzip", "deflate"}, "zstd", "br", true},
+		{[]string{"gzip;q=0.5, br;q=0.5"}, []string{"br", "gzip"}, "br", "br", true},
+		{[]string{"deflate;q=1, gzip;q=0.9, br;q=0.9, zstd;q=0.1"}, []string{"zstd", "br", "gzip", "deflate"}, "zstd", "deflate", true},
+		{[]string{"*"}, []string{"zstd", "br", "gzip", "deflate"}, "zstd", "zstd", true},
+		{[]string{"*;q=0"}, nil, "", "", false},
+		{[]string{"*;q=0", "gzip;q=0.3"}, []string{"gzip"}, "gzip", "gzip", false},
+		{[]string{"*;q=0, identity"}, nil, "", "", true},
+		{[]string{"identity"}, nil, "", "", true},
+		{[]string{"identity;q=0"}, nil, "", "", false},
+		{[]string{"identity;q=0, gzip;q=0"}, nil, "", "", false},
+		{[]string{"x-gzip"}, []string{"gzip"}, "gzip", "gzip", true},
+		{[]string{"GZIP, Br"}, []string{"br", "gzip"}, "br", "br", true},
+		{[]string{"gzip;q=2"}, nil, "", "", true},
+		{[]string{"gzip;q=0.1234, br"}, []string{"br"}, "br", "br", true},
+		{[]string{"gzip;q=0.1234, br", "gzip;q=0.3"}, []string{"br", "gzip"}, "br", "br", true},
+		{[]string{"zstd;q=0, *"}, []string{"br", "gzip", "deflate"}, "br", "br", true},
+		{[]string{"unknown"}, nil, "", "", true},
+		{[]string{" , ;q=1, gzip ; q = 0.3 ;level=5,"}, []string{"gzip"}, "gzip", "gzip", true},
+	}
+	best := func(t *encodingTable, n negotiation) string {
+		if n.best < 0 {
+			return ""
+		}
+		return t.encodings[n.best]
+	}
+	for _, c := range cases {
+		for i := 0; i < 2; i++ { // uncached and cached
+			n := server.negotiate(c.vv)
+			assert.Equal(t, c.accepted, server.acceptedEncodings(n), "%q", c.vv)
+			assert.Equal(t, c.identity, n.identity, "%q", c.vv)
+			assert.Equal(t, c.server, best(server, n), "%q", c.vv)
+			assert.Equal(t, c.client, best(client, client.negotiate(c.vv)), "%q", c.vv)
+		}
+	}
+
+	// Only some of the accepted encodings can be used.
+	among := uint64(1<<uint(server.index("gzip")) | 1<<uint(server.index("deflate")))
+	n := server.parseAmong([]string{"deflate;q=1, gzip;q=0.9, br"}, among)
+	assert.Equal(t, []string{"gzip", "deflate"}, server.acceptedEncodings(n))
+	assert.Equal(t, "gzip", best(server, n))
+	assert.Equal(t, "deflate", best(client, client.parseAmong([]string{"deflate;q=1, gzip;q=0.9, br"}, among)))
+}
+
+func TestNegotiationTooManyEncodings(t *testing.T) {
+	t.Parallel()
+
+	var opts []Option
+	for i := 0; i <= maxEncodings; i++ {
+		opts = append(opts, Compressor(string(rune('a'+i%26))+string(rune('a'+i/26)), i, fakeCompressor{}))
+	}
+	_, err := Adapter(opts...)
+	assert.Error(t, err)
+}
+
+func TestNegotiationCache(t *testing.T) {
+	t.Parallel()
+
+	table, err := newEncodingTable(comps{"gzip": {comp: fakeCompressor{}}}, PreferServer)
+	assert.NoError(t, err)
+	cached := func(h string) bool {
+		_, ok := table.cache.get(h)
+		return ok
+	}
+	junk := func(i int) string {
+		return "gzip;q=0." + string(rune('0'+i%10)) + string(rune('0'+i/10%10)) + string(rune('0'+i/100%10))
+	}
+
+	// A burst of unusual values fills the cache.
+	for i := 0; i < negotiationCacheSize; i++ {
+		table.negotiate([]string{junk(i)})
+	}
+	m, _ := table.cache.m.Load().(map[string]*cachedNegotiation)
+	assert.Len(t, m, negotiationCacheSize)
+
+	// A common value can still be added, and it stays cached as long as it is
+	// used, while more unusual values are added.
+	const common = "gzip, deflate, br"
+	table.negotiate([]string{common})
+	assert.True(t, cached(common))
+	for i := negotiationCacheSize; i < 10*negotiationCacheSize; i++ {
+		table.negotiate([]string{junk(i)})
+		assert.Equal(t, 0, table.negotiate([]string{common}).best)
+		assert.True(t, cached(common), "%d", i)
+	}
+	m, _ = table.cache.m.Load().(map[string]*cachedNegotiation)
+	assert.True(t, len(m) <= negotiationCacheSize)
+
+	n := table.negotiate([]string{"gzip;q=0.99"})
+	assert.Equal(t, 0, n.best)
+	n = table.negotiate([]string{"gzip;q=0"})
+	assert.Equal(t, -1, n.best)
+}
+
+func TestNegotiationAllocs(t *testing.T) {
+	table, err := newEncodingTable(comps{
+		"gzip": {comp: fakeCompressor{}, priority: -200},
+		"br":   {comp: fakeCompressor{}, priority: -100},
+		"zstd": {comp: fakeCompressor{}, priority: -50},
+	}, PreferServer)
+	assert.NoError(t, err)
+	for _, h := range negotiationTestHeaders {
+		vv := []string{h}
+		table.negotiate(vv) // populate the cache
+		assert.Equal(t, 0.0, testing.AllocsPerRun(100, func() { table.negotiate(vv) }), "cached %q", h)
+		assert.Equal(t, 0.0, testing.AllocsPerRun(100, func() { table.parse(vv) }), "uncached %q", h)
+	}
+}
+
+func BenchmarkNegotiation(b *testing.B) {
+	c := config{compressor: comps{}}
+	for _, o := range []Option{
+		DeflateCompressionLevel(1),
+		GzipCompressionLevel(1),
+		BrotliCompressionLevel(1),
+		defaultZstandardCompressor(),
+	} {
+		if err := o(&c); err != nil {
+			b.Fatal(err)
+		}
+	}
+	table, err := newEncodingTable(c.compressor, PreferServer)
+	if err != nil {
+		b.Fatal(err)
+	}
+	vv := []string{"gzip, deflate, br, zstd"}
+
+	b.Run("cached", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			table.negotiate(vv)
+		}
+	})
+	b.Run("uncached", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			table.parse(vv)
+		}
+	})
+}
+
+// BenchmarkNegotiationAdapter measures the overhead of the middleware for responses
+// that are not compressed. The only allocation is the Vary header value.
+func BenchmarkNegotiationAdapter(b *testing.B) {
+	mw, err := DefaultAdapter()
+	if err != nil {
+		b.Fatal(err)
+	}
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(acceptEncoding, "gzip, deflate, br, zstd")
+	w := &discardResponseWriter{}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		w.reset()
+		h.ServeHTTP(w, r)
+	}
+}
@@ -0,0 +1,57 @@
+package httpcompression
+
+import (
+	"errors"
+	"net/http"
+)
+
+// Negotiator selects the Content-Encoding of the responses. It can be used to
+// implement custom policies, e.g. to use an encoding only for some clients, or
+// to take into account the cost of the different encodings.
+type Negotiator interface {
+	// Negotiate returns the Content-Encoding to be used for the response to r,
+	// that is about to be compressed. accept contains the content-codings listed
+	// by the client in the Accept-Encoding header, with their qvalues (aliases
+	// such as "x-gzip" are resolved, and the "*" wildcard is included as is).
+	// candidates contains the enabled encodings that are acceptable to the client,
+	// ordered by decreasing server priority; it is never empty. header contains the
+	// headers of the response (e.g. its Content-Type), and must not be modified.
+	//
+	// Negotiate must return one of the candidates; if it returns any other value
+	// (e.g. the empty string) the response is sent uncompressed.
+	// Negotiate is not called if the response is not going to be compressed (e.g.
+	// because it is smaller than MinSize), or if no candidates are available.
+	// Negotiate is called concurrently by multiple goroutines.
+	Negotiate(r *http.Request, accept map[string]float64, candidates []string, header http.Header) string
+}
+
+// NegotiatorFunc is an adapter to allow the use of ordinary functions as Negotiator.
+type NegotiatorFunc func(r *http.Request, accept map[string]float64, candidates []string, header http.Header) string
+
+// Negotiate calls f(r, accept, candidates, header).
+func (f NegotiatorFunc) Negotiate(r *http.Request, accept map[string]float64, candidates []string, header http.Header) string {
+	return f(r, accept, candidates, header)
+}
+
+// Negotiation is an option that sets the Negotiator used to select the
+// Content-Encoding of the responses, overriding Prefer.
+// If no Negotiator is set (the default), the encoding is selected according
+// to Prefer.
+func Negotiation(n Negotiator) Option {
+	return func(c *config) error {
+		if n == nil {
+			return errors.New("negotiator can not be nil")
+		}
+		c.negotiator = n
+		return nil
+	}
+}
+
+func contains(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,119 @@
+package httpcompression
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/CAFxX/httpcompression/contrib/klauspost/zstd"
+	"github.com/stretchr/testify/assert"
+)
+
+// mobileNegotiator uses zstd only for the mobile app, and does not compress images.
+var mobileNegotiator = NegotiatorFunc(func(r *http.Request, accept map[string]float64, candidates []string, header http.Header) string {
+	if strings.HasPrefix(header.Get(contentType), "image/") {
+		return ""
+	}
+	for _, enc := range candidates {
+		if enc != zstd.Encoding || strings.HasPrefix(r.UserAgent(), "MobileApp/") {
+			return enc
+		}
+	}
+	return ""
+})
+
+func TestNegotiator(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		ua       string
+		ae       string
+		ct       string
+		encoding string
+		skip     SkipReason
+	}{
+		{"MobileApp/1.0", "gzip, br, zstd", "text/plain", "zstd", NotSkipped},
+		{"Browser/1.0", "gzip, br, zstd", "text/plain", "br", NotSkipped},
+		{"Browser/1.0", "zstd", "text/plain", "", SkipNegotiator},
+		{"MobileApp/1.0", "gzip, br, zstd", "image/bmp", "", SkipNegotiator},
+		{"MobileApp/1.0", "identity", "text/plain", "", SkipNoCommonEncoding},
+	}
+	for _, c := range cases {
+		var stats Stats
+		h := newTestHandlerWithType(c.ct,
+			Negotiation(mobileNegotiator),
+			Observer(func(r *http.Request, s Stats) { stats = s }),
+		)
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("User-Agent", c.ua)
+		r.Header.Set(acceptEncoding, c.ae)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		assert.Equal(t, c.encoding, w.Header().Get(contentEncoding), "%+v", c)
+		assert.Equal(t, c.skip, stats.SkipReason, "%+v", c)
+		if c.encoding == "" {
+			assert.Equal(t, testBody, w.Body.String())
+		}
+	}
+}
+
+func TestNegotiatorArguments(t *testing.T) {
+	t.Parallel()
+
+	var (
+		gotAccept     map[string]float64
+		gotCandidates []string
+		gotType       string
+	)
+	h := newTestHandlerWithType("text/plain", Negotiation(NegotiatorFunc(func(r *http.Request, accept map[string]float64, candidates []string, header http.Header) string {
+		gotAccept, gotCandidates, gotType = accept, candidates, header.Get(contentType)
+		return "unknown"
+	})))
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(acceptEncoding, "x-gzip;q=0.5, deflate, *;q=0.1, zstd;q=0")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	assert.Equal(t, map[string]float64{"gzip": 0.5, "deflate": 1, "*": 0.1, "zstd": 0}, gotAccept)
+	assert.Equal(t, []string{"br", "gzip", "deflate"}, gotCandidates)
+	assert.Equal(t, "text/plain", gotType)
+	assert.Equal(t, "", w.Header().Get(contentEncoding))
+
+	_, err := DefaultAdapter(Negotiation(nil))
+	assert.Error(t, err)
+}
+
+func TestNegotiatorFileServer(t *testing.T) {
+	t.Parallel()
+
+	fsys := fstest.MapFS{
+		"a.txt":     {Data: []byte(testBody)},
+		"a.txt.gz":  {Data: gzipStrLevel(testBody, 9)},
+		"a.txt.zst": {Data: zstdStrLevel(testBody, 1)},
+	}
+	h, err := FileServer(fsys, GzipCompressionLevel(9), defaultZstandardCompressor(), Negotiation(mobileNegotiator))
+	assert.NoError(t, err)
+
+	for ua, enc := range map[string]string{"MobileApp/1.0": "zstd", "Browser/1.0": "gzip"} {
+		r := httptest.NewRequest(http.MethodGet, "/a.txt", nil)
+		r.Header.Set("User-Agent", ua)
+		r.Header.Set(acceptEncoding, "gzip, zstd")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		assert.Equal(t, enc, w.Header().Get(contentEncoding), ua)
+	}
+}
+
+func newTestHandlerWithType(ct string, opts ...Option) http.Handler {
+	mw, err := DefaultAdapter(opts...)
+	if err != nil {
+		panic(err)
+	}
+	return mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(contentType, ct)
+		w.Write([]byte(testBody))
+	}))
+}
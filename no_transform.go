@@ -0,0 +1,32 @@
+package httpcompression
+
+import (
+	"net/http"
+	"strings"
+)
+
+const cacheControl = "Cache-Control"
+
+// RequestNoTransform is an option that controls whether the Cache-Control:
+// no-transform directive in requests disables the compression of the responses.
+// The default is false, i.e. only the directive in responses is honored: responses
+// with Cache-Control: no-transform (e.g. signed payloads) are never compressed.
+func RequestNoTransform(honor bool) Option {
+	return func(c *config) error {
+		c.requestNoTransform = honor
+		return nil
+	}
+}
+
+// noTransform returns true if the Cache-Control header in h contains the
+// no-transform directive.
+func noTransform(h http.Header) bool {
+	for _, v := range h.Values(cacheControl) {
+		for _, d := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(d), "no-transform") {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+package httpcompression
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNoTransform(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name       string
+		requestCC  string
+		responseCC string
+		honor      bool
+		cl         bool // Set Content-Length, so that the fast path is used.
+		encoding   string
+		skip       SkipReason
+	}{
+		{"none", "", "", false, false, "gzip", NotSkipped},
+		{"response", "", "no-transform", false, false, "", SkipNoTransform},
+		{"response fast path", "", "no-transform", false, true, "", SkipNoTransform},
+		{"response multiple directives", "", "public, No-Transform, max-age=60", false, false, "", SkipNoTransform},
+		{"response other directives", "", "no-cache, max-age=60", false, false, "gzip", NotSkipped},
+		{"request ignored", "no-transform", "", false, false, "gzip", NotSkipped},
+		{"request honored", "no-transform", "", true, false, "", SkipNoTransform},
+		{"request honored other directives", "no-cache", "", true, false, "gzip", NotSkipped},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var stats Stats
+			mw, err := DefaultAdapter(
+				RequestNoTransform(c.honor),
+				Observer(func(r *http.Request, s Stats) {
+					stats = s
+				}),
+			)
+			assert.Nil(t, err)
+			h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if c.responseCC != "" {
+					w.Header().Set(cacheControl, c.responseCC)
+				}
+				if c.cl {
+					w.Header().Set(contentType, "text/plain")
+					w.Header().Set(contentLength, strconv.Itoa(len(testBody)))
+				}
+				w.Write([]byte(testBody))
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set(acceptEncoding, "gzip")
+			if c.requestCC != "" {
+				r.Header.Set(cacheControl, c.requestCC)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			assert.Equal(t, c.encoding, w.Header().Get(contentEncoding))
+			assert.Equal(t, c.encoding, stats.Encoding)
+			assert.Equal(t, c.skip, stats.SkipReason)
+			if c.encoding == "" {
+				assert.Equal(t, testBody, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package httpcompression
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// SkipReason is the reason why a response was not compressed.
+type SkipReason string
+
+const (
+	// NotSkipped means that the response was compressed.
+	NotSkipped SkipReason = ""
+	// SkipMinSize means that the response body was smaller than MinSize.
+	SkipMinSize SkipReason = "min_size"
+	// SkipContentType means that the Content-Type of the response was excluded by ContentTypes.
+	SkipContentType SkipReason = "content_type"
+	// SkipAlreadyEncoded means that the response already had a Content-Encoding.
+	SkipAlreadyEncoded SkipReason = "already_encoded"
+	// SkipNoCommonEncoding means that the client does not accept any of the enabled Content-Encodings.
+	SkipNoCommonEncoding SkipReason = "no_common_encoding"
+	// SkipNoTransform means that the response (or the request, see RequestNoTransform)
+	// had a Cache-Control: no-transform directive.
+	SkipNoTransform SkipReason = "no_transform"
+	// SkipNegotiator means that the Negotiator did not select any of the candidate encodings.
+	SkipNegotiator SkipReason = "negotiator"
+	// SkipNotModified means that the response was turned into a 304 Not Modified
+	// because its rewritten ETag matched the request (see ETags), so its body was discarded.
+	SkipNotModified SkipReason = "not_modified"
+)
+
+// Stats describes how a response was served. It is passed to the function set with Observer.
+type Stats struct {
+	// Encoding is the Content-Encoding used to compress the response, or the
+	// empty string if the response was not compressed.
+	Encoding string
+	// SkipReason is the reason why the response was not compressed.
+	// It is NotSkipped if the response was compressed.
+	SkipReason SkipReason
+	// UncompressedBytes is the number of bytes of the response body written by the handler.
+	UncompressedBytes int64
+	// CompressedBytes is the number of bytes of the response body written to the
+	// parent ResponseWriter. If the response was not compressed it is equal to
+	// UncompressedBytes, unless the body was discarded (SkipNotModified).
+	CompressedBytes int64
+	// CompressorTime is the time spent in the compressor, excluding the time spent writing
+	// to the parent ResponseWriter. It is zero if the response was not compressed.
+	CompressorTime time.Duration
+}
+
+// Observer is an option that sets a function that is called at the end of each response
+// served by the middleware, with statistics about the compression of the response.
+// The function is called synchronously from the goroutine that is serving the request,
+// so it should not block.
+// If observer is nil (the default), statistics are not collected.
+func Observer(observer func(r *http.Request, stats Stats)) Option {
+	return func(c *config) error {
+		c.observer = observer
+		return nil
+	}
+}
+
+// countingWriter counts the bytes written to, and the time spent writing to, the
+// parent writer. It is used to compute the Stats of compressed responses.
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	d   time.Duration
+	now func() time.Time
+}
+
+func (w *countingWriter) Write(b []byte) (int, error) {
+	start := w.now()
+	n, err := w.w.Write(b)
+	w.d += w.now().Sub(start)
+	w.n += int64(n)
+	return n, err
+}
+
+// observeWriter wraps the ResponseWriter of responses that are not handled by
+// compressWriter, to count the bytes written by the handler.
+type observeWriter struct {
+	http.ResponseWriter
+	n int64
+}
+
+func (w *observeWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	w.n += int64(n)
+	return n, err
+}
+
+func (w *observeWriter) Flush() {
+	if fw, ok := w.ResponseWriter.(http.Flusher); ok {
+		fw.Flush()
+	}
+}
+
+func (w *observeWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hj, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return hj.Hijack()
+	}
+	return nil, nil, fmt.Errorf("http.Hijacker interface is not supported")
+}
+
+// Unwrap allows http.ResponseController to access the parent ResponseWriter.
+func (w *observeWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
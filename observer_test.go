@@ -0,0 +1,88 @@
+package httpcompression
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestObserver(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name     string
+		ae       string
+		ct       string
+		ce       string
+		body     string
+		encoding string
+		skip     SkipReason
+	}{
+		{"gzip", "gzip", "text/plain", "", testBody, "gzip", NotSkipped},
+		{"br", "br", "", "", testBody, "br", NotSkipped},
+		{"min size", "gzip", "text/plain", "", smallTestBody, "", SkipMinSize},
+		{"min size unknown type", "gzip", "", "", smallTestBody, "", SkipMinSize},
+		{"content type", "gzip", "image/jpeg", "", testBody, "", SkipContentType},
+		{"already encoded", "gzip", "text/plain", "gzip", testBody, "", SkipAlreadyEncoded},
+		{"no common encoding", "identity", "text/plain", "", testBody, "", SkipNoCommonEncoding},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var stats []Stats
+			mw, err := DefaultAdapter(
+				ContentTypes([]string{"image/jpeg"}, true),
+				Observer(func(r *http.Request, s Stats) {
+					stats = append(stats, s)
+				}),
+			)
+			assert.Nil(t, err)
+			h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if c.ct != "" {
+					w.Header().Set(contentType, c.ct)
+				}
+				if c.ce != "" {
+					w.Header().Set(contentEncoding, c.ce)
+				}
+				io.WriteString(w, c.body[:len(c.body)/2])
+				io.WriteString(w, c.body[len(c.body)/2:])
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set(acceptEncoding, c.ae)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if assert.Len(t, stats, 1) {
+				s := stats[0]
+				assert.Equal(t, c.encoding, s.Encoding)
+				assert.Equal(t, c.skip, s.SkipReason)
+				assert.Equal(t, int64(len(c.body)), s.UncompressedBytes)
+				assert.Equal(t, int64(w.Body.Len()), s.CompressedBytes)
+				if c.encoding != "" {
+					assert.True(t, s.CompressedBytes < s.UncompressedBytes)
+					assert.True(t, s.CompressorTime > 0)
+				} else {
+					assert.Equal(t, s.UncompressedBytes, s.CompressedBytes)
+					assert.Equal(t, int64(0), int64(s.CompressorTime))
+				}
+			}
+		})
+	}
+}
+
+func TestObserverNotModified(t *testing.T) {
+	t.Parallel()
+
+	var stats []Stats
+	h := etagHandler(t, false, ETags(ETagSuffix), Observer(func(r *http.Request, s Stats) {
+		stats = append(stats, s)
+	}))
+	res := etagGet(h, "gzip", `"v1-gzip"`)
+	assert.Equal(t, http.StatusNotModified, res.Code)
+	if assert.Len(t, stats, 1) {
+		assert.Equal(t, Stats{SkipReason: SkipNotModified, UncompressedBytes: int64(len(testBody))}, stats[0])
+	}
+}
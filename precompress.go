@@ -0,0 +1,159 @@
+package httpcompression
+
+import (
+	"bytes"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// PrecompressedFile describes the outcome of the precompression of a file
+// with one of the compressors. It is returned by PrecompressDir.
+type PrecompressedFile struct {
+	// Path is the path of the original file.
+	Path string
+	// Encoding is the Content-Encoding of the sibling.
+	Encoding string
+	// Size is the size of the original file.
+	Size int64
+	// CompressedSize is the size of the compressed file.
+	CompressedSize int64
+	// Written is true if the sibling has been written, false if it was skipped
+	// because it was not smaller than the original file.
+	Written bool
+}
+
+// PrecompressDir walks the directory dir and writes, for each eligible file, a
+// precompressed sibling (e.g. "style.css.br" for "style.css") for each of the
+// configured compressors for which a sibling extension is defined (see
+// PrecompressedExtension), so that they can be served by FileServer.
+// It accepts the same options as FileServer, and applies the same rules used by
+// Adapter to decide whether a response has to be compressed: files smaller than
+// MinSize, or whose Content-Type (determined like FileServer does) is excluded
+// by ContentTypes, are skipped. Precompressed siblings are skipped as well.
+// Compressed files that are not smaller than the original are not written (and
+// existing siblings are removed).
+// Siblings get the same modification time of the original file, so that
+// repeated runs on unchanged inputs produce the same outputs.
+// Siblings are written atomically, replacing existing ones.
+// Encodings using a dictionary compressor (see DictionaryCompressor) are skipped,
+// as the compressed data depends on the dictionary available to each client.
+func PrecompressDir(dir string, opts ...Option) ([]PrecompressedFile, error) {
+	c := config{
+		prefer:        PreferServer,
+		compressor:    comps{},
+		precompressed: map[string]string{},
+	}
+	for enc, ext := range defaultPrecompressedExtensions {
+		c.precompressed[enc] = ext
+	}
+	for _, o := range opts {
+		err := o(&c)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var encs []string
+	exts := map[string]bool{}
+	for enc, ext := range c.precompressed {
+		exts[ext] = true
+		if _, ok := c.compressor[enc]; ok {
+			encs = append(encs, enc)
+		}
+	}
+	sort.Strings(encs)
+
+	fsys := os.DirFS(dir)
+	var res []PrecompressedFile
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() || exts[filepath.Ext(name)] {
+			return err
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if fi.Size() < int64(c.minSize) {
+			return nil
+		}
+		ct, err := fileContentType(fsys, name)
+		if err != nil {
+			return err
+		}
+		if !handleContentType(ct, c.contentTypes, c.blacklist) {
+			return nil
+		}
+
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		buf, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		for _, enc := range encs {
+			cc, _ := c.compressorFor(enc, ct)
+			if cc.comp == nil {
+				continue
+			}
+			f, err := precompressFile(path, buf, fi, enc, cc.comp, c.precompressed[enc])
+			if err != nil {
+				return err
+			}
+			res = append(res, f)
+		}
+		return nil
+	})
+	return res, err
+}
+
+func precompressFile(path string, buf []byte, fi fs.FileInfo, enc string, comp CompressorProvider, ext string) (PrecompressedFile, error) {
+	f := PrecompressedFile{
+		Path:     path,
+		Encoding: enc,
+		Size:     int64(len(buf)),
+	}
+
+	var cbuf bytes.Buffer
+	cw := comp.Get(&cbuf)
+	_, err := cw.Write(buf)
+	if cerr := cw.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return f, err
+	}
+	f.CompressedSize = int64(cbuf.Len())
+	if f.CompressedSize >= f.Size {
+		// Remove stale siblings, if any, as they would be served by FileServer.
+		if err := os.Remove(path + ext); err != nil && !os.IsNotExist(err) {
+			return f, err
+		}
+		return f, nil
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return f, err
+	}
+	defer os.Remove(tmp.Name()) // no-op if the file has been renamed
+	_, err = tmp.Write(cbuf.Bytes())
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), fi.Mode().Perm())
+	}
+	if err == nil {
+		err = os.Chtimes(tmp.Name(), fi.ModTime(), fi.ModTime())
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path+ext)
+	}
+	if err != nil {
+		return f, err
+	}
+	f.Written = true
+	return f, nil
+}
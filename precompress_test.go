@@ -0,0 +1,108 @@
+package httpcompression
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/CAFxX/httpcompression/contrib/klauspost/zstd"
+	"github.com/CAFxX/httpcompression/dictionary"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrecompressDir(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	random := make([]byte, 4096)
+	rand.New(rand.NewSource(1)).Read(random)
+	files := map[string][]byte{
+		"a.txt":         []byte(testBody),
+		"sub/b.css":     []byte(testBody),
+		"small.txt":     []byte(smallTestBody),
+		"image.jpg":     []byte(testBody),
+		"random.bin":    random,
+		"random.bin.gz": []byte("stale"),
+		"a.txt.gz":      []byte("stale"),
+	}
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	for name, data := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		assert.Nil(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.Nil(t, ioutil.WriteFile(path, data, 0644))
+		assert.Nil(t, os.Chtimes(path, mtime, mtime))
+	}
+
+	res, err := PrecompressDir(dir,
+		GzipCompressionLevel(gzip.BestCompression),
+		BrotliCompressionLevel(11),
+		DeflateCompressionLevel(9), // no sibling extension: ignored
+		MinSize(DefaultMinSize),
+		ContentTypes([]string{"image/jpeg"}, true),
+	)
+	assert.Nil(t, err)
+
+	written := map[string]bool{}
+	for _, f := range res {
+		rel, _ := filepath.Rel(dir, f.Path)
+		written[filepath.ToSlash(rel)+":"+f.Encoding] = f.Written
+	}
+	assert.Equal(t, map[string]bool{
+		"a.txt:br":        true,
+		"a.txt:gzip":      true,
+		"sub/b.css:br":    true,
+		"sub/b.css:gzip":  true,
+		"random.bin:br":   false,
+		"random.bin:gzip": false,
+	}, written)
+
+	for _, name := range []string{"a.txt.gz", "a.txt.br", "sub/b.css.gz", "sub/b.css.br"} {
+		fi, err := os.Stat(filepath.Join(dir, filepath.FromSlash(name)))
+		if assert.Nil(t, err, name) {
+			assert.True(t, fi.ModTime().Equal(mtime), name)
+		}
+	}
+	for _, name := range []string{"small.txt.gz", "image.jpg.gz", "random.bin.gz", "random.bin.br", "a.txt.gz.gz"} {
+		_, err := os.Stat(filepath.Join(dir, filepath.FromSlash(name)))
+		assert.True(t, os.IsNotExist(err), name)
+	}
+	gz, _ := ioutil.ReadFile(filepath.Join(dir, "a.txt.gz"))
+	assert.Equal(t, gzipStrLevel(testBody, gzip.BestCompression), gz)
+
+	// The siblings are served by FileServer.
+	h, err := FileServer(os.DirFS(dir))
+	assert.Nil(t, err)
+	r := httptest.NewRequest(http.MethodGet, "/sub/b.css", nil)
+	r.Header.Set(acceptEncoding, "gzip, br")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, "br", w.Header().Get(contentEncoding))
+	assert.Equal(t, "text/css; charset=utf-8", w.Header().Get(contentType))
+}
+
+func TestPrecompressDirDictionary(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.txt")
+	assert.Nil(t, ioutil.WriteFile(path, []byte(testBody), 0644))
+
+	dc, err := zstd.NewDictionary()
+	assert.Nil(t, err)
+	res, err := PrecompressDir(dir,
+		DictionaryCompressor(dictionary.Zstd, 1000, dc),
+		PrecompressedExtension(dictionary.Zstd, ".dcz"),
+	)
+	assert.Nil(t, err)
+	for _, f := range res {
+		assert.NotEqual(t, dictionary.Zstd, f.Encoding)
+	}
+	_, err = os.Stat(path + ".dcz")
+	assert.True(t, os.IsNotExist(err))
+}
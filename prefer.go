@@ -1,18 +1,16 @@
 package httpcompression
 
-import (
-	"fmt"
-	"sort"
-)
+import "fmt"
 
 // Prefer controls the behavior of the middleware in case both Gzip and Brotli
 // can be used to compress a response (i.e. in case the client supports both
 // encodings, and the MIME type of the response is allowed for both encodings).
 // See the comments on the PreferType constants for the supported values.
+// See Negotiation for implementing custom policies.
 func Prefer(prefer PreferType) Option {
 	return func(c *config) error {
 		switch prefer {
-		case PreferServer, PreferClient:
+		case PreferServer, PreferClient, PreferSmallest, PreferFastest:
 			c.prefer = prefer
 			return nil
 		default:
@@ -36,39 +34,18 @@ const (
 	// If two or more compressors have the same priority according to the client, the server priority is taken into consideration.
 	// If both server and client do no specify a preference between two or more compressors, the order is determined by the name of the encoding.
 	PreferClient
-)
 
-func preferredEncoding(accept codings, comps comps, common []string, prefer PreferType) string {
-	if len(common) == 0 {
-		panic("no common encoding")
-	}
-	switch prefer {
-	case PreferServer:
-		sort.Slice(common, func(i, j int) bool {
-			ci, cj := comps[common[i]].priority, comps[common[j]].priority
-			if ci != cj {
-				return ci > cj // desc
-			}
-			ai, aj := accept[common[i]], accept[common[j]]
-			if ai != aj {
-				return ai > aj // desc
-			}
-			return common[i] < common[j] // asc
-		})
-	case PreferClient:
-		sort.Slice(common, func(i, j int) bool {
-			ai, aj := accept[common[i]], accept[common[j]]
-			if ai != aj {
-				return ai > aj // desc
-			}
-			ci, cj := comps[common[i]].priority, comps[common[j]].priority
-			if ci != cj {
-				return ci > cj // desc
-			}
-			return common[i] < common[j] // asc
-		})
-	default:
-		panic("unknown prefer type")
-	}
-	return common[0]
-}
+	// PreferSmallest prefers the compressor that, according to the statistics
+	// observed so far for the Content-Type of the response, yields the smallest
+	// compressed responses.
+	// Until enough responses of a Content-Type have been compressed with each compressor,
+	// and periodically afterwards, the compressors are tried in turn, so that the
+	// statistics adapt as the traffic changes.
+	// FileServer serves the smallest of the precompressed siblings.
+	PreferSmallest
+
+	// PreferFastest is like PreferSmallest, but it prefers the compressor that
+	// spends the least CPU time per uncompressed byte.
+	// FileServer serves the precompressed siblings as with PreferServer.
+	PreferFastest
+)
@@ -0,0 +1,181 @@
+package httpcompression
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// statsDecay is the weight of each new sample in the decayed averages
+	// used by PreferSmallest and PreferFastest.
+	statsDecay = 1.0 / 32
+
+	// statsMinSamples is the number of samples that each encoding must have,
+	// for a content type, before the statistics are used to choose among them.
+	statsMinSamples = 8
+
+	// statsExploreInterval is the interval, in responses of each content type,
+	// at which the encoding sampled least recently is used, so that the
+	// statistics of all the encodings are kept up to date.
+	statsExploreInterval = 64
+
+	// maxStatsContentTypes is the maximum number of content types whose
+	// statistics are tracked separately: the others share the same statistics.
+	maxStatsContentTypes = 256
+)
+
+// encodingStats keeps, for each content type, the decayed statistics of the
+// responses compressed with each encoding of an encodingTable. It is used by
+// PreferSmallest and PreferFastest. Like negotiationCache, the content types are
+// looked up without locking, and the statistics are updated atomically, so that
+// concurrent responses do not contend on a lock: concurrent samples of the same
+// encoding may occasionally be lost, which is harmless for the averages.
+type encodingStats struct {
+	prefer PreferType
+	n      int // Number of encodings in the encodingTable.
+
+	types atomic.Value // map[string]*contentTypeStats
+	mu    sync.Mutex   // Held while adding a content type.
+}
+
+type contentTypeStats struct {
+	responses uint64           // Number of responses for which an encoding was chosen.
+	encodings []encodingSample // Indexed like encodingTable.encodings.
+}
+
+// encodingSample is accessed atomically: the averages are stored as the bits of
+// a float64 (see math.Float64bits).
+type encodingSample struct {
+	samples uint64 // Number of samples.
+	last    uint64 // Value of responses when the last sample was recorded.
+	ratio   uint64 // Decayed average of the compressed to uncompressed size ratio.
+	cpu     uint64 // Decayed average of the nanoseconds spent in the compressor per uncompressed byte.
+}
+
+func newEncodingStats(t *encodingTable) *encodingStats {
+	s := &encodingStats{
+		prefer: t.prefer,
+		n:      len(t.encodings),
+	}
+	s.types.Store(map[string]*contentTypeStats{})
+	return s
+}
+
+// choose returns the index of the preferred accepted encoding for a response
+// with Content-Type ct. n.best must not be negative.
+func (s *encodingStats) choose(ct string, n negotiation) int {
+	ts := s.get(ct)
+	explore := atomic.AddUint64(&ts.responses, 1)%statsExploreInterval == 0
+	best := -1
+	for i := 0; i < s.n; i++ {
+		if n.accepted&(1<<uint(i)) == 0 {
+			continue
+		}
+		if best < 0 || ts.better(i, best, explore, s.prefer) {
+			best = i
+		}
+	}
+	return best
+}
+
+// better returns true if the encoding at index i is preferable to the one at
+// index j. Encodings with too few samples, and when exploring the encodings
+// sampled least recently, are preferred; ties are broken by the table order.
+func (ts *contentTypeStats) better(i, j int, explore bool, prefer PreferType) bool {
+	ei, ej := &ts.encodings[i], &ts.encodings[j]
+	si, sj := atomic.LoadUint64(&ei.samples), atomic.LoadUint64(&ej.samples)
+	switch {
+	case si < statsMinSamples || sj < statsMinSamples:
+		return si < sj
+	case explore:
+		return atomic.LoadUint64(&ei.last) < atomic.LoadUint64(&ej.last)
+	case prefer == PreferSmallest:
+		return loadFloat(&ei.ratio) < loadFloat(&ej.ratio)
+	default:
+		return loadFloat(&ei.cpu) < loadFloat(&ej.cpu)
+	}
+}
+
+// record adds a sample for a response with Content-Type ct compressed with the
+// encoding at index i.
+func (s *encodingStats) record(ct string, i int, uncompressed, compressed int64, d time.Duration) {
+	if uncompressed <= 0 {
+		return
+	}
+	ratio := float64(compressed) / float64(uncompressed)
+	cpu := float64(d) / float64(uncompressed)
+
+	ts := s.get(ct)
+	e := &ts.encodings[i]
+	if atomic.AddUint64(&e.samples, 1) == 1 {
+		atomic.StoreUint64(&e.ratio, math.Float64bits(ratio))
+		atomic.StoreUint64(&e.cpu, math.Float64bits(cpu))
+	} else {
+		decayFloat(&e.ratio, ratio)
+		decayFloat(&e.cpu, cpu)
+	}
+	atomic.StoreUint64(&e.last, atomic.LoadUint64(&ts.responses))
+}
+
+func loadFloat(p *uint64) float64 {
+	return math.Float64frombits(atomic.LoadUint64(p))
+}
+
+// decayFloat adds the sample v to the decayed average stored in p.
+func decayFloat(p *uint64, v float64) {
+	for {
+		old := atomic.LoadUint64(p)
+		avg := math.Float64frombits(old)
+		avg += (v - avg) * statsDecay
+		if atomic.CompareAndSwapUint64(p, old, math.Float64bits(avg)) {
+			return
+		}
+	}
+}
+
+// get returns the statistics for the Content-Type ct, adding them if needed.
+func (s *encodingStats) get(ct string) *contentTypeStats {
+	key := statsKey(ct)
+	m := s.types.Load().(map[string]*contentTypeStats)
+	if ts := m[key]; ts != nil {
+		return ts
+	}
+	if len(m) >= maxStatsContentTypes {
+		if ts := m[""]; ts != nil {
+			return ts
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m = s.types.Load().(map[string]*contentTypeStats)
+	if ts := m[key]; ts != nil {
+		return ts
+	}
+	if len(m) >= maxStatsContentTypes {
+		key = ""
+		if ts := m[key]; ts != nil {
+			return ts
+		}
+	}
+	ts := &contentTypeStats{encodings: make([]encodingSample, s.n)}
+	nm := make(map[string]*contentTypeStats, len(m)+1)
+	for k, v := range m {
+		nm[k] = v
+	}
+	// Copy the key, so that the response it comes from is not retained.
+	nm[string(append([]byte(nil), key...))] = ts
+	s.types.Store(nm)
+	return ts
+}
+
+// statsKey returns the media type of the Content-Type ct, without parameters.
+func statsKey(ct string) string {
+	if i := strings.IndexByte(ct, ';'); i >= 0 {
+		ct = ct[:i]
+	}
+	return strings.ToLower(strings.TrimSpace(ct))
+}
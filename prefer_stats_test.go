@@ -0,0 +1,223 @@
+package httpcompression
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// load returns the statistics for the content type key, if any.
+func (s *encodingStats) load(key string) *contentTypeStats {
+	return s.types.Load().(map[string]*contentTypeStats)[key]
+}
+
+func TestEncodingStats(t *testing.T) {
+	t.Parallel()
+
+	table, err := newEncodingTable(comps{"br": {priority: 2}, "gzip": {priority: 1}}, PreferSmallest)
+	assert.NoError(t, err)
+	s := newEncodingStats(table)
+	all := table.negotiate([]string{"br, gzip"})
+
+	// Until each encoding has enough samples, the one with fewer samples is chosen.
+	for i := 0; i < 2*statsMinSamples; i++ {
+		enc := s.choose("text/html; charset=utf-8", all)
+		if enc == 0 {
+			s.record("text/html", enc, 1000, 500, time.Millisecond)
+		} else {
+			s.record("TEXT/HTML", enc, 1000, 300, 2*time.Millisecond)
+		}
+	}
+	assert.Equal(t, statsMinSamples, int(s.load("text/html").encodings[0].samples))
+	assert.Equal(t, statsMinSamples, int(s.load("text/html").encodings[1].samples))
+
+	// gzip is smaller, unless only br is accepted.
+	assert.Equal(t, 1, s.choose("text/html", all))
+	assert.Equal(t, 0, s.choose("text/html", table.negotiate([]string{"br"})))
+
+	// Other content types have separate statistics.
+	assert.Equal(t, 0, s.choose("application/json", all))
+
+	// Periodically, the encoding sampled least recently is chosen.
+	explored := 0
+	for i := 0; i < statsExploreInterval; i++ {
+		if s.choose("text/html", all) == 0 {
+			explored++
+		}
+	}
+	assert.Equal(t, 1, explored)
+
+	// With PreferFastest, br is faster.
+	s.prefer = PreferFastest
+	assert.Equal(t, 0, s.choose("text/html", all))
+}
+
+func TestEncodingStatsDecay(t *testing.T) {
+	t.Parallel()
+
+	table, err := newEncodingTable(comps{"gzip": {}}, PreferSmallest)
+	assert.NoError(t, err)
+	s := newEncodingStats(table)
+	s.record("text/plain", 0, 100, 10, 0)
+	for i := 0; i < 200; i++ {
+		s.record("text/plain", 0, 100, 90, 0)
+	}
+	assert.InDelta(t, 0.9, loadFloat(&s.load("text/plain").encodings[0].ratio), 0.01)
+}
+
+func TestEncodingStatsContentTypes(t *testing.T) {
+	t.Parallel()
+
+	table, err := newEncodingTable(comps{"gzip": {}}, PreferSmallest)
+	assert.NoError(t, err)
+	s := newEncodingStats(table)
+	for i := 0; i < 2*maxStatsContentTypes; i++ {
+		s.record("text/x-"+string(rune('a'+i%26))+string(rune('a'+i/26)), 0, 100, 10, 0)
+	}
+	assert.Equal(t, maxStatsContentTypes+1, len(s.types.Load().(map[string]*contentTypeStats)))
+}
+
+// expandingCompressor "compresses" by writing each byte twice.
+type expandingCompressor struct{}
+
+func (expandingCompressor) Get(w io.Writer) io.WriteCloser {
+	return expandingWriter{w}
+}
+
+type expandingWriter struct {
+	w io.Writer
+}
+
+func (w expandingWriter) Write(b []byte) (int, error) {
+	if _, err := w.w.Write(bytes.Repeat(b, 2)); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (w expandingWriter) Close() error {
+	return nil
+}
+
+// fakeClock is a clock that advances only when requested.
+type fakeClock struct {
+	ns int64
+}
+
+func (c *fakeClock) now() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&c.ns))
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	atomic.AddInt64(&c.ns, int64(d))
+}
+
+// withClock replaces the clock used to measure the time spent in the compressors.
+func withClock(c *fakeClock) Option {
+	return func(cfg *config) error {
+		cfg.now = c.now
+		return nil
+	}
+}
+
+// slowCompressor is like expandingCompressor, but each write advances the
+// clock by one millisecond.
+type slowCompressor struct {
+	clock *fakeClock
+}
+
+func (c slowCompressor) Get(w io.Writer) io.WriteCloser {
+	return slowWriter{expandingWriter{w}, c.clock}
+}
+
+type slowWriter struct {
+	expandingWriter
+	clock *fakeClock
+}
+
+func (w slowWriter) Write(b []byte) (int, error) {
+	w.clock.advance(time.Millisecond)
+	return w.expandingWriter.Write(b)
+}
+
+func TestPreferStats(t *testing.T) {
+	t.Parallel()
+
+	clock := &fakeClock{}
+	cases := []struct {
+		prefer PreferType
+		comp   CompressorProvider
+	}{
+		{PreferSmallest, expandingCompressor{}},
+		{PreferFastest, slowCompressor{clock}},
+	}
+	for _, c := range cases {
+		// The "test" encoding has the highest priority, so it would be used
+		// with PreferServer, but it is larger (or slower) than gzip.
+		h := newTestHandlerWithType("text/plain",
+			Prefer(c.prefer),
+			Compressor("test", 1000, c.comp),
+			withClock(clock),
+		)
+		encs := map[string]int{}
+		for i := 0; i < statsExploreInterval; i++ {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set(acceptEncoding, "gzip, test")
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			encs[w.Header().Get(contentEncoding)]++
+		}
+		// Each encoding is tried statsMinSamples times, then gzip is used,
+		// except when test is explored again.
+		assert.Equal(t, map[string]int{"gzip": statsExploreInterval - statsMinSamples - 1, "test": statsMinSamples + 1}, encs, "%v", c.prefer)
+	}
+
+	_, err := DefaultAdapter(Prefer(PreferType(42)))
+	assert.Error(t, err)
+}
+
+func TestPreferSmallestFileServer(t *testing.T) {
+	t.Parallel()
+
+	fsys := fstest.MapFS{
+		"a.txt":     {Data: []byte(testBody)},
+		"a.txt.br":  {Data: []byte(testBody)},
+		"a.txt.gz":  {Data: gzipStrLevel(testBody, 9)},
+		"a.txt.zst": {Data: zstdStrLevel(testBody, 1)},
+	}
+	for prefer, exp := range map[PreferType]string{PreferServer: "br", PreferSmallest: "gzip", PreferFastest: "br"} {
+		h, err := FileServer(fsys, Prefer(prefer))
+		assert.NoError(t, err)
+		r := httptest.NewRequest(http.MethodGet, "/a.txt", nil)
+		r.Header.Set(acceptEncoding, "gzip, br")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		assert.Equal(t, exp, w.Header().Get(contentEncoding), "%v", prefer)
+	}
+}
+
+// BenchmarkEncodingStats measures the contention on the statistics of a single
+// content type: run it with e.g. -cpu 1,8,64.
+func BenchmarkEncodingStats(b *testing.B) {
+	table, err := newEncodingTable(comps{"br": {priority: 2}, "gzip": {priority: 1}}, PreferSmallest)
+	if err != nil {
+		b.Fatal(err)
+	}
+	s := newEncodingStats(table)
+	all := table.negotiate([]string{"br, gzip"})
+
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			enc := s.choose("text/html; charset=utf-8", all)
+			s.record("text/html; charset=utf-8", enc, 1000, 300, time.Millisecond)
+		}
+	})
+}
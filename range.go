@@ -0,0 +1,115 @@
+package httpcompression
+
+import (
+	"bytes"
+	"net/http"
+)
+
+const (
+	ifRange      = "If-Range"
+	lastModified = "Last-Modified"
+)
+
+// RangeRequests is an option that controls whether the middleware answers range
+// requests (i.e. GET requests with a Range header). By default, the Range header is
+// removed from the requests, and the full response is always sent.
+//
+// When enabled, the handler is invoked without the Range header, and the whole
+// response is buffered (compressed, if compression applies): if the handler responds
+// with 200 OK, the requested ranges are served from the buffered representation,
+// so that ranges refer to the compressed bytes, as required by RFC 9110, with the
+// appropriate 206 Partial Content (or 416 Range Not Satisfiable) semantics, including
+// multipart/byteranges responses for multiple ranges. If-Range is evaluated against
+// the ETag and Last-Modified headers set by the handler.
+//
+// Since a client may request different ranges in different requests, the compressed
+// representation must be the same for each request: this option must be used only
+// with deterministic compressors (the compressors included in this package are
+// deterministic as long as their configuration does not change), and with handlers
+// that return the same body for the same resource. Using a ResponseCache guarantees
+// that the same compressed bytes are reused for responses with the same body or ETag.
+//
+// Buffering the whole response means that the Flush method of the ResponseWriter
+// passed to the handler has no effect on range requests.
+func RangeRequests(enabled bool) Option {
+	return func(c *config) error {
+		c.ranges = enabled
+		return nil
+	}
+}
+
+// isRangeRequest returns true if r has to be handled by a rangeWriter.
+func isRangeRequest(r *http.Request) bool {
+	return r.Method == http.MethodGet && r.Header.Get(_range) != ""
+}
+
+// rangeWriter buffers the whole response written by the handler (through the
+// compressWriter) so that the ranges requested by the client can be served from it.
+type rangeWriter struct {
+	http.ResponseWriter
+	request *http.Request // Original request, including the Range header.
+
+	code int
+	buf  bytes.Buffer
+}
+
+// newRangeWriter returns the rangeWriter for r, and the request to be passed
+// to the handler, i.e. a copy of r without the range headers.
+func newRangeWriter(w http.ResponseWriter, r *http.Request) (*rangeWriter, *http.Request) {
+	rw := &rangeWriter{
+		ResponseWriter: w,
+		request:        r,
+	}
+	r = r.Clone(r.Context())
+	r.Header.Del(_range)
+	r.Header.Del(ifRange)
+	return rw, r
+}
+
+func (w *rangeWriter) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+}
+
+func (w *rangeWriter) Write(b []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	return w.buf.Write(b)
+}
+
+// serve sends the buffered response to the parent ResponseWriter. Only the
+// requested ranges of successful responses are sent.
+func (w *rangeWriter) serve() error {
+	if w.code != 0 && w.code != http.StatusOK {
+		w.ResponseWriter.WriteHeader(w.code)
+		_, err := w.ResponseWriter.Write(w.buf.Bytes())
+		return err
+	}
+
+	h := w.Header()
+	if _, ok := h[contentType]; !ok && h.Get(contentEncoding) != "" {
+		// Do not let ServeContent sniff the content type from the compressed bytes.
+		h[contentType] = nil
+	}
+	// ServeContent sets the Content-Length of the (partial) response.
+	h.Del(contentLength)
+	modtime, _ := http.ParseTime(h.Get(lastModified))
+	http.ServeContent(rangeErrorWriter{w.ResponseWriter}, w.request, "", modtime, bytes.NewReader(w.buf.Bytes()))
+	return nil
+}
+
+// rangeErrorWriter removes the Content-Encoding header from the error responses
+// (e.g. 416 Range Not Satisfiable) sent by http.ServeContent, as their body is not
+// encoded. Depending on the GODEBUG settings, ServeContent may not remove it itself.
+type rangeErrorWriter struct {
+	http.ResponseWriter
+}
+
+func (w rangeErrorWriter) WriteHeader(code int) {
+	if code >= http.StatusBadRequest {
+		w.Header().Del(contentEncoding)
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
@@ -0,0 +1,166 @@
+package httpcompression
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func rangeTestHandler(opts ...Option) http.Handler {
+	opts = append([]Option{RangeRequests(true)}, opts...)
+	return newTestHandler(testBody, opts...)
+}
+
+func rangeGet(h http.Handler, ae, rng string) *http.Response {
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set(acceptEncoding, ae)
+	if rng != "" {
+		req.Header.Set(_range, rng)
+	}
+	resp := httptest.NewRecorder()
+	h.ServeHTTP(resp, req)
+	return resp.Result()
+}
+
+func TestRangeRequestsSingle(t *testing.T) {
+	t.Parallel()
+
+	h := rangeTestHandler()
+	full := rangeGet(h, "gzip", "")
+	assert.Equal(t, 200, full.StatusCode)
+	assert.Equal(t, "gzip", full.Header.Get(contentEncoding))
+	compressed, _ := io.ReadAll(full.Body)
+	assert.True(t, len(compressed) > 20)
+
+	res := rangeGet(h, "gzip", "bytes=10-19")
+	assert.Equal(t, http.StatusPartialContent, res.StatusCode)
+	assert.Equal(t, "gzip", res.Header.Get(contentEncoding))
+	assert.Equal(t, "bytes", res.Header.Get(acceptRanges))
+	assert.Equal(t, "bytes 10-19/"+strconv.Itoa(len(compressed)), res.Header.Get("Content-Range"))
+	assert.Equal(t, "10", res.Header.Get(contentLength))
+	body, _ := io.ReadAll(res.Body)
+	assert.Equal(t, compressed[10:20], body)
+
+	// Ranges can be used to reassemble the whole compressed response.
+	res = rangeGet(h, "gzip", "bytes=0-9")
+	head, _ := io.ReadAll(res.Body)
+	res = rangeGet(h, "gzip", "bytes=20-")
+	tail, _ := io.ReadAll(res.Body)
+	dec, err := decodeGzip(bytes.NewReader(append(append(head, body...), tail...)))
+	assert.NoError(t, err)
+	assert.Equal(t, testBody, string(dec))
+}
+
+func TestRangeRequestsMultiple(t *testing.T) {
+	t.Parallel()
+
+	h := rangeTestHandler()
+	full := rangeGet(h, "br", "")
+	compressed, _ := io.ReadAll(full.Body)
+
+	res := rangeGet(h, "br", "bytes=0-4,10-14")
+	assert.Equal(t, http.StatusPartialContent, res.StatusCode)
+	assert.Equal(t, "br", res.Header.Get(contentEncoding))
+	mt, params, err := mime.ParseMediaType(res.Header.Get(contentType))
+	assert.NoError(t, err)
+	assert.Equal(t, "multipart/byteranges", mt)
+
+	mr := multipart.NewReader(res.Body, params["boundary"])
+	var parts [][]byte
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+		b, _ := io.ReadAll(p)
+		parts = append(parts, b)
+	}
+	assert.Equal(t, [][]byte{compressed[0:5], compressed[10:15]}, parts)
+}
+
+func TestRangeRequestsNotSatisfiable(t *testing.T) {
+	t.Parallel()
+
+	h := rangeTestHandler()
+	res := rangeGet(h, "gzip", "bytes=100000-")
+	assert.Equal(t, http.StatusRequestedRangeNotSatisfiable, res.StatusCode)
+	assert.Equal(t, "", res.Header.Get(contentEncoding))
+}
+
+func TestRangeRequestsUncompressed(t *testing.T) {
+	t.Parallel()
+
+	// The response is not compressed because it is too small.
+	h := newTestHandler(smallTestBody, RangeRequests(true))
+	res := rangeGet(h, "gzip", "bytes=3-5")
+	assert.Equal(t, http.StatusPartialContent, res.StatusCode)
+	assert.Equal(t, "", res.Header.Get(contentEncoding))
+	body, _ := io.ReadAll(res.Body)
+	assert.Equal(t, smallTestBody[3:6], string(body))
+}
+
+func TestRangeRequestsIfRange(t *testing.T) {
+	t.Parallel()
+
+	mw, err := DefaultAdapter(RangeRequests(true))
+	assert.NoError(t, err)
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "", r.Header.Get(_range))
+		assert.Equal(t, "", r.Header.Get(ifRange))
+		w.Header().Set(etag, `"v1"`)
+		w.Write([]byte(testBody))
+	}))
+
+	for ir, code := range map[string]int{`"v1"`: http.StatusPartialContent, `"v0"`: http.StatusOK} {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Set(acceptEncoding, "gzip")
+		req.Header.Set(_range, "bytes=0-9")
+		req.Header.Set(ifRange, ir)
+		resp := httptest.NewRecorder()
+		h.ServeHTTP(resp, req)
+		assert.Equal(t, code, resp.Code, ir)
+		assert.Equal(t, "gzip", resp.Header().Get(contentEncoding), ir)
+	}
+}
+
+func TestRangeRequestsNotOK(t *testing.T) {
+	t.Parallel()
+
+	mw, err := DefaultAdapter(RangeRequests(true))
+	assert.NoError(t, err)
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(testBody))
+	}))
+	res := rangeGet(h, "gzip", "bytes=0-9")
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+	assert.Equal(t, "gzip", res.Header.Get(contentEncoding))
+	body, _ := io.ReadAll(res.Body)
+	dec, err := decodeGzip(bytes.NewReader(body))
+	assert.NoError(t, err)
+	assert.Equal(t, testBody, string(dec))
+}
+
+func TestRangeRequestsCache(t *testing.T) {
+	t.Parallel()
+
+	cache, err := NewCache(1<<20, 1<<20)
+	assert.NoError(t, err)
+	h := rangeTestHandler(ResponseCache(cache))
+	full := rangeGet(h, "zstd", "")
+	compressed, _ := io.ReadAll(full.Body)
+
+	res := rangeGet(h, "zstd", "bytes=5-")
+	assert.Equal(t, http.StatusPartialContent, res.StatusCode)
+	body, _ := io.ReadAll(res.Body)
+	assert.Equal(t, compressed[5:], body)
+	assert.Equal(t, uint64(1), cache.Stats().Hits)
+}
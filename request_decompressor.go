@@ -0,0 +1,343 @@
+package httpcompression
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/CAFxX/httpcompression/contrib/andybalholm/brotli"
+	cgzip "github.com/CAFxX/httpcompression/contrib/compress/gzip"
+	czlib "github.com/CAFxX/httpcompression/contrib/compress/zlib"
+	"github.com/CAFxX/httpcompression/contrib/klauspost/zstd"
+	"github.com/CAFxX/httpcompression/limit"
+)
+
+const identity = "identity"
+
+// defaultDecompressors returns the default DecompressorProviders for the standard
+// content-encodings supported by the compressors bundled in contrib.
+func defaultDecompressors() (map[string]DecompressorProvider, error) {
+	gz, err := cgzip.NewDecompressor()
+	if err != nil {
+		return nil, err
+	}
+	zl, err := czlib.NewDecompressor(czlib.DecompressorOptions{})
+	if err != nil {
+		return nil, err
+	}
+	br, err := brotli.NewDecompressor()
+	if err != nil {
+		return nil, err
+	}
+	zs, err := zstd.NewDecompressor()
+	if err != nil {
+		return nil, fmt.Errorf("initializing zstd decompressor: %w", err)
+	}
+	return map[string]DecompressorProvider{
+		cgzip.Encoding:  gz,
+		czlib.Encoding:  zl,
+		brotli.Encoding: br,
+		zstd.Encoding:   zs,
+	}, nil
+}
+
+// decompressors returns the DecompressorProviders to be used for each of the
+// Content-Encodings enabled in the configuration.
+func (c *config) decompressors() (map[string]DecompressorProvider, error) {
+	defaults, err := defaultDecompressors()
+	if err != nil {
+		return nil, err
+	}
+	decs := map[string]DecompressorProvider{}
+	for enc := range c.compressor {
+		if d, ok := defaults[enc]; ok {
+			decs[enc] = d
+		}
+	}
+	for enc, d := range c.decompressor {
+		if d == nil {
+			delete(decs, enc)
+			continue
+		}
+		decs[enc] = d
+	}
+	return decs, nil
+}
+
+// RequestDecompressor returns a HTTP handler wrapping function (a.k.a. middleware)
+// which can be used to wrap an HTTP handler to transparently decompress the request
+// body if the client sent it compressed (via the Content-Encoding header).
+// It accepts the same options as Adapter, so that the same configuration can be
+// used for both directions: request bodies are accepted in any of the
+// Content-Encodings for which a compressor has been registered and a default
+// decompressor is available, and in any of the Content-Encodings for which a
+// decompressor has been registered (see Decompressor).
+// Requests whose body uses any other Content-Encoding are rejected with
+// 415 Unsupported Media Type. Errors encountered while decoding the body are
+// returned to the handler when reading the request body.
+// To protect against decompression bombs, see MaxDecompressedSize,
+// MaxDecompressionRatio and MaxDecompressionWindow.
+// An error will be returned if invalid options are given.
+func RequestDecompressor(opts ...Option) (func(http.Handler) http.Handler, error) {
+	c := config{
+		prefer:     PreferServer,
+		compressor: comps{},
+	}
+	for _, o := range opts {
+		err := o(&c)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	decs, err := c.decompressors()
+	if err != nil {
+		return nil, err
+	}
+	accepted := make([]string, 0, len(decs))
+	for enc := range decs {
+		accepted = append(accepted, enc)
+	}
+	sort.Strings(accepted)
+	acceptedHeader := strings.Join(accepted, ", ")
+
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			encs := parseContentEncoding(r.Header.Values(contentEncoding))
+			if len(encs) == 0 {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			for _, enc := range encs {
+				if _, ok := decs[enc]; !ok {
+					// RFC 7694: the server should include the content-codings
+					// it supports in the Accept-Encoding header of the 415 response.
+					w.Header().Set(acceptEncoding, acceptedHeader)
+					http.Error(w, "unsupported content-encoding", http.StatusUnsupportedMediaType)
+					return
+				}
+			}
+
+			body := &decodedBody{body: r.Body}
+			defer body.Close()
+
+			counter := limit.NewCounter(r.Body)
+			var rd io.Reader = counter
+			// Content-Encodings are listed in the order in which they were
+			// applied, so they have to be removed in reverse order.
+			for i := len(encs) - 1; i >= 0; i-- {
+				if wl, ok := c.windowLimits[encs[i]]; ok {
+					br := bufio.NewReader(rd)
+					switch err := limit.CheckWindow(br, wl.window, wl.max); {
+					case limit.IsExceeded(err):
+						http.Error(w, "request body window too large", http.StatusRequestEntityTooLarge)
+						return
+					case err != nil:
+						http.Error(w, "malformed request body", http.StatusBadRequest)
+						return
+					}
+					rd = br
+				}
+				d := decs[encs[i]].Get(rd)
+				body.decoders = append(body.decoders, d)
+				rd = d
+			}
+			if c.decompressLimits.Enabled() {
+				rd = limit.NewReader(rd, counter, c.decompressLimits)
+				lw := &limitResponseWriter{ResponseWriter: w, body: body}
+				defer lw.finish()
+				w = lw
+			}
+			body.Reader = rd
+
+			r = r.Clone(r.Context())
+			r.Header.Del(contentEncoding)
+			r.Header.Del(contentLength)
+			r.ContentLength = -1
+			r.Body = body
+
+			h.ServeHTTP(w, r)
+		})
+	}, nil
+}
+
+// DefaultRequestDecompressor is like RequestDecompressor, but it includes the
+// same defaults used by DefaultAdapter, so that request bodies are accepted in
+// all the Content-Encodings that DefaultAdapter uses for responses.
+// The provided opts override the defaults.
+func DefaultRequestDecompressor(opts ...Option) (func(http.Handler) http.Handler, error) {
+	defaults := []Option{
+		DeflateCompressionLevel(czlib.DefaultCompression),
+		GzipCompressionLevel(gzip.DefaultCompression),
+		BrotliCompressionLevel(brotli.DefaultCompression),
+		defaultZstandardCompressor(),
+	}
+	opts = append(defaults, opts...)
+	return RequestDecompressor(opts...)
+}
+
+// parseContentEncoding returns the list of content-codings, in the order in
+// which they have been applied, listed in the Content-Encoding header values.
+// The identity coding is omitted, and aliases (e.g. "x-gzip") are mapped to the
+// corresponding content-coding.
+func parseContentEncoding(vv []string) []string {
+	var encs []string
+	for _, v := range vv {
+		for _, sv := range strings.Split(v, ",") {
+			enc := strings.ToLower(strings.TrimSpace(sv))
+			if enc == "" || enc == identity {
+				continue
+			}
+			encs = append(encs, resolveAlias(enc))
+		}
+	}
+	return encs
+}
+
+// decodedBody is the request body returned to the wrapped handler.
+// Closing it closes all decoders and the original body.
+type decodedBody struct {
+	io.Reader
+	body     io.ReadCloser
+	decoders []io.ReadCloser
+	closed   bool
+	exceeded bool // set if a decompression limit has been exceeded
+}
+
+func (b *decodedBody) Read(p []byte) (int, error) {
+	n, err := b.Reader.Read(p)
+	if err != nil && limit.IsExceeded(err) {
+		b.exceeded = true
+	}
+	return n, err
+}
+
+func (b *decodedBody) Close() error {
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+	var err error
+	for i := len(b.decoders) - 1; i >= 0; i-- {
+		if cerr := b.decoders[i].Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	if cerr := b.body.Close(); cerr != nil && err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// limitResponseWriter forces a 413 Request Entity Too Large response in case
+// the handler exceeded one of the decompression limits while reading the
+// request body, as long as the response headers have not been sent yet.
+type limitResponseWriter struct {
+	http.ResponseWriter
+	body        *decodedBody
+	wroteHeader bool
+}
+
+func (w *limitResponseWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	if w.body.exceeded {
+		code = http.StatusRequestEntityTooLarge
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *limitResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *limitResponseWriter) Flush() {
+	if fw, ok := w.ResponseWriter.(http.Flusher); ok {
+		fw.Flush()
+	}
+}
+
+// Unwrap allows http.ResponseController to access the parent ResponseWriter.
+func (w *limitResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// finish sends the 413 response if the handler exceeded one of the limits
+// and did not send a response.
+func (w *limitResponseWriter) finish() {
+	if !w.wroteHeader && w.body.exceeded {
+		http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+	}
+}
+
+type windowLimit struct {
+	window limit.WindowFunc
+	max    int64
+}
+
+// MaxDecompressedSize is an option that controls the maximum size of a
+// decompressed request body. Handlers reading past the limit get an error
+// (see limit.IsExceeded) and the response status is forced to 413 Request
+// Entity Too Large.
+// It is used only by RequestDecompressor. Zero, the default, means no limit.
+func MaxDecompressedSize(size int64) Option {
+	return func(c *config) error {
+		if size < 0 {
+			return fmt.Errorf("maximum decompressed size can not be negative: %d", size)
+		}
+		c.decompressLimits.MaxSize = size
+		return nil
+	}
+}
+
+// MaxDecompressionRatio is an option that controls the maximum ratio between
+// the size of the decompressed and compressed request body.
+// The ratio is enforced only once more than limit.RatioMinSize bytes have been
+// decompressed. Handlers reading past the limit get an error (see
+// limit.IsExceeded) and the response status is forced to 413 Request Entity
+// Too Large.
+// It is used only by RequestDecompressor. Zero, the default, means no limit.
+func MaxDecompressionRatio(ratio float64) Option {
+	return func(c *config) error {
+		if ratio < 0 || math.IsNaN(ratio) {
+			return fmt.Errorf("invalid maximum decompression ratio: %v", ratio)
+		}
+		c.decompressLimits.MaxRatio = ratio
+		return nil
+	}
+}
+
+// MaxDecompressionWindow is an option that limits the window size (the memory
+// that the decoder needs for its history buffer) that request bodies using the
+// specified Content-Encoding can declare. window extracts the window size from
+// the encoded stream (see limit.ZstdWindow, limit.BrotliWindow and
+// limit.XZDictionary). Requests exceeding the limit are rejected with 413
+// Request Entity Too Large before the handler is invoked.
+// It is used only by RequestDecompressor.
+func MaxDecompressionWindow(contentEncoding string, window limit.WindowFunc, size int64) Option {
+	return func(c *config) error {
+		if window == nil {
+			delete(c.windowLimits, contentEncoding)
+			return nil
+		}
+		if size < 0 {
+			return fmt.Errorf("maximum window size can not be negative: %d", size)
+		}
+		if c.windowLimits == nil {
+			c.windowLimits = map[string]windowLimit{}
+		}
+		c.windowLimits[contentEncoding] = windowLimit{window, size}
+		return nil
+	}
+}
@@ -0,0 +1,154 @@
+package httpcompression
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/CAFxX/httpcompression/limit"
+	ibrotli "github.com/andybalholm/brotli"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestDecompressor(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name     string
+		encoding string
+		body     []byte
+		status   int
+	}{
+		{"identity", "", []byte(testBody), 200},
+		{"explicit identity", "identity", []byte(testBody), 200},
+		{"gzip", "gzip", gzipStrLevel(testBody, gzip.DefaultCompression), 200},
+		{"gzip uppercase", "GZIP", gzipStrLevel(testBody, gzip.DefaultCompression), 200},
+		{"x-gzip", "x-gzip", gzipStrLevel(testBody, gzip.DefaultCompression), 200},
+		{"br", "br", brotliStrLevel(testBody, 5), 200},
+		{"zstd", "zstd", zstdStrLevel(testBody, 1), 200},
+		{"gzip then br", "gzip, br", brotliStr(gzipStrLevel(testBody, gzip.DefaultCompression)), 200},
+		{"unknown", "lzma", []byte(testBody), http.StatusUnsupportedMediaType},
+		{"known and unknown", "gzip, lzma", []byte(testBody), http.StatusUnsupportedMediaType},
+		{"malformed", "gzip", []byte(testBody), http.StatusBadRequest},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			mw, err := DefaultRequestDecompressor()
+			assert.Nil(t, err)
+			handler := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if c.encoding != "" && c.encoding != "identity" {
+					assert.Equal(t, "", r.Header.Get(contentEncoding))
+					assert.Equal(t, "", r.Header.Get(contentLength))
+				}
+				b, err := io.ReadAll(r.Body)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				assert.Equal(t, testBody, string(b))
+			}))
+
+			req, _ := http.NewRequest("POST", "/whatever", bytes.NewReader(c.body))
+			if c.encoding != "" {
+				req.Header.Set(contentEncoding, c.encoding)
+			}
+			res := httptest.NewRecorder()
+			handler.ServeHTTP(res, req)
+
+			assert.Equal(t, c.status, res.Code)
+			if c.status == http.StatusUnsupportedMediaType {
+				assert.Equal(t, "br, deflate, gzip, zstd", res.Header().Get(acceptEncoding))
+			}
+		})
+	}
+}
+
+func TestRequestDecompressorOnlyRegistered(t *testing.T) {
+	t.Parallel()
+
+	mw, err := RequestDecompressor(GzipCompressionLevel(gzip.DefaultCompression))
+	assert.Nil(t, err)
+	handler := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler should not be called")
+	}))
+
+	req, _ := http.NewRequest("POST", "/whatever", strings.NewReader(string(brotliStrLevel(testBody, 5))))
+	req.Header.Set(contentEncoding, "br")
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+
+	assert.Equal(t, http.StatusUnsupportedMediaType, res.Code)
+	assert.Equal(t, "gzip", res.Header().Get(acceptEncoding))
+}
+
+func brotliStr(b []byte) []byte {
+	var buf bytes.Buffer
+	w := ibrotli.NewWriterLevel(&buf, 5)
+	w.Write(b)
+	w.Close()
+	return buf.Bytes()
+}
+
+// zstdSkippableFrame returns a zstd skippable frame with size bytes of content.
+func zstdSkippableFrame(size int) []byte {
+	b := make([]byte, 8+size)
+	binary.LittleEndian.PutUint32(b, 0x184D2A50)
+	binary.LittleEndian.PutUint32(b[4:], uint32(size))
+	return b
+}
+
+func TestRequestDecompressorLimits(t *testing.T) {
+	t.Parallel()
+
+	big := strings.Repeat("a", 1<<20)
+
+	cases := []struct {
+		name   string
+		opts   []Option
+		body   []byte
+		status int
+	}{
+		{"no limits", nil, zstdStrLevel(big, 1), 200},
+		{"size", []Option{MaxDecompressedSize(1 << 10)}, zstdStrLevel(big, 1), http.StatusRequestEntityTooLarge},
+		{"size ok", []Option{MaxDecompressedSize(1 << 20)}, zstdStrLevel(big, 1), 200},
+		{"ratio", []Option{MaxDecompressionRatio(10)}, zstdStrLevel(big, 1), http.StatusRequestEntityTooLarge},
+		{"window", []Option{MaxDecompressionWindow("zstd", limit.ZstdWindow, 1<<10)}, zstdStrLevel(big, 1), http.StatusRequestEntityTooLarge},
+		{"window ok", []Option{MaxDecompressionWindow("zstd", limit.ZstdWindow, 8<<20)}, zstdStrLevel(big, 1), 200},
+		{"window skippable", []Option{MaxDecompressionWindow("zstd", limit.ZstdWindow, 8<<20)}, append(zstdSkippableFrame(8<<10), zstdStrLevel(big, 1)...), 200},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			mw, err := DefaultRequestDecompressor(c.opts...)
+			assert.Nil(t, err)
+			handler := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				b, err := io.ReadAll(r.Body)
+				if err != nil {
+					assert.True(t, limit.IsExceeded(err))
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				assert.Equal(t, big, string(b))
+			}))
+
+			req, _ := http.NewRequest("POST", "/whatever", bytes.NewReader(c.body))
+			req.Header.Set(contentEncoding, "zstd")
+			res := httptest.NewRecorder()
+			handler.ServeHTTP(res, req)
+
+			assert.Equal(t, c.status, res.Code)
+		})
+	}
+}
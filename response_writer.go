@@ -8,6 +8,9 @@ import (
 	"net/http"
 	"strconv"
 	"sync"
+	"time"
+
+	"github.com/CAFxX/httpcompression/dictionary"
 )
 
 // compressWriter provides an http.ResponseWriter interface, which gzips
@@ -16,16 +19,27 @@ import (
 // It can be configured to skip response smaller than minSize.
 type compressWriter struct {
 	http.ResponseWriter
-
-	config config
-	accept codings
-	common []string
-	pool   *sync.Pool // pool of buffers (buf []byte); max size of each buf is maxBuf
-
-	w    io.Writer
-	enc  string
-	code int     // Saves the WriteHeader value.
-	buf  *[]byte // Holds the first part of the write before reaching the minSize or the end of the write.
+	request *http.Request
+
+	config   config
+	neg      negotiation
+	dict     *dictionary.Dictionary // Dictionary available to the client, if any.
+	announce *dictionary.Dictionary // Dictionary advertised with Use-As-Dictionary, if any.
+	pool     *sync.Pool             // pool of buffers (buf []byte); max size of each buf is maxBuf
+
+	w      io.Writer
+	enc    string
+	sample io.WriteCloser // Receives a copy of the uncompressed body, if a Sampler is set.
+	code   int            // Saves the WriteHeader value.
+	buf    *[]byte        // Holds the first part of the write before reaching the minSize or the end of the write.
+
+	written int64 // Number of bytes successfully written by the handler.
+	failed  bool  // Set once an error has been reported to the ErrorHandler.
+
+	// Used only if an Observer is set, or with PreferSmallest and PreferFastest.
+	skip     SkipReason     // Why the response was not compressed.
+	parent   countingWriter // Counts the bytes written to the parent ResponseWriter by the compressor.
+	compTime time.Duration  // Time spent in the compressor, including writes to the parent.
 }
 
 var (
@@ -54,14 +68,30 @@ const maxBuf = 1 << 16 // maximum size of recycled buffer
 
 // Write compresses and appends the given byte slice to the underlying ResponseWriter.
 func (w *compressWriter) Write(b []byte) (int, error) {
+	n, err := w.write(b)
+	w.written += int64(n)
+	if err != nil {
+		w.reportError("write", err)
+	}
+	return n, err
+}
+
+func (w *compressWriter) write(b []byte) (int, error) {
 	if w.w != nil {
 		// The responseWriter is already initialized: use it.
-		return w.w.Write(b)
+		if w.timed() {
+			start := w.config.now()
+			defer w.addCompTime(start)
+		}
+		n, err := w.w.Write(b)
+		w.sampleBody(b[:n])
+		return n, err
 	}
 
 	var (
 		ct = w.Header().Get(contentType)
 		ce = w.Header().Get(contentEncoding)
+		nt = noTransform(w.Header())
 		cl = 0
 	)
 	if clv := w.Header().Get(contentLength); clv != "" {
@@ -72,13 +102,15 @@ func (w *compressWriter) Write(b []byte) (int, error) {
 	// or not this response from the first write, so we don't need to buffer
 	// writes to defer the decision until we have more data.
 	if w.buf == nil && (ct != "" || len(w.config.contentTypes) == 0) && (cl > 0 || len(b) >= w.config.minSize) {
-		if ce == "" && (cl >= w.config.minSize || len(b) >= w.config.minSize) && handleContentType(ct, w.config.contentTypes, w.config.blacklist) {
-			enc := preferredEncoding(w.accept, w.config.compressor, w.common, w.config.prefer)
-			if err := w.startCompress(enc, b); err != nil {
-				return 0, err
+		if ce == "" && !nt && (cl >= w.config.minSize || len(b) >= w.config.minSize) && handleContentType(ct, w.config.contentTypes, w.config.blacklist) {
+			if enc := w.encoding(); enc != "" {
+				if err := w.startCompress(enc, b); err != nil {
+					return 0, err
+				}
+				return len(b), nil
 			}
-			return len(b), nil
 		}
+		w.skip = w.skipReason(ce, ct)
 		if err := w.startPlain(b); err != nil {
 			return 0, err
 		}
@@ -93,7 +125,7 @@ func (w *compressWriter) Write(b []byte) (int, error) {
 	*w.buf = append(*w.buf, b...)
 
 	// Only continue if they didn't already choose an encoding or a known unhandled content length or type.
-	if ce == "" && (cl == 0 || cl >= w.config.minSize) && (ct == "" || handleContentType(ct, w.config.contentTypes, w.config.blacklist)) {
+	if ce == "" && !nt && (cl == 0 || cl >= w.config.minSize) && (ct == "" || handleContentType(ct, w.config.contentTypes, w.config.blacklist)) {
 		// If the current buffer is less than minSize and a Content-Length isn't set, then wait until we have more data.
 		if len(*w.buf) < w.config.minSize && cl == 0 {
 			return len(b), nil
@@ -111,15 +143,17 @@ func (w *compressWriter) Write(b []byte) (int, error) {
 				}
 			}
 			if handleContentType(ct, w.config.contentTypes, w.config.blacklist) {
-				enc := preferredEncoding(w.accept, w.config.compressor, w.common, w.config.prefer)
-				if err := w.startCompress(enc, *w.buf); err != nil {
-					return 0, err
+				if enc := w.encoding(); enc != "" {
+					if err := w.startCompress(enc, *w.buf); err != nil {
+						return 0, err
+					}
+					return len(b), nil
 				}
-				return len(b), nil
 			}
 		}
 	}
 	// If we got here, we should not GZIP this response.
+	w.skip = w.skipReason(ce, ct)
 	if err := w.startPlain(*w.buf); err != nil {
 		return 0, err
 	}
@@ -136,7 +170,19 @@ func (w *compressWriter) WriteString(s string) (int, error) {
 	// is supported. We therefore have to check dynamically.
 	if ws, _ := w.w.(io.StringWriter); ws != nil {
 		// The responseWriter is already initialized and it implements WriteString.
-		return ws.WriteString(s)
+		if w.timed() {
+			start := w.config.now()
+			defer w.addCompTime(start)
+		}
+		n, err := ws.WriteString(s)
+		w.written += int64(n)
+		if err != nil {
+			w.reportError("write", err)
+		}
+		if w.sample != nil {
+			io.WriteString(w.sample, s[:n])
+		}
+		return n, err
 	}
 	// Fallback: the writer has not been initialized yet, or it has been initialized
 	// and it does not implement WriteString. We could in theory do something unsafe
@@ -146,9 +192,29 @@ func (w *compressWriter) WriteString(s string) (int, error) {
 	return w.Write([]byte(s))
 }
 
+// encoding returns the Content-Encoding to be used to compress the response,
+// or the empty string if the Negotiator decided that the response must not be
+// compressed.
+func (w *compressWriter) encoding() string {
+	if w.config.negotiator == nil {
+		if w.config.stats != nil {
+			return w.config.table.encodings[w.config.stats.choose(w.Header().Get(contentType), w.neg)]
+		}
+		return w.config.table.encodings[w.neg.best]
+	}
+	candidates := w.config.table.acceptedEncodings(w.neg)
+	accept := parseEncodings(w.request.Header.Values(acceptEncoding))
+	enc := w.config.negotiator.Negotiate(w.request, accept, candidates, w.Header())
+	if !contains(candidates, enc) {
+		w.skip = SkipNegotiator
+		return ""
+	}
+	return enc
+}
+
 // startCompress initializes a compressing writer and writes the buffer.
 func (w *compressWriter) startCompress(enc string, buf []byte) error {
-	comp, ok := w.config.compressor[enc]
+	comp, ok := w.config.compressorFor(enc, w.Header().Get(contentType))
 	if !ok {
 		panic("unknown compressor")
 	}
@@ -161,7 +227,16 @@ func (w *compressWriter) startCompress(enc string, buf []byte) error {
 	w.Header().Del(contentLength)
 
 	// See the comment about ranges in adapter.go
-	w.Header().Del(acceptRanges)
+	if !w.config.ranges {
+		w.Header().Del(acceptRanges)
+	}
+
+	w.announceDictionary()
+	if w.rewriteETag(enc) {
+		w.notModified()
+		w.recycleBuffer()
+		return nil
+	}
 
 	// Write the header to gzip response.
 	if w.code != 0 {
@@ -176,10 +251,37 @@ func (w *compressWriter) startCompress(enc string, buf []byte) error {
 	// If there aren't any, we shouldn't initialize it yet because on Close it will
 	// write the gzip header even if nothing was ever written.
 	if len(buf) > 0 {
-		w.w = comp.comp.Get(w.ResponseWriter)
+		var parent io.Writer = w.ResponseWriter
+		if w.config.measured() {
+			start := w.config.now()
+			w.parent = countingWriter{w: w.ResponseWriter, now: w.config.now}
+			parent = &w.parent
+			defer w.addCompTime(start)
+		}
+		switch {
+		case comp.dict != nil:
+			// The output depends on the dictionary, so it is not cached.
+			w.w = comp.dict.Get(parent, w.dict)
+		case w.config.cache != nil:
+			w.w = w.newCachingWriter(enc, comp, parent)
+		default:
+			w.w = comp.comp.Get(parent)
+		}
 		w.enc = enc
 
+		if comp.dict != nil {
+			if h := dictionary.Header(enc, w.dict.Hash()); h != nil {
+				if _, err := parent.Write(h); err != nil {
+					return err
+				}
+			}
+		}
+
+		if w.config.sampler != nil {
+			w.sample = w.config.sampler.Sample(w.request, w.Header())
+		}
 		n, err := w.w.Write(buf)
+		w.sampleBody(buf[:n])
 
 		// This should never happen (per io.Writer docs), but if the write didn't
 		// accept the entire buffer but returned no specific error, we have no clue
@@ -196,8 +298,14 @@ func (w *compressWriter) startCompress(enc string, buf []byte) error {
 func (w *compressWriter) startPlain(buf []byte) error {
 	// See the comment about ranges in adapter.go; we need to do it even in this case
 	// because adapter will strip the range header anyway.
-	w.Header().Del(acceptRanges)
+	if !w.config.ranges {
+		w.Header().Del(acceptRanges)
+	}
 
+	w.announceDictionary()
+	if w.code == http.StatusNotModified {
+		w.notModifiedETag()
+	}
 	if w.code != 0 {
 		w.ResponseWriter.WriteHeader(w.code)
 		// Ensure that no other WriteHeader's happen
@@ -228,12 +336,36 @@ func (w *compressWriter) WriteHeader(code int) {
 }
 
 // Close closes the compression Writer.
+// Errors are also reported to the ErrorHandler, if any, and statistics
+// are reported to the Observer, if any.
 func (w *compressWriter) Close() error {
+	err := w.close()
+	if err != nil {
+		w.reportError("close", err)
+	}
+	if w.config.stats != nil && w.enc != "" && err == nil {
+		w.record()
+	}
+	if w.config.observer != nil {
+		w.observe()
+	}
+	return err
+}
+
+func (w *compressWriter) close() error {
 	if w.w != nil && w.enc == "" {
 		return nil
 	}
 	if cw, ok := w.w.(io.Closer); ok {
+		if w.timed() {
+			start := w.config.now()
+			defer w.addCompTime(start)
+		}
 		w.w = nil
+		if w.sample != nil {
+			w.sample.Close()
+			w.sample = nil
+		}
 		return cw.Close()
 	}
 
@@ -242,6 +374,7 @@ func (w *compressWriter) Close() error {
 	if w.buf != nil {
 		buf = *w.buf
 	}
+	w.skip = w.skipReason(w.Header().Get(contentEncoding), w.Header().Get(contentType))
 	err := w.startPlain(buf)
 	// Returns the error if any at write.
 	if err != nil {
@@ -271,7 +404,13 @@ func (w *compressWriter) Flush() {
 	// - in case we are NOT bypassing compression, w.w is the compressor, and therefore we flush the
 	//   compressor and then we flush the parent ResponseWriter.
 	if fw, ok := w.w.(Flusher); ok {
-		_ = fw.Flush()
+		if w.timed() {
+			start := w.config.now()
+			defer w.addCompTime(start)
+		}
+		if err := fw.Flush(); err != nil {
+			w.reportError("flush", err)
+		}
 	}
 
 	// Flush the ResponseWriter (the previous Flusher is not expected to flush the parent writer).
@@ -289,6 +428,79 @@ func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 	return nil, nil, fmt.Errorf("http.Hijacker interface is not supported")
 }
 
+// skipReason returns the reason why a response with the specified Content-Encoding
+// and Content-Type is not compressed.
+func (w *compressWriter) skipReason(ce, ct string) SkipReason {
+	switch {
+	case w.skip != NotSkipped:
+		// Already determined, e.g. by encoding.
+		return w.skip
+	case ce != "":
+		return SkipAlreadyEncoded
+	case noTransform(w.Header()):
+		return SkipNoTransform
+	case ct != "" && !handleContentType(ct, w.config.contentTypes, w.config.blacklist):
+		return SkipContentType
+	default:
+		return SkipMinSize
+	}
+}
+
+// timed returns true if the time spent in the compressor has to be measured.
+func (w *compressWriter) timed() bool {
+	return w.enc != "" && w.config.measured()
+}
+
+// measured returns true if the size of the compressed responses and the time
+// spent in the compressor have to be measured.
+func (c *config) measured() bool {
+	return c.observer != nil || c.stats != nil
+}
+
+func (w *compressWriter) addCompTime(start time.Time) {
+	w.compTime += w.config.now().Sub(start)
+}
+
+// observe reports the statistics of the response to the Observer.
+func (w *compressWriter) observe() {
+	s := Stats{
+		Encoding:          w.enc,
+		SkipReason:        w.skip,
+		UncompressedBytes: w.written,
+		CompressedBytes:   w.written,
+	}
+	if w.enc != "" {
+		s.CompressedBytes = w.parent.n
+		s.CompressorTime = w.compTime - w.parent.d
+	} else if w.skip == SkipNotModified {
+		s.CompressedBytes = 0
+	}
+	w.config.observer(w.request, s)
+}
+
+// record adds the statistics of the compressed response to the ones used by
+// PreferSmallest and PreferFastest.
+func (w *compressWriter) record() {
+	if i := w.config.table.index(w.enc); i >= 0 {
+		w.config.stats.record(w.Header().Get(contentType), i, w.written, w.parent.n, w.compTime-w.parent.d)
+	}
+}
+
+// reportError reports the first error that occurred while serving the response
+// to the ErrorHandler, if any.
+func (w *compressWriter) reportError(op string, err error) {
+	if w.failed || w.config.errorHandler == nil {
+		return
+	}
+	w.failed = true
+	w.config.errorHandler(w.request, &CompressionError{
+		Op:       op,
+		Encoding: w.enc,
+		Written:  w.written,
+		Err:      err,
+	})
+}
+
 func (w *compressWriter) getBuffer() *[]byte {
 	b := w.pool.Get()
 	if b == nil {
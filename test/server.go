@@ -5,6 +5,7 @@ import (
 
 	"github.com/CAFxX/httpcompression"
 	"github.com/CAFxX/httpcompression/contrib/klauspost/zstd"
+	"github.com/CAFxX/httpcompression/dictionary"
 
 	kpzstd "github.com/klauspost/compress/zstd"
 )
@@ -14,7 +15,7 @@ var data = []byte(`==================================
 ==================================
 `)
 
-var dictionary = []byte{
+var zstdDictionary = []byte{
 	0x37, 0xa4, 0x30, 0xec, 0xd1, 0xa6, 0x6c, 0x2e, 0x1a, 0x10, 0xe8, 0x0d,
 	0x07, 0xff, 0xff, 0xff, 0xb7, 0xbb, 0xf3, 0x9b, 0xec, 0xce, 0x6f, 0xb2,
 	0x9b, 0xd2, 0x7f, 0xca, 0x2f, 0x29, 0xf2, 0x29, 0xa3, 0x0e, 0x11, 0x33,
@@ -64,14 +65,20 @@ var dictionary = []byte{
 // $ curl -H "accept-encoding: zstd, z_2e6ca6d1" -v --output - localhost:8080 | zstd -d -D dictionary -c --no-progress -
 // To test curl interoperability:
 // $ curl --compressed -v --output - localhost:8080
+// To test Compression Dictionary Transport, using the response itself as the dictionary:
+// $ curl -H "accept-encoding: dcz" -H "available-dictionary: :$(curl -s localhost:8080 | sha256sum | xxd -r -p | base64):" -v --output - localhost:8080
 
 func main() {
 	zenc, _ := zstd.New()
-	zdenc, _ := zstd.New(kpzstd.WithEncoderDict(dictionary))
+	zdenc, _ := zstd.New(kpzstd.WithEncoderDict(zstdDictionary))
+	dcz, _ := zstd.NewDictionary()
+	dict, _ := dictionary.New(data, dictionary.Options{Match: "/*", Path: "/"})
 	gz, _ := httpcompression.DefaultAdapter(
 		httpcompression.MinSize(0),
 		httpcompression.Compressor(zstd.Encoding, 2, zenc),
 		httpcompression.Compressor("z_2e6ca6d1", 3, zdenc),
+		httpcompression.DictionaryCompressor(dictionary.Zstd, 4, dcz),
+		httpcompression.Dictionaries(dict),
 	)
 	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Write(data)
@@ -0,0 +1,330 @@
+package httpcompression
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/CAFxX/httpcompression/contrib/andybalholm/brotli"
+	"github.com/CAFxX/httpcompression/contrib/compress/zlib"
+)
+
+// Transport is an http.RoundTripper that negotiates the compression of response bodies
+// using all the Content-Encodings for which a DecompressorProvider is available, and
+// that transparently decodes the compressed response bodies.
+//
+// Like http.Transport does for gzip, if the response body is decoded the Content-Encoding
+// and Content-Length headers are removed from the response, Response.ContentLength is set
+// to -1, and Response.Uncompressed is set to true.
+// Compression is not negotiated (and therefore response bodies are not decoded) if the
+// request already contains an Accept-Encoding header, or if it is a range request.
+//
+// Transport can optionally compress the request bodies as well: see RequestCompressor
+// and RequestCompressionFallback.
+type Transport struct {
+	base     http.RoundTripper
+	decs     map[string]DecompressorProvider
+	accepted string // value of the Accept-Encoding header
+
+	reqEncoding   string             // Content-Encoding used to compress request bodies
+	reqCompressor CompressorProvider // compressor used for request bodies; nil disables request compression
+	reqFallback   bool               // retry without compression on 415 Unsupported Media Type
+	minSize       int                // minimum size of the request bodies to be compressed
+}
+
+var _ http.RoundTripper = &Transport{}
+
+// NewTransport returns a Transport wrapping base; if base is nil, http.DefaultTransport
+// is used. It accepts the same options as Adapter: the Transport advertises all the
+// Content-Encodings that would be accepted by RequestDecompressor with the same options.
+// An error will be returned if invalid options are given.
+func NewTransport(base http.RoundTripper, opts ...Option) (*Transport, error) {
+	c := config{
+		prefer:     PreferServer,
+		compressor: comps{},
+	}
+	for _, o := range opts {
+		err := o(&c)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	decs, err := c.decompressors()
+	if err != nil {
+		return nil, err
+	}
+	accepted := make([]string, 0, len(decs))
+	for enc := range decs {
+		accepted = append(accepted, enc)
+	}
+	// List the encodings in order of priority, as this may be used by servers
+	// that prefer the order specified by the client.
+	sort.Slice(accepted, func(i, j int) bool {
+		pi, pj := c.compressor[accepted[i]].priority, c.compressor[accepted[j]].priority
+		if pi != pj {
+			return pi > pj
+		}
+		return accepted[i] < accepted[j]
+	})
+
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	t := &Transport{
+		base:          base,
+		decs:          decs,
+		accepted:      strings.Join(accepted, ", "),
+		reqEncoding:   c.requestEncoding,
+		reqCompressor: c.requestCompressor,
+		reqFallback:   c.requestFallback,
+		minSize:       c.minSize,
+	}
+	return t, nil
+}
+
+// NewDefaultTransport is like NewTransport, but it includes the same defaults used by
+// DefaultAdapter, so that all the Content-Encodings used by DefaultAdapter are negotiated.
+// The provided opts override the defaults.
+func NewDefaultTransport(base http.RoundTripper, opts ...Option) (*Transport, error) {
+	defaults := []Option{
+		DeflateCompressionLevel(zlib.DefaultCompression),
+		GzipCompressionLevel(gzip.DefaultCompression),
+		BrotliCompressionLevel(brotli.DefaultCompression),
+		defaultZstandardCompressor(),
+		MinSize(DefaultMinSize),
+	}
+	opts = append(defaults, opts...)
+	return NewTransport(base, opts...)
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	negotiate := t.accepted != "" && req.Header.Get(acceptEncoding) == "" && req.Header.Get(_range) == ""
+	if !negotiate && t.reqCompressor == nil {
+		return t.base.RoundTrip(req)
+	}
+
+	// A RoundTripper must not modify the request.
+	req = req.Clone(req.Context())
+	if negotiate {
+		req.Header.Set(acceptEncoding, t.accepted)
+	}
+
+	res, err := t.roundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if !negotiate || req.Method == http.MethodHead || res.Body == nil || res.Body == http.NoBody {
+		return res, nil
+	}
+
+	encs := parseContentEncoding(res.Header.Values(contentEncoding))
+	if len(encs) == 0 {
+		return res, nil
+	}
+	for _, enc := range encs {
+		if _, ok := t.decs[enc]; !ok {
+			// We can not decode the response body, so return it as-is.
+			return res, nil
+		}
+	}
+
+	res.Header.Del(contentEncoding)
+	res.Header.Del(contentLength)
+	res.ContentLength = -1
+	res.Uncompressed = true
+	res.Body = &transportBody{
+		body: res.Body,
+		encs: encs,
+		decs: t.decs,
+	}
+	return res, nil
+}
+
+// roundTrip sends the request, compressing the request body if needed. If
+// the server rejects the compressed body with 415 Unsupported Media Type and
+// the fallback is enabled, the request is retried once without compression.
+func (t *Transport) roundTrip(req *http.Request) (*http.Response, error) {
+	creq, compressed, err := t.compressRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	res, err := t.base.RoundTrip(creq)
+	if err != nil || !compressed || !t.reqFallback || req.GetBody == nil || res.StatusCode != http.StatusUnsupportedMediaType {
+		return res, err
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		// We can not retry, so return the original response.
+		return res, nil
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 4<<10))
+	_ = res.Body.Close()
+
+	req = req.Clone(req.Context())
+	req.Body = body
+	return t.base.RoundTrip(req)
+}
+
+// compressRequest returns the request to be sent: if the body has to be compressed
+// the returned request has a body that is compressed as it is read, and the
+// returned bool is true.
+func (t *Transport) compressRequest(req *http.Request) (*http.Request, bool, error) {
+	if t.reqCompressor == nil || req.Body == nil || req.Body == http.NoBody || req.Header.Get(contentEncoding) != "" {
+		return req, false, nil
+	}
+	if req.ContentLength > 0 && req.ContentLength < int64(t.minSize) {
+		return req, false, nil
+	}
+
+	body := req.Body
+	if req.ContentLength <= 0 && t.minSize > 0 {
+		// The size of the body is unknown (for client requests, a zero ContentLength
+		// with a non-nil body means unknown), so we need to read up to minSize bytes
+		// to decide whether to compress it or not, like compressWriter does.
+		buf := make([]byte, t.minSize)
+		n, err := io.ReadFull(body, buf)
+		switch err {
+		case nil:
+			body = &multiReadCloser{io.MultiReader(bytes.NewReader(buf), body), body}
+		case io.EOF, io.ErrUnexpectedEOF:
+			_ = body.Close()
+			req = req.Clone(req.Context())
+			req.Body = io.NopCloser(bytes.NewReader(buf[:n]))
+			req.ContentLength = int64(n)
+			return req, false, nil
+		default:
+			_ = body.Close()
+			return nil, false, err
+		}
+	}
+
+	req = req.Clone(req.Context())
+	req.Body = t.compressBody(body)
+	req.ContentLength = -1
+	req.Header.Del(contentLength)
+	req.Header.Set(contentEncoding, t.reqEncoding)
+	if getBody := req.GetBody; getBody != nil {
+		req.GetBody = func() (io.ReadCloser, error) {
+			body, err := getBody()
+			if err != nil {
+				return nil, err
+			}
+			return t.compressBody(body), nil
+		}
+	}
+	return req, true, nil
+}
+
+// compressBody returns a reader that yields the compressed contents of body.
+// The compression is performed in a separate goroutine that terminates once
+// body has been fully compressed or the returned reader is closed; body is
+// always closed.
+func (t *Transport) compressBody(body io.ReadCloser) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		cw := t.reqCompressor.Get(pw)
+		_, err := io.Copy(cw, body)
+		if cerr := cw.Close(); err == nil {
+			err = cerr
+		}
+		_ = body.Close()
+		pw.CloseWithError(err)
+	}()
+	return pr
+}
+
+type multiReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+var errReadOnClosedBody = errors.New("httpcompression: read on closed response body")
+
+// transportBody is the decoded response body returned by Transport.
+// Decoders are initialized lazily on the first Read, so that RoundTrip
+// does not block reading the encoded response body.
+type transportBody struct {
+	body io.ReadCloser
+	encs []string
+	decs map[string]DecompressorProvider
+
+	mu       sync.Mutex // guards the fields below
+	r        io.Reader
+	decoders []io.ReadCloser
+	closed   bool
+}
+
+func (b *transportBody) Read(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return 0, errReadOnClosedBody
+	}
+	if b.r == nil {
+		var r io.Reader = b.body
+		// Content-Encodings are listed in the order in which they were
+		// applied, so they have to be removed in reverse order.
+		for i := len(b.encs) - 1; i >= 0; i-- {
+			d := b.decs[b.encs[i]].Get(r)
+			b.decoders = append(b.decoders, d)
+			r = d
+		}
+		b.r = r
+	}
+	return b.r.Read(p)
+}
+
+func (b *transportBody) Close() error {
+	// Close the body first, so that a Read blocked on the body (that is holding
+	// the lock) is unblocked.
+	err := b.body.Close()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return err
+	}
+	b.closed = true
+	for i := len(b.decoders) - 1; i >= 0; i-- {
+		_ = b.decoders[i].Close()
+	}
+	b.decoders = nil
+	return err
+}
+
+// RequestCompressor is an option that enables the compression of the request bodies
+// sent by Transport, using the specified Content-Encoding and compressor.
+// Request bodies smaller than MinSize, and bodies of requests that already have a
+// Content-Encoding header, are sent unmodified. If compressor is nil request bodies
+// are not compressed (the default).
+// It is used only by Transport.
+func RequestCompressor(contentEncoding string, compressor CompressorProvider) Option {
+	return func(c *config) error {
+		if compressor != nil && contentEncoding == "" {
+			return errors.New("request content-encoding can not be empty")
+		}
+		c.requestEncoding = contentEncoding
+		c.requestCompressor = compressor
+		return nil
+	}
+}
+
+// RequestCompressionFallback is an option that controls whether Transport, if the
+// server rejects a compressed request body with 415 Unsupported Media Type, retries
+// the request once with an uncompressed body. The request can be retried only if
+// its GetBody field is set (http.NewRequest does this for the common body types).
+// The default is false.
+// It is used only by Transport.
+func RequestCompressionFallback(enabled bool) Option {
+	return func(c *config) error {
+		c.requestFallback = enabled
+		return nil
+	}
+}
@@ -0,0 +1,222 @@
+package httpcompression
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/CAFxX/httpcompression/contrib/klauspost/zstd"
+	"github.com/stretchr/testify/assert"
+
+	ibrotli "github.com/andybalholm/brotli"
+	kpzstd "github.com/klauspost/compress/zstd"
+)
+
+// recordingTransport records the Content-Encoding of the responses, before they are decoded.
+type recordingTransport struct {
+	encoding string
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := http.DefaultTransport.RoundTrip(req)
+	if err == nil {
+		t.encoding = res.Header.Get(contentEncoding)
+	}
+	return res, err
+}
+
+func TestTransport(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(newTestHandler(testBody))
+	defer srv.Close()
+
+	cases := []struct {
+		encoding string
+		opts     []Option
+	}{
+		{"zstd", nil},
+		{"br", []Option{ZstandardCompressor(nil)}},
+		{"gzip", []Option{ZstandardCompressor(nil), BrotliCompressor(nil)}},
+		{"deflate", []Option{ZstandardCompressor(nil), BrotliCompressor(nil), GzipCompressor(nil)}},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.encoding, func(t *testing.T) {
+			rt := &recordingTransport{}
+			tr, err := NewDefaultTransport(rt, c.opts...)
+			assert.Nil(t, err)
+			client := &http.Client{Transport: tr}
+
+			res, err := client.Get(srv.URL)
+			assert.Nil(t, err)
+			defer res.Body.Close()
+			b, err := io.ReadAll(res.Body)
+			assert.Nil(t, err)
+
+			assert.Equal(t, c.encoding, rt.encoding)
+			assert.Equal(t, testBody, string(b))
+			assert.Equal(t, "", res.Header.Get(contentEncoding))
+			assert.Equal(t, int64(-1), res.ContentLength)
+			assert.True(t, res.Uncompressed)
+		})
+	}
+}
+
+func TestTransportExplicitAcceptEncoding(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(newTestHandler(testBody))
+	defer srv.Close()
+
+	tr, err := NewDefaultTransport(nil)
+	assert.Nil(t, err)
+	client := &http.Client{Transport: tr}
+
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	req.Header.Set(acceptEncoding, "br")
+	res, err := client.Do(req)
+	assert.Nil(t, err)
+	defer res.Body.Close()
+	b, err := io.ReadAll(res.Body)
+	assert.Nil(t, err)
+
+	assert.Equal(t, "br", res.Header.Get(contentEncoding))
+	assert.False(t, res.Uncompressed)
+	d, err := io.ReadAll(ibrotli.NewReader(bytes.NewReader(b)))
+	assert.Nil(t, err)
+	assert.Equal(t, testBody, string(d))
+}
+
+func TestTransportDictionary(t *testing.T) {
+	t.Parallel()
+
+	const coding = "z_000004d2"
+	dict := []byte(testBody[:100])
+
+	zenc, err := zstd.New(kpzstd.WithEncoderDictRaw(1234, dict))
+	assert.Nil(t, err)
+	srv := httptest.NewServer(newTestHandler(testBody, Compressor(coding, 100, zenc)))
+	defer srv.Close()
+
+	zdec, err := zstd.NewDecompressor(kpzstd.WithDecoderDictRaw(1234, dict))
+	assert.Nil(t, err)
+	rt := &recordingTransport{}
+	tr, err := NewDefaultTransport(rt, Decompressor(coding, zdec))
+	assert.Nil(t, err)
+	client := &http.Client{Transport: tr}
+
+	res, err := client.Get(srv.URL)
+	assert.Nil(t, err)
+	defer res.Body.Close()
+	b, err := io.ReadAll(res.Body)
+	assert.Nil(t, err)
+
+	assert.Equal(t, coding, rt.encoding)
+	assert.Equal(t, testBody, string(b))
+}
+
+// newEchoServer returns a server that responds with the request body and, in the X-Content-Encoding header,
+// the Content-Encoding of the request body as received.
+func newEchoServer(t *testing.T, reject bool) *httptest.Server {
+	mw, err := DefaultRequestDecompressor()
+	assert.Nil(t, err)
+	echo := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Write(b)
+	}))
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Content-Encoding", r.Header.Get(contentEncoding))
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+			return
+		}
+		if reject && r.Header.Get(contentEncoding) != "" {
+			http.Error(w, "unsupported", http.StatusUnsupportedMediaType)
+			return
+		}
+		echo.ServeHTTP(w, r)
+	}))
+}
+
+func TestTransportRequestCompression(t *testing.T) {
+	t.Parallel()
+
+	srv := newEchoServer(t, false)
+	defer srv.Close()
+
+	gz, err := NewDefaultGzipCompressor(gzip.DefaultCompression)
+	assert.Nil(t, err)
+	tr, err := NewDefaultTransport(nil, RequestCompressor("gzip", gz))
+	assert.Nil(t, err)
+	client := &http.Client{Transport: tr}
+
+	cases := []struct {
+		name     string
+		path     string
+		body     func(s string) io.Reader
+		size     int
+		encoding string
+	}{
+		{"large", "/", func(s string) io.Reader { return strings.NewReader(s) }, len(testBody), "gzip"},
+		{"small", "/", func(s string) io.Reader { return strings.NewReader(s) }, DefaultMinSize - 1, ""},
+		{"large unknown size", "/", func(s string) io.Reader { return ioutil.NopCloser(strings.NewReader(s)) }, len(testBody), "gzip"},
+		{"small unknown size", "/", func(s string) io.Reader { return ioutil.NopCloser(strings.NewReader(s)) }, DefaultMinSize - 1, ""},
+		{"exact unknown size", "/", func(s string) io.Reader { return ioutil.NopCloser(strings.NewReader(s)) }, DefaultMinSize, "gzip"},
+		{"redirect", "/redirect", func(s string) io.Reader { return strings.NewReader(s) }, len(testBody), "gzip"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			body := testBody[:c.size]
+			res, err := client.Post(srv.URL+c.path, "text/plain", c.body(body))
+			assert.Nil(t, err)
+			defer res.Body.Close()
+			b, err := io.ReadAll(res.Body)
+			assert.Nil(t, err)
+
+			assert.Equal(t, http.StatusOK, res.StatusCode)
+			assert.Equal(t, c.encoding, res.Header.Get("X-Content-Encoding"))
+			assert.Equal(t, body, string(b))
+		})
+	}
+}
+
+func TestTransportRequestCompressionFallback(t *testing.T) {
+	t.Parallel()
+
+	srv := newEchoServer(t, true)
+	defer srv.Close()
+
+	gz, err := NewDefaultGzipCompressor(gzip.DefaultCompression)
+	assert.Nil(t, err)
+
+	for _, fallback := range []bool{false, true} {
+		tr, err := NewDefaultTransport(nil, RequestCompressor("gzip", gz), RequestCompressionFallback(fallback))
+		assert.Nil(t, err)
+		client := &http.Client{Transport: tr}
+
+		res, err := client.Post(srv.URL, "text/plain", strings.NewReader(testBody))
+		assert.Nil(t, err)
+		b, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		assert.Nil(t, err)
+
+		if fallback {
+			assert.Equal(t, http.StatusOK, res.StatusCode)
+			assert.Equal(t, "", res.Header.Get("X-Content-Encoding"))
+			assert.Equal(t, testBody, string(b))
+		} else {
+			assert.Equal(t, http.StatusUnsupportedMediaType, res.StatusCode)
+			assert.Equal(t, "gzip", res.Header.Get("X-Content-Encoding"))
+		}
+	}
+}